@@ -0,0 +1,155 @@
+/*
+Copyright © 2024 Conveyor CI Contributors
+*/
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	execdriver "github.com/open-ug/conveyor/cmd/exec-driver"
+	webhookdriver "github.com/open-ug/conveyor/cmd/webhook-driver"
+	runtime "github.com/open-ug/conveyor/pkg/driver-runtime"
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/spf13/cobra"
+)
+
+// driverOptions are the flags shared by the built-in drivers.
+type driverOptions struct {
+	Name      string
+	Resources []string
+	Events    []string
+	Labels    map[string]string
+	APIURL    string
+	NatsURL   string
+	CertFile  string
+	KeyFile   string
+	CAFile    string
+}
+
+// addFlags registers the shared driver flags on cmd.
+func (o *driverOptions) addFlags(cmd *cobra.Command, name string) {
+	cmd.Flags().StringVarP(&o.Name, "name", "n", name, "Name of the driver")
+	cmd.Flags().StringSliceVarP(&o.Resources, "resources", "r", []string{"pipe"}, "Resources the driver will manage")
+	cmd.Flags().StringSliceVar(&o.Events, "events", []string{types.EventCreate, types.EventUpdate, types.EventProcess}, "Event patterns the driver reconciles")
+	cmd.Flags().StringToStringVarP(&o.Labels, "labels", "l", nil, "Labels of the host steps can select, e.g. arch=arm64")
+	cmd.Flags().StringVar(&o.APIURL, "api-url", "http://localhost:8080", "URL of the Conveyor API Server")
+	cmd.Flags().StringVar(&o.NatsURL, "nats-url", "nats://localhost:4222", "URL of the NATS server")
+	cmd.Flags().StringVar(&o.CertFile, "cert", "", "Path to the client certificate, enables authentication")
+	cmd.Flags().StringVar(&o.KeyFile, "key", "", "Path to the client private key")
+	cmd.Flags().StringVar(&o.CAFile, "ca", "", "Path to the CA certificate of the server")
+}
+
+// client creates the driver runtime client configured by the flags.
+func (o *driverOptions) client() (*runtime.Client, error) {
+	options := runtime.ConfigOptions{}
+	if o.CertFile != "" {
+		cert, err := os.ReadFile(o.CertFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client cert: %w", err)
+		}
+		key, err := os.ReadFile(o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client key: %w", err)
+		}
+		options.AuthEnabled = true
+		options.Cert = cert
+		options.Key = key
+	}
+	if o.CAFile != "" {
+		rootCA, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA cert: %w", err)
+		}
+		options.RootCA = rootCA
+	}
+	return runtime.NewClient(o.APIURL, o.NatsURL, options)
+}
+
+var DriverCmd = &cobra.Command{
+	Use:   "driver",
+	Short: "Run a built-in driver",
+	Long:  `Run one of the drivers that ship with Conveyor CI.`,
+}
+
+var execOptions = &driverOptions{}
+var execDriver = &execdriver.Driver{}
+
+var ExecDriverCmd = &cobra.Command{
+	Use:   "exec",
+	Short: "Run the exec driver",
+	Long: `Run the exec driver, which runs the script and commands in the spec of resources as local subprocesses.
+Their output is streamed to the run logs, and the exit code decides whether the step succeeds.
+
+Examples:
+  conveyor driver exec                                   # Run scripts of pipe resources in temporary directories
+  conveyor driver exec --workdir /srv/builds --timeout 30m
+  conveyor driver exec --resources build,test --labels arch=arm64
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, err := execOptions.client()
+		if err != nil {
+			return err
+		}
+		return execdriver.Listen(client, execdriver.Options{
+			Name:      execOptions.Name,
+			Resources: execOptions.Resources,
+			Events:    execOptions.Events,
+			Labels:    execOptions.Labels,
+			Driver:    *execDriver,
+		})
+	},
+}
+
+var webhookOptions = &driverOptions{}
+var webhookBridge = &webhookdriver.Bridge{}
+
+var WebhookDriverCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Run the webhook bridge driver",
+	Long: `Run a driver that delivers resource events to an HTTP endpoint, so drivers can be written in any language that serves HTTP.
+Events are POSTed as JSON driver messages. The endpoint answers with the driver result, or with 202 Accepted and posts the
+result to the URL in the X-Conveyor-Callback-URL header later. The secret is read from CONVEYOR_WEBHOOK_SECRET, callbacks
+are rejected without it unless --insecure-callbacks is set. It is required when authentication is enabled.
+
+Examples:
+  conveyor driver webhook --name deployer --url http://localhost:3000/reconcile
+  CONVEYOR_WEBHOOK_SECRET=s3cret conveyor driver webhook --url https://deployer.internal/reconcile --callback-url https://conveyor.example.com
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if webhookBridge.URL == "" {
+			return fmt.Errorf("--url is required")
+		}
+		client, err := webhookOptions.client()
+		if err != nil {
+			return err
+		}
+		bridge := *webhookBridge
+		bridge.Secret = []byte(os.Getenv("CONVEYOR_WEBHOOK_SECRET"))
+		return webhookdriver.Listen(client, webhookdriver.Options{
+			Name:      webhookOptions.Name,
+			Resources: webhookOptions.Resources,
+			Events:    webhookOptions.Events,
+			Labels:    webhookOptions.Labels,
+			Bridge:    bridge,
+		})
+	},
+}
+
+func init() {
+	execOptions.addFlags(ExecDriverCmd, "exec")
+	ExecDriverCmd.Flags().StringVarP(&execDriver.WorkDir, "workdir", "w", "", "Directory commands run in, defaults to a temporary directory per run")
+	ExecDriverCmd.Flags().DurationVar(&execDriver.Timeout, "timeout", time.Hour, "Timeout of commands whose spec sets none, 0 for no timeout")
+	ExecDriverCmd.Flags().IntVar(&execDriver.TailLines, "tail", execdriver.DefaultTailLines, "Number of output lines reported in the result")
+
+	webhookOptions.addFlags(WebhookDriverCmd, "webhook")
+	WebhookDriverCmd.Flags().StringVar(&webhookBridge.URL, "url", "", "URL of the endpoint events are delivered to")
+	WebhookDriverCmd.Flags().StringVar(&webhookBridge.CallbackURL, "callback-url", "", "Base URL of the API Server the endpoint posts callbacks to, defaults to --api-url")
+	WebhookDriverCmd.Flags().DurationVar(&webhookBridge.Timeout, "timeout", webhookdriver.DefaultTimeout, "Timeout of webhook requests")
+	WebhookDriverCmd.Flags().BoolVar(&webhookBridge.InsecureCallbacks, "insecure-callbacks", false, "Accept unsigned callbacks when no secret is set")
+	WebhookDriverCmd.Flags().DurationVar(&webhookBridge.CallbackTimeout, "callback-timeout", webhookdriver.DefaultCallbackTimeout, "How long to wait for the result of an accepted delivery")
+
+	DriverCmd.AddCommand(ExecDriverCmd)
+	DriverCmd.AddCommand(WebhookDriverCmd)
+}
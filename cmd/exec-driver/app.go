@@ -0,0 +1,43 @@
+package execdriver
+
+import (
+	"context"
+	"fmt"
+
+	runtime "github.com/open-ug/conveyor/pkg/driver-runtime"
+)
+
+// Options configure the exec driver started by Listen.
+type Options struct {
+	// Name is the name the driver is registered under.
+	Name string
+	// Resources are the resource types the driver runs.
+	Resources []string
+	// Events are the event patterns the driver reconciles.
+	Events []string
+	// Labels describe the host, so steps can select it.
+	Labels map[string]string
+	// Driver configures how commands are run.
+	Driver Driver
+}
+
+// Listen runs the exec driver until it receives SIGINT or SIGTERM.
+func Listen(client *runtime.Client, options Options) error {
+	exec := options.Driver
+	driver := &runtime.Driver{
+		Reconcile: exec.Reconcile,
+		Name:      options.Name,
+		Resources: options.Resources,
+	}
+
+	driverManager, err := client.NewDriverManager(driver, options.Events)
+	if err != nil {
+		return fmt.Errorf("error creating driver manager: %w", err)
+	}
+	driverManager.Labels = options.Labels
+
+	ctx, stop := runtime.SignalContext(context.Background())
+	defer stop()
+
+	return driverManager.Run(ctx)
+}
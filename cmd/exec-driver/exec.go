@@ -0,0 +1,323 @@
+package execdriver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/open-ug/conveyor/pkg/driver-runtime/log"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+const (
+	// DefaultTailLines is the number of output lines kept for the driver result.
+	DefaultTailLines = 20
+	// waitDelay is how long a cancelled command gets to close its output before it is abandoned.
+	waitDelay = 5 * time.Second
+)
+
+// DefaultShell runs scripts and commands. `-e` stops a script at the first failing command.
+var DefaultShell = []string{"/bin/sh", "-e", "-c"}
+
+/*
+Spec is what the exec driver runs, read from the spec of the resource:
+
+	spec:
+	  script: |
+	    go build ./...
+	    go test ./...
+	  workdir: src
+	  env:
+	    CGO_ENABLED: "0"
+	  timeout: 10m
+	  steps:
+	    test:
+	      commands: ["go test ./..."]
+
+Steps holds specs by step ID, so a pipeline running the driver in several steps can run
+something else in each of them. Fields of the step spec override those of the resource spec.
+*/
+type Spec struct {
+	// Script is run by the shell as one process.
+	Script string `json:"script,omitempty"`
+	// Commands are run by the shell one after the other until one of them fails. They run after Script.
+	Commands []string `json:"commands,omitempty"`
+	// Shell is the command scripts are passed to as last argument. Defaults to `/bin/sh -e -c`.
+	Shell []string `json:"shell,omitempty"`
+	// WorkDir is the directory the commands run in, relative to the working directory of the driver.
+	WorkDir string `json:"workdir,omitempty"`
+	// Env is added to the environment of the driver.
+	Env map[string]string `json:"env,omitempty"`
+	// Timeout bounds how long all commands may run, e.g. `10m`.
+	Timeout string `json:"timeout,omitempty"`
+	// Steps are the specs of the steps of a pipeline, by step ID.
+	Steps map[string]Spec `json:"steps,omitempty"`
+}
+
+// merge returns the spec with the fields set in override replacing its own.
+func (s Spec) merge(override Spec) Spec {
+	if override.Script != "" || len(override.Commands) > 0 {
+		s.Script = override.Script
+		s.Commands = override.Commands
+	}
+	if len(override.Shell) > 0 {
+		s.Shell = override.Shell
+	}
+	if override.WorkDir != "" {
+		s.WorkDir = override.WorkDir
+	}
+	if override.Timeout != "" {
+		s.Timeout = override.Timeout
+	}
+	if len(override.Env) > 0 {
+		env := map[string]string{}
+		for k, v := range s.Env {
+			env[k] = v
+		}
+		for k, v := range override.Env {
+			env[k] = v
+		}
+		s.Env = env
+	}
+	return s
+}
+
+// Driver runs the script and commands of resources as local subprocesses.
+type Driver struct {
+	// WorkDir is the directory relative working directories of specs are resolved against.
+	// If empty, every reconcile runs in a temporary directory that is removed afterwards.
+	WorkDir string
+	// Timeout bounds commands whose spec sets no timeout. Zero means no limit.
+	Timeout time.Duration
+	// TailLines is the number of output lines kept in the result. Defaults to DefaultTailLines.
+	TailLines int
+}
+
+// Reconcile runs the spec of the resource in payload and reports its outcome.
+func (d *Driver) Reconcile(payload string, event string, runID string, log *logger.DriverLogger) types.DriverResult {
+	var resource types.Resource
+	if err := json.Unmarshal([]byte(payload), &resource); err != nil {
+		return failure(fmt.Sprintf("Invalid resource: %v", err), -1, nil)
+	}
+
+	spec, err := parseSpec(resource.Spec, log.Labels["step"])
+	if err != nil {
+		return failure(fmt.Sprintf("Invalid spec: %v", err), -1, nil)
+	}
+	if spec.Script == "" && len(spec.Commands) == 0 {
+		return failure("Nothing to run, the spec sets neither script nor commands", -1, nil)
+	}
+
+	timeout := d.Timeout
+	if spec.Timeout != "" {
+		timeout, err = time.ParseDuration(spec.Timeout)
+		if err != nil || timeout < 0 {
+			return failure(fmt.Sprintf("Invalid timeout %q", spec.Timeout), -1, nil)
+		}
+	}
+
+	dir, cleanup, err := d.workDir(spec.WorkDir)
+	if err != nil {
+		return failure(fmt.Sprintf("Failed to prepare working directory: %v", err), -1, nil)
+	}
+	defer cleanup()
+
+	ctx := log.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	env := append(os.Environ(),
+		"CONVEYOR_RUN_ID="+runID,
+		"CONVEYOR_EVENT="+event,
+		"CONVEYOR_RESOURCE="+resource.Name,
+		"CONVEYOR_RESOURCE_TYPE="+resource.Resource,
+		"CONVEYOR_PIPELINE="+resource.Pipeline,
+		"CONVEYOR_STEP="+log.Labels["step"],
+	)
+	keys := make([]string, 0, len(spec.Env))
+	for key := range spec.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+spec.Env[key])
+	}
+
+	shell := spec.Shell
+	if len(shell) == 0 {
+		shell = DefaultShell
+	}
+	scripts := spec.Commands
+	if spec.Script != "" {
+		scripts = append([]string{spec.Script}, scripts...)
+	}
+
+	tail := newTail(d.tailLines())
+	for _, script := range scripts {
+		log.Info(map[string]string{"stream": "command"}, "$ "+firstLine(script))
+
+		stdout := log.WithLabels(map[string]string{"stream": "stdout"})
+		stderr := log.WithLabels(map[string]string{"stream": "stderr", "level": types.LogLevelWarn})
+
+		cmd := exec.CommandContext(ctx, shell[0], append(shell[1:], script)...)
+		cmd.Dir = dir
+		cmd.Env = env
+		cmd.Stdout = io.MultiWriter(stdout, tail)
+		cmd.Stderr = io.MultiWriter(stderr, tail)
+		cmd.WaitDelay = waitDelay
+		killProcessGroup(cmd)
+
+		err := cmd.Run()
+		// Log the last lines without a newline
+		stdout.Flush()
+		stderr.Flush()
+
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			return failure(fmt.Sprintf("Timed out after %s running %q", timeout, firstLine(script)), -1, tail.lines())
+		case ctx.Err() != nil:
+			return failure(fmt.Sprintf("Cancelled while running %q", firstLine(script)), -1, tail.lines())
+		case err != nil:
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return failure(fmt.Sprintf("%q exited with code %d", firstLine(script), exitErr.ExitCode()), exitErr.ExitCode(), tail.lines())
+			}
+			return failure(fmt.Sprintf("Failed to run %q: %v", firstLine(script), err), -1, tail.lines())
+		}
+	}
+
+	return types.DriverResult{
+		Success: true,
+		Message: fmt.Sprintf("%d command(s) completed successfully", len(scripts)),
+		Data:    Result{ExitCode: 0, Output: tail.lines()},
+	}
+}
+
+// Result is the data of the driver result.
+type Result struct {
+	// ExitCode is the exit code of the last command, or -1 if it did not exit by itself.
+	ExitCode int `json:"exit_code"`
+	// Output holds the last lines of output.
+	Output []string `json:"output"`
+}
+
+func failure(message string, exitCode int, output []string) types.DriverResult {
+	if len(output) > 0 {
+		message += ":\n" + strings.Join(output, "\n")
+	}
+	return types.DriverResult{
+		Success: false,
+		Message: message,
+		Data:    Result{ExitCode: exitCode, Output: output},
+	}
+}
+
+// parseSpec reads the spec of a resource, merging the spec of the step into it.
+func parseSpec(raw interface{}, step string) (Spec, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return Spec{}, err
+	}
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return Spec{}, err
+	}
+	if stepSpec, ok := spec.Steps[step]; ok && step != "" {
+		spec = spec.merge(stepSpec)
+	}
+	return spec, nil
+}
+
+// workDir returns the directory commands run in and a function removing it if it is temporary.
+func (d *Driver) workDir(dir string) (string, func(), error) {
+	if filepath.IsAbs(dir) {
+		return dir, func() {}, nil
+	}
+
+	base := d.WorkDir
+	cleanup := func() {}
+	if base == "" {
+		temp, err := os.MkdirTemp("", "conveyor-exec-")
+		if err != nil {
+			return "", nil, err
+		}
+		base = temp
+		cleanup = func() { os.RemoveAll(temp) }
+	}
+
+	dir = filepath.Join(base, dir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
+
+func (d *Driver) tailLines() int {
+	if d.TailLines > 0 {
+		return d.TailLines
+	}
+	return DefaultTailLines
+}
+
+func firstLine(script string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(script), "\n")
+	return line
+}
+
+// tail keeps the last lines of the output written to it.
+type tail struct {
+	mu   sync.Mutex
+	max  int
+	data []byte
+}
+
+func newTail(max int) *tail {
+	return &tail{max: max}
+}
+
+func (t *tail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.data = append(t.data, p...)
+	// Drop what comes before the last max lines, the last of which may not be complete yet
+	lines := 0
+	for i := len(t.data) - 2; i >= 0; i-- {
+		if t.data[i] != '\n' {
+			continue
+		}
+		if lines++; lines == t.max {
+			t.data = append([]byte(nil), t.data[i+1:]...)
+			break
+		}
+	}
+	return len(p), nil
+}
+
+func (t *tail) lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	output := strings.TrimSuffix(string(t.data), "\n")
+	if output == "" {
+		return nil
+	}
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
@@ -0,0 +1,93 @@
+package execdriver_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	execdriver "github.com/open-ug/conveyor/cmd/exec-driver"
+	driverruntime "github.com/open-ug/conveyor/pkg/driver-runtime"
+	"github.com/open-ug/conveyor/pkg/driver-runtime/drivertest"
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriver_Reconcile(t *testing.T) {
+	h := drivertest.New(t)
+	workDir := t.TempDir()
+	exec := &execdriver.Driver{WorkDir: workDir, TailLines: 2}
+	driver := &driverruntime.Driver{Name: "exec", Resources: []string{"job"}, Reconcile: exec.Reconcile}
+
+	t.Run("streams output", func(t *testing.T) {
+		resource := types.Resource{Name: "build", Resource: "job", Spec: map[string]interface{}{
+			"script":   "echo one\necho two >&2\nprintf three",
+			"commands": []string{"echo $GREETING $CONVEYOR_RESOURCE > out.txt"},
+			"workdir":  "src",
+			"env":      map[string]string{"GREETING": "hello"},
+		}}
+
+		result := h.Deliver(driver, types.EventCreate, resource)
+
+		require.True(t, result.DriverResult.Success, result.DriverResult.Message)
+		assert.Equal(t, []string{"$ echo one", "one", "two", "three", "$ echo $GREETING $CONVEYOR_RESOURCE > out.txt"}, result.LogMessages())
+		assert.Equal(t, types.LogLevelWarn, result.Logs[2].Level)
+		assert.Equal(t, "stderr", result.Logs[2].Labels["stream"])
+
+		out, err := os.ReadFile(filepath.Join(workDir, "src", "out.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello build\n", string(out))
+	})
+
+	t.Run("reports the exit code and output tail", func(t *testing.T) {
+		resource := types.Resource{Name: "fail", Resource: "job", Spec: map[string]interface{}{
+			"script":   "echo a\necho b\necho c\nexit 3",
+			"commands": []string{"echo never"},
+		}}
+
+		result := h.Deliver(driver, types.EventCreate, resource)
+
+		assert.False(t, result.DriverResult.Success)
+		assert.Equal(t, "\"echo a\" exited with code 3:\nb\nc", result.DriverResult.Message)
+		assert.Equal(t, map[string]interface{}{"exit_code": float64(3), "output": []interface{}{"b", "c"}}, result.DriverResult.Data)
+		assert.NotContains(t, result.LogMessages(), "never")
+	})
+
+	t.Run("runs the spec of the step", func(t *testing.T) {
+		resource := types.Resource{Name: "steps", Resource: "job", Spec: map[string]interface{}{
+			"script": "echo default",
+			"steps": map[string]interface{}{
+				"test": map[string]interface{}{"commands": []string{"echo $CONVEYOR_STEP"}},
+			},
+		}}
+
+		result := h.Deliver(driver, types.EventCreate, resource, drivertest.WithStep("test"))
+
+		assert.True(t, result.DriverResult.Success)
+		assert.Equal(t, []string{"$ echo $CONVEYOR_STEP", "test"}, result.LogMessages())
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		resource := types.Resource{Name: "slow", Resource: "job", Spec: map[string]interface{}{
+			"script":  "sleep 10",
+			"timeout": "200ms",
+		}}
+
+		start := time.Now()
+		result := h.Deliver(driver, types.EventCreate, resource)
+
+		assert.False(t, result.DriverResult.Success)
+		assert.Equal(t, "Timed out after 200ms running \"sleep 10\"", result.DriverResult.Message)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("rejects specs without commands", func(t *testing.T) {
+		resource := types.Resource{Name: "empty", Resource: "job", Spec: map[string]interface{}{"workdir": "src"}}
+
+		result := h.Deliver(driver, types.EventCreate, resource)
+
+		assert.False(t, result.DriverResult.Success)
+		assert.Contains(t, result.DriverResult.Message, "Nothing to run")
+	})
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package execdriver
+
+import "os/exec"
+
+// killProcessGroup is a no-op where process groups are not available, only the shell is killed.
+func killProcessGroup(cmd *exec.Cmd) {}
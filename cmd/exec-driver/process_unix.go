@@ -0,0 +1,17 @@
+//go:build unix
+
+package execdriver
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup makes cancelling cmd kill the processes the shell started as well,
+// so they do not keep running or hold on to its output.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -3,6 +3,7 @@ package sampledriver
 import (
 	//"encoding/json"
 
+	"context"
 	"fmt"
 	"log"
 	"time"
@@ -81,7 +82,10 @@ func Listen(
 		return
 	}
 
-	err = driverManager.Run()
+	ctx, stop := runtime.SignalContext(context.Background())
+	defer stop()
+
+	err = driverManager.Run(ctx)
 	if err != nil {
 		fmt.Println("Error running driver manager: ", err)
 	}
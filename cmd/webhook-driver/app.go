@@ -0,0 +1,50 @@
+package webhookdriver
+
+import (
+	"context"
+	"fmt"
+
+	runtime "github.com/open-ug/conveyor/pkg/driver-runtime"
+)
+
+// Options configure the webhook bridge started by Listen.
+type Options struct {
+	// Name is the name the driver is registered under.
+	Name string
+	// Resources are the resource types the driver delivers.
+	Resources []string
+	// Events are the event patterns the driver delivers.
+	Events []string
+	// Labels describe the host, so steps can select it.
+	Labels map[string]string
+	// Bridge configures the webhook endpoint.
+	Bridge Bridge
+}
+
+// Listen runs the webhook bridge until it receives SIGINT or SIGTERM.
+func Listen(client *runtime.Client, options Options) error {
+	bridge := options.Bridge
+	if client.Options.AuthEnabled && len(bridge.Secret) == 0 && !bridge.InsecureCallbacks {
+		// Callbacks skip the authentication of the API server, they must be signed instead
+		return fmt.Errorf("a webhook secret is required when authentication is enabled")
+	}
+	if bridge.CallbackURL == "" {
+		bridge.CallbackURL = client.APIURL
+	}
+	driver := &runtime.Driver{
+		Reconcile: bridge.Reconcile,
+		Name:      options.Name,
+		Resources: options.Resources,
+	}
+
+	driverManager, err := client.NewDriverManager(driver, options.Events)
+	if err != nil {
+		return fmt.Errorf("error creating driver manager: %w", err)
+	}
+	driverManager.Labels = options.Labels
+
+	ctx, stop := runtime.SignalContext(context.Background())
+	defer stop()
+
+	return driverManager.Run(ctx)
+}
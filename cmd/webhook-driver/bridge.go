@@ -0,0 +1,245 @@
+package webhookdriver
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	logger "github.com/open-ug/conveyor/pkg/driver-runtime/log"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+const (
+	// DefaultTimeout bounds webhook requests when the bridge sets no timeout.
+	DefaultTimeout = 30 * time.Second
+	// DefaultCallbackTimeout is how long the bridge waits for the result of an asynchronous delivery.
+	DefaultCallbackTimeout = time.Hour
+	// maxSignatureAge is how old the timestamp of a signed callback may be, to limit replays.
+	maxSignatureAge = 5 * time.Minute
+	// maxResponseSize bounds the response of the webhook endpoint.
+	maxResponseSize = 1 << 20
+)
+
+/*
+Bridge is a driver that delivers resource events to an HTTP endpoint, so drivers can be written
+in any language that can serve HTTP. Each event is POSTed as a DriverMessage. The endpoint either
+answers with the DriverResult, or with 202 Accepted and posts the result to the callback URL of
+the delivery later. Logs can be posted to the callback URL as well.
+*/
+type Bridge struct {
+	// URL is the endpoint events are delivered to.
+	URL string
+	// Secret signs requests and verifies callbacks. Without a secret, requests are not signed
+	// and callbacks are rejected, unless InsecureCallbacks is set.
+	Secret []byte
+	// InsecureCallbacks accepts unsigned callbacks when there is no Secret, authorized only by their unguessable URL.
+	InsecureCallbacks bool
+	// CallbackURL is the base URL of the API server the endpoint reaches, e.g. `https://conveyor.example.com`.
+	CallbackURL string
+	// Timeout bounds each webhook request. Defaults to DefaultTimeout.
+	Timeout time.Duration
+	// CallbackTimeout bounds how long an asynchronous delivery may take. Defaults to DefaultCallbackTimeout.
+	CallbackTimeout time.Duration
+	// HTTPClient sends the webhook requests. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Reconcile delivers an event to the endpoint and returns the result of the endpoint.
+func (b *Bridge) Reconcile(payload string, event string, runID string, log *logger.DriverLogger) types.DriverResult {
+	body, err := json.Marshal(types.DriverMessage{
+		Event:   event,
+		RunID:   runID,
+		ID:      log.Labels["id"],
+		Payload: payload,
+		Step:    log.Labels["step"],
+	})
+	if err != nil {
+		return types.DriverResult{Success: false, Message: fmt.Sprintf("Failed to marshal driver message: %v", err)}
+	}
+
+	// Callbacks are relayed by the API server over NATS, listen before the endpoint can post them
+	callbackID := uuid.New().String()
+	results := make(chan types.DriverResult, 1)
+	sub, err := log.NatsCon.Subscribe(types.WebhookCallbackSubject(callbackID, "*"), func(msg *nats.Msg) {
+		b.handleCallback(msg, log, results)
+	})
+	if err != nil {
+		return types.DriverResult{Success: false, Retryable: true, Message: fmt.Sprintf("Failed to listen for callbacks: %v", err)}
+	}
+	defer sub.Unsubscribe()
+	if err := log.NatsCon.Flush(); err != nil {
+		return types.DriverResult{Success: false, Retryable: true, Message: fmt.Sprintf("Failed to listen for callbacks: %v", err)}
+	}
+
+	result, accepted := b.deliver(log.Context(), body, event, runID, callbackID)
+	if !accepted {
+		return result
+	}
+
+	// The endpoint answered 202 Accepted and posts the result to the callback URL
+	callbackTimeout := b.CallbackTimeout
+	if callbackTimeout <= 0 {
+		callbackTimeout = DefaultCallbackTimeout
+	}
+	timer := time.NewTimer(callbackTimeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-results:
+		return result
+	case <-timer.C:
+		return types.DriverResult{Success: false, Message: fmt.Sprintf("Webhook did not post a result within %s", callbackTimeout)}
+	case <-log.Context().Done():
+		return types.DriverResult{Success: false, Message: "Cancelled while waiting for the webhook result"}
+	}
+}
+
+// deliver posts the driver message to the endpoint. It reports whether the endpoint accepted the message to post the result later.
+func (b *Bridge) deliver(ctx context.Context, body []byte, event string, runID string, callbackID string) (types.DriverResult, bool) {
+	timeout := b.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.URL, bytes.NewReader(body))
+	if err != nil {
+		return types.DriverResult{Success: false, Message: fmt.Sprintf("Invalid webhook URL: %v", err)}, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Conveyor-Event", event)
+	req.Header.Set("X-Conveyor-Run-ID", runID)
+	req.Header.Set(types.WebhookCallbackHeader, strings.TrimRight(b.CallbackURL, "/")+"/webhooks/callbacks/"+callbackID)
+	if len(b.Secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(types.WebhookTimestampHeader, timestamp)
+		req.Header.Set(types.WebhookSignatureHeader, types.SignWebhook(b.Secret, timestamp, body))
+	}
+
+	client := b.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The endpoint may be restarting, try again later
+		return types.DriverResult{Success: false, Retryable: true, Message: fmt.Sprintf("Webhook request failed: %v", err)}, false
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return types.DriverResult{Success: false, Retryable: true, Message: fmt.Sprintf("Failed to read webhook response: %v", err)}, false
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusAccepted:
+		return types.DriverResult{}, true
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		var result types.DriverResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			return types.DriverResult{Success: false, Message: fmt.Sprintf("Invalid webhook result: %v", err)}, false
+		}
+		return result, false
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return types.DriverResult{Success: false, Retryable: true, Message: fmt.Sprintf("Webhook returned %d: %s", resp.StatusCode, string(data))}, false
+	default:
+		return types.DriverResult{Success: false, Message: fmt.Sprintf("Webhook returned %d: %s", resp.StatusCode, string(data))}, false
+	}
+}
+
+// handleCallback processes a callback relayed by the API server and replies with the status the API server answers with.
+func (b *Bridge) handleCallback(msg *nats.Msg, log *logger.DriverLogger, results chan<- types.DriverResult) {
+	reply := func(status int, message string) {
+		data, _ := json.Marshal(types.WebhookCallbackReply{Status: status, Error: message})
+		msg.Respond(data)
+	}
+
+	if err := b.verify(msg); err != nil {
+		reply(http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	switch msg.Subject[strings.LastIndexByte(msg.Subject, '.')+1:] {
+	case "result":
+		var result types.DriverResult
+		if err := json.Unmarshal(msg.Data, &result); err != nil {
+			reply(http.StatusBadRequest, fmt.Sprintf("invalid result: %v", err))
+			return
+		}
+		select {
+		case results <- result:
+			reply(http.StatusAccepted, "")
+		default:
+			reply(http.StatusConflict, "a result was already posted")
+		}
+	case "logs":
+		decoder := json.NewDecoder(bytes.NewReader(msg.Data))
+		var entries []types.Log
+		for {
+			var entry types.Log
+			err := decoder.Decode(&entry)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				reply(http.StatusBadRequest, fmt.Sprintf("invalid logs: %v", err))
+				return
+			}
+			entries = append(entries, entry)
+		}
+		for _, entry := range entries {
+			labels := map[string]string{}
+			for k, v := range entry.Labels {
+				labels[k] = v
+			}
+			if entry.Level != "" {
+				labels["level"] = entry.Level
+			}
+			if err := log.Log(labels, entry.Message); err != nil {
+				reply(http.StatusInternalServerError, fmt.Sprintf("failed to write logs: %v", err))
+				return
+			}
+		}
+		reply(http.StatusAccepted, "")
+	default:
+		reply(http.StatusNotFound, "unknown callback")
+	}
+}
+
+// verify checks the signature of a callback. Without a secret, callbacks are only accepted when they are allowed to be insecure.
+func (b *Bridge) verify(msg *nats.Msg) error {
+	if len(b.Secret) == 0 {
+		if b.InsecureCallbacks {
+			return nil
+		}
+		return errors.New("callbacks require a webhook secret")
+	}
+
+	timestamp := msg.Header.Get(types.WebhookTimestampHeader)
+	signature := msg.Header.Get(types.WebhookSignatureHeader)
+	if timestamp == "" || signature == "" {
+		return errors.New("missing signature")
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid timestamp")
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > maxSignatureAge || age < -maxSignatureAge {
+		return errors.New("signature expired")
+	}
+	if !hmac.Equal([]byte(signature), []byte(types.SignWebhook(b.Secret, timestamp, msg.Data))) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package webhookdriver_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nats-io/nats.go"
+	webhookdriver "github.com/open-ug/conveyor/cmd/webhook-driver"
+	"github.com/open-ug/conveyor/internal/routes"
+	driverruntime "github.com/open-ug/conveyor/pkg/driver-runtime"
+	"github.com/open-ug/conveyor/pkg/driver-runtime/drivertest"
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var secret = []byte("s3cret")
+
+// startCallbackAPI serves the webhook callback routes of the API server on the NATS server of the harness.
+func startCallbackAPI(t *testing.T, h *drivertest.Harness) string {
+	nc, err := nats.Connect(h.Client.NatsURL)
+	require.NoError(t, err)
+	t.Cleanup(nc.Close)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	routes.WebhookRoutes(app, nc)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(listener)
+	t.Cleanup(func() { app.Shutdown() })
+	return "http://" + listener.Addr().String()
+}
+
+// postCallback posts a signed callback to url.
+func postCallback(t *testing.T, url string, body []byte, key []byte) int {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(types.WebhookTimestampHeader, timestamp)
+	req.Header.Set(types.WebhookSignatureHeader, types.SignWebhook(key, timestamp, body))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestBridge_Reconcile(t *testing.T) {
+	h := drivertest.New(t)
+	apiURL := startCallbackAPI(t, h)
+	resource := types.Resource{Name: "app", Resource: "deployment", Spec: map[string]interface{}{"image": "nginx"}}
+
+	newDriver := func(handler http.HandlerFunc) *driverruntime.Driver {
+		endpoint := httptest.NewServer(handler)
+		t.Cleanup(endpoint.Close)
+		bridge := &webhookdriver.Bridge{URL: endpoint.URL, Secret: secret, CallbackURL: apiURL, CallbackTimeout: 10 * time.Second}
+		return &driverruntime.Driver{Name: "deployer", Resources: []string{"deployment"}, Reconcile: bridge.Reconcile}
+	}
+
+	t.Run("synchronous result", func(t *testing.T) {
+		driver := newDriver(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			if r.Header.Get(types.WebhookSignatureHeader) != types.SignWebhook(secret, r.Header.Get(types.WebhookTimestampHeader), body) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var message types.DriverMessage
+			json.Unmarshal(body, &message)
+			json.NewEncoder(w).Encode(types.DriverResult{Success: true, Message: message.Event + " " + message.RunID + " " + message.Step})
+		})
+
+		result := h.Deliver(driver, types.EventCreate, resource, drivertest.WithRunID("run-sync"), drivertest.WithStep("deploy"))
+		assert.Equal(t, types.DriverResult{Success: true, Message: "create run-sync deploy"}, result.DriverResult)
+	})
+
+	t.Run("asynchronous result and logs", func(t *testing.T) {
+		statuses := make(chan int, 3)
+		driver := newDriver(func(w http.ResponseWriter, r *http.Request) {
+			callback := r.Header.Get(types.WebhookCallbackHeader)
+			w.WriteHeader(http.StatusAccepted)
+			go func() {
+				statuses <- postCallback(t, callback+"/result", []byte(`{"success":true}`), []byte("wrong"))
+				statuses <- postCallback(t, callback+"/logs", []byte("{\"message\":\"rolling out\",\"labels\":{\"replicas\":\"3\"}}\n{\"message\":\"rolled out\",\"level\":\"warn\"}\n"), secret)
+				statuses <- postCallback(t, callback+"/result", []byte(`{"success":true,"message":"deployed"}`), secret)
+			}()
+		})
+
+		result := h.Deliver(driver, types.EventCreate, resource, drivertest.WithRunID("run-async"))
+
+		assert.Equal(t, types.DriverResult{Success: true, Message: "deployed"}, result.DriverResult)
+		assert.Equal(t, []int{http.StatusUnauthorized, http.StatusAccepted, http.StatusAccepted}, []int{<-statuses, <-statuses, <-statuses})
+		assert.Equal(t, []string{"rolling out", "rolled out"}, result.LogMessages())
+		assert.Equal(t, "3", result.Logs[0].Labels["replicas"])
+		assert.Equal(t, types.LogLevelWarn, result.Logs[1].Level)
+
+		// Callbacks no delivery is waiting for are rejected
+		assert.Equal(t, http.StatusNotFound, postCallback(t, apiURL+"/webhooks/callbacks/unknown/result", []byte(`{}`), secret))
+	})
+
+	t.Run("unsigned callbacks", func(t *testing.T) {
+		for _, insecure := range []bool{false, true} {
+			statuses := make(chan int, 1)
+			endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				callback := r.Header.Get(types.WebhookCallbackHeader)
+				w.WriteHeader(http.StatusAccepted)
+				go func() {
+					resp, err := http.Post(callback+"/result", "application/json", bytes.NewReader([]byte(`{"success":true}`)))
+					if err != nil {
+						statuses <- 0
+						return
+					}
+					resp.Body.Close()
+					statuses <- resp.StatusCode
+				}()
+			}))
+			t.Cleanup(endpoint.Close)
+			bridge := &webhookdriver.Bridge{URL: endpoint.URL, CallbackURL: apiURL, CallbackTimeout: time.Second, InsecureCallbacks: insecure}
+			driver := &driverruntime.Driver{Name: "deployer", Resources: []string{"deployment"}, Reconcile: bridge.Reconcile}
+
+			result := h.Deliver(driver, types.EventCreate, resource)
+			if insecure {
+				assert.Equal(t, http.StatusAccepted, <-statuses)
+				assert.True(t, result.DriverResult.Success)
+			} else {
+				// Without a secret, callbacks are only accepted when explicitly allowed
+				assert.Equal(t, http.StatusUnauthorized, <-statuses)
+				assert.False(t, result.DriverResult.Success)
+			}
+		}
+	})
+
+	t.Run("endpoint errors", func(t *testing.T) {
+		driver := newDriver(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unknown image", http.StatusUnprocessableEntity)
+		})
+
+		result := h.Deliver(driver, types.EventCreate, resource)
+		assert.False(t, result.DriverResult.Success)
+		assert.Contains(t, result.DriverResult.Message, "422: unknown image")
+
+		driver = newDriver(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+
+		result = h.Deliver(driver, types.EventCreate, resource, drivertest.WithMaxRetries(1))
+		assert.False(t, result.DriverResult.Success)
+		assert.Contains(t, result.DriverResult.Message, "503")
+		// Unavailable endpoints are retried
+		assert.Len(t, result.Deliveries, 2)
+	})
+}
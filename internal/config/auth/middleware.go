@@ -172,6 +172,8 @@ func JWTCertMiddleware(rootPool *x509.CertPool) fiber.Handler {
 			"/health",
 			"/swagger",
 			"/metrics",
+			// Webhook drivers cannot obtain tokens, callbacks are authorized by their ID and signature
+			"/webhooks/callbacks",
 		}
 		// Skip auth for certain paths
 		requestPath := c.Path()
@@ -214,6 +216,16 @@ func JWTCertMiddleware(rootPool *x509.CertPool) fiber.Handler {
 		// Attach claims to context for handlers
 		c.Locals("claims", claims)
 		c.Locals("token", token)
+		// The client certificate identifies who made the request, e.g. the author of resource versions
+		if certs, err := parseX5C(token.Header["x5c"]); err == nil {
+			c.Locals("subject", certs[0].Subject.CommonName)
+		}
 		return c.Next()
 	}
 }
+
+// Subject returns the common name of the client certificate of an authenticated request, or "" without authentication.
+func Subject(c *fiber.Ctx) string {
+	subject, _ := c.Locals("subject").(string)
+	return subject
+}
@@ -3,7 +3,9 @@ package engine
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"strconv"
 
 	"github.com/dgraph-io/badger/v4"
 	"github.com/nats-io/nats.go/jetstream"
@@ -18,6 +20,7 @@ type EngineContext struct {
 	PipelineModel *models.PipelineModel
 	ResourceModel *models.ResourceModel
 	LogModel      *models.LogModel
+	RunModel      *models.RunModel
 }
 
 type PipelineEvent struct {
@@ -34,6 +37,7 @@ func NewEngineContext(cli *clientv3.Client, logmodel *models.LogModel, natsConte
 		PipelineModel: models.NewPipelineModel(cli, db),
 		ResourceModel: models.NewResourceModel(cli, db),
 		LogModel:      logmodel,
+		RunModel:      models.NewRunModel(cli),
 	}
 }
 
@@ -77,6 +81,30 @@ func (ec *EngineContext) Start() error {
 	}
 	defer lc.Stop()
 
+	// Create driver progress consumer
+	progressconsumer, err := ec.NatsContext.JetStream.CreateOrUpdateConsumer(context.Background(), "runs-engine", jetstream.ConsumerConfig{
+		Name:          "runs-engine",
+		FilterSubject: "runs.progress.>",
+		AckPolicy:     jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		log.Println("Error creating consumer: ", err)
+		return err
+	}
+
+	log.Println("Progress consumer started...")
+	pc, err := progressconsumer.Consume(ec.consumeProgressEvents)
+	if err != nil {
+		log.Println("Error consuming progress events: ", err)
+		return err
+	}
+	defer pc.Stop()
+
+	// Deliver resync events to drivers that asked for them
+	go ec.NewResyncer().Run(context.Background())
+	// Delete the dependents of deleted resources
+	go ec.NewGarbageCollector().Run(context.Background())
+
 	select {}
 }
 
@@ -93,6 +121,15 @@ func (ec *EngineContext) consumePipelineEvents(msg jetstream.Msg) {
 		return
 	}
 
+	if subject == "pipelines.driver.result" {
+		if event.DriverResultEvent.Event == types.EventResync {
+			// Resyncs happen outside of runs and pipelines
+			return
+		}
+		// Record the result in the run, whether or not the run belongs to a pipeline
+		ec.recordDriverResult(event)
+	}
+
 	if event.Resource.Pipeline == "" {
 		// No pipeline associated, ignore
 		return
@@ -109,6 +146,11 @@ func (ec *EngineContext) consumePipelineEvents(msg jetstream.Msg) {
 
 	if subject == "pipelines.driver.result" {
 
+		if event.DriverResultEvent.Requeued() {
+			// The step is not done yet, the driver reconciles the event again later
+			return
+		}
+
 		// Process driver result and move to next step
 		ec.handleProcessDriverResult(event, pipeline)
 
@@ -127,10 +169,18 @@ func (ec *EngineContext) consumePipelineEvents(msg jetstream.Msg) {
 			ID:      mID,
 		}
 
+		ec.startRun(event, pipeline)
+
 		// Publish to the first step's driver
 		if len(pipeline.Steps) > 0 {
 			firstStep := pipeline.Steps[0]
-			subject := "drivers." + firstStep.Driver + ".resources." + event.Resource.Resource
+			driverMessage.Step = firstStep.ID
+			subject, err := ec.stepSubject(firstStep, event.Resource.Resource)
+			if err != nil {
+				log.Println("Error routing step to driver: ", err)
+				ec.failStep(event.RunID, firstStep.Driver, err.Error())
+				return
+			}
 			err = ec.publishEvent(subject, driverMessage)
 			if err != nil {
 				log.Println("Error publishing event to driver: ", err)
@@ -160,20 +210,31 @@ func (ec *EngineContext) publishEvent(subject string, message types.DriverMessag
 
 func (ec *EngineContext) handleProcessDriverResult(event PipelineEvent, pipeline *types.Pipeline) {
 
-	// save driver result to resource metadata
-	err := ec.ResourceModel.SaveDriverResult(event.Resource.Name, event.Resource.Resource, event.DriverResultEvent.Driver, event.DriverResultEvent)
-	if err != nil {
-		log.Println("Error saving driver result: ", err)
-		return
+	// save driver result to the resource status, observed at the version of the resource the driver reconciled
+	result := types.DriverResult{
+		Success:      event.DriverResultEvent.Success,
+		Message:      event.DriverResultEvent.Message,
+		Data:         event.DriverResultEvent.Data,
+		RequeueAfter: event.DriverResultEvent.RequeueAfter,
 	}
-
-	// update resource to include latest driver result
-	updatedResource, err := ec.ResourceModel.FindOne(event.Resource.Name, event.Resource.Resource)
-	if err != nil {
-		log.Println("Error retrieving updated resource: ", err)
+	generation, _ := strconv.ParseInt(event.Resource.Metadata["version"], 10, 64)
+	if event.DriverResultEvent.Skipped {
+		// The driver did not reconcile the event, its last result still describes the resource
+	} else if err := ec.ResourceModel.SaveDriverResult(event.Resource.Name, event.Resource.Resource, event.DriverResultEvent.Driver, result, generation); errors.Is(err, models.ErrResourceNotFound) {
+		// A deleted resource is purged once its finalizers are removed, the pipeline goes on with the resource of the event
+		log.Println("Resource was deleted, not saving driver result: ", err)
+	} else if err != nil {
+		log.Println("Error saving driver result: ", err)
 		return
+	} else {
+		// update resource to include latest driver result
+		updatedResource, err := ec.ResourceModel.FindOne(event.Resource.Name, event.Resource.Resource)
+		if err != nil {
+			log.Println("Error retrieving updated resource: ", err)
+			return
+		}
+		event.Resource = updatedResource
 	}
-	event.Resource = updatedResource
 
 	// Find the current step based on the driver name
 	var currentStepIndex int = -1
@@ -203,16 +264,28 @@ func (ec *EngineContext) handleProcessDriverResult(event PipelineEvent, pipeline
 				return
 			}
 
-			// Driver message for the next step
+			// Driver message for the next step, it keeps the event that started the run
+			trigger := event.DriverResultEvent.Trigger
+			if trigger == "" {
+				trigger = event.DriverResultEvent.Event
+			}
 			driverMessage := types.DriverMessage{
-				Event:   "process",
+				Event:   types.EventProcess,
 				RunID:   event.RunID,
 				Payload: string(resourceJson),
 				ID:      mID,
+				Step:    nextStep.ID,
+				Trigger: trigger,
 			}
 
-			subject := "drivers." + nextStep.Driver + ".resources." + event.Resource.Resource
+			subject, err := ec.stepSubject(nextStep, event.Resource.Resource)
+			if err != nil {
+				log.Println("Error routing step to driver: ", err)
+				ec.failStep(event.RunID, nextStep.Driver, err.Error())
+				return
+			}
 			ec.publishEvent(subject, driverMessage)
+			ec.startStep(event.RunID, nextStep.Driver)
 		} else {
 			// Pipeline completed successfully
 		}
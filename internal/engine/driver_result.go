@@ -3,6 +3,7 @@ package engine
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go/jetstream"
@@ -15,6 +16,23 @@ type DriverResultEvent struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
 	Driver  string      `json:"driver"`
+	// RequeueAfter is set when the event is reconciled again after the given duration,
+	// in which case the result does not end the step.
+	RequeueAfter time.Duration `json:"requeue_after,omitempty"`
+	// Attempt is the number of times the driver reconciled the event, counting this one.
+	Attempt int `json:"attempt,omitempty"`
+	// Event is the event the driver reconciled.
+	Event string `json:"event,omitempty"`
+	// Trigger is the event that started the pipeline run, when it differs from Event.
+	Trigger string `json:"trigger,omitempty"`
+	// Skipped is set when the driver does not handle the event of a pipeline step,
+	// the step ends without the driver reconciling it.
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+// Requeued reports whether the step continues with another reconcile of the event.
+func (dre *DriverResultEvent) Requeued() bool {
+	return dre.RequeueAfter > 0
 }
 
 func (dre *DriverResultEvent) PublishEvent(
@@ -42,59 +60,70 @@ func (dre *DriverResultEvent) PublishEvent(
 
 }
 
+// PublishResourceEvent publishes a resource event, starting a run of the pipeline of the resource if it has one,
+// and otherwise delivering it to the drivers of the resource. It returns the ID of the run.
 func PublishResourceEvent(
 	event string,
 	resource types.Resource,
 	js jetstream.JetStream) (string, error) {
 
-	run_id := uuid.New().String()
 	if resource.Pipeline == "" {
+		return PublishDriverEvent(event, resource, js)
+	}
 
-		mID, err := utils.GenerateRandomID()
-		if err != nil {
-			return "", err
-		}
-		resourceData, err := json.Marshal(resource)
-		if err != nil {
-			return "", err
-		}
-		driverMsg := types.DriverMessage{
-			ID:      mID,
-			Payload: string(resourceData),
-			Event:   "create",
-			RunID:   run_id,
-		}
-
-		jsonMsg, merr := json.Marshal(driverMsg)
-		if merr != nil {
-			return "", merr
-		}
-
-		// Publish message to jetstream
-		subjectName := "resources." + resource.Resource
-		_, err = js.PublishAsync(subjectName, jsonMsg)
-
-		if err != nil {
-			return "", err
-		}
-		return run_id, nil
-	} else {
-		resourceEvent := PipelineEvent{
-			Event:    event,
-			RunID:    run_id,
-			Resource: resource,
-		}
-
-		eventJson, err := json.Marshal(resourceEvent)
-		if err != nil {
-			return "", err
-		}
-
-		_, err = js.PublishAsync("pipelines.pipeline.init", eventJson)
-		if err != nil {
-			return "", err
-		}
+	run_id := uuid.New().String()
+	resourceEvent := PipelineEvent{
+		Event:    event,
+		RunID:    run_id,
+		Resource: resource,
+	}
+
+	eventJson, err := json.Marshal(resourceEvent)
+	if err != nil {
+		return "", err
 	}
 
+	_, err = js.PublishAsync("pipelines.pipeline.init", eventJson)
+	if err != nil {
+		return "", err
+	}
+
+	return run_id, nil
+}
+
+// PublishDriverEvent delivers a resource event to the drivers of the resource, without starting a run of its pipeline.
+// It returns the ID of the run the results of the drivers are recorded in.
+func PublishDriverEvent(
+	event string,
+	resource types.Resource,
+	js jetstream.JetStream) (string, error) {
+
+	run_id := uuid.New().String()
+	mID, err := utils.GenerateRandomID()
+	if err != nil {
+		return "", err
+	}
+	resourceData, err := json.Marshal(resource)
+	if err != nil {
+		return "", err
+	}
+	driverMsg := types.DriverMessage{
+		ID:      mID,
+		Payload: string(resourceData),
+		Event:   event,
+		RunID:   run_id,
+	}
+
+	jsonMsg, merr := json.Marshal(driverMsg)
+	if merr != nil {
+		return "", merr
+	}
+
+	// Publish message to jetstream
+	subjectName := "resources." + resource.Resource
+	_, err = js.PublishAsync(subjectName, jsonMsg)
+	if err != nil {
+		return "", err
+	}
 	return run_id, nil
 }
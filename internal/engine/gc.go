@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/open-ug/conveyor/internal/models"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+// gcInterval is how often the garbage collector looks for dependents to delete.
+const gcInterval = 10 * time.Second
+
+/*
+GarbageCollector deletes the dependents of deleted resources, the resources whose OwnerReferences
+name them. A dependent is deleted once none of its owners exist anymore, or as soon as one of its
+owners is deleted with the foreground policy. Owners deleted with the foreground policy are released,
+by removing their FinalizerForegroundDeletion finalizer, once their dependents are gone.
+It only visits the owners the store marked as pending, and finds their dependents in the owner index.
+*/
+type GarbageCollector struct {
+	// pending lists the owners to visit, and the revision they were listed at
+	pending func() ([]types.OwnerReference, int64, error)
+	// forget removes an owner from the pending owners, unless it was marked again after the revision
+	forget func(owner types.OwnerReference, revision int64) error
+	// get reads a resource, and reports false when it does not exist
+	get func(resourceType string, name string) (types.Resource, bool, error)
+	// dependents reads the resources that name a resource in their owner references
+	dependents func(resourceType string, name string) ([]types.Resource, error)
+	// delete deletes a dependent with a deletion propagation policy
+	delete func(resource types.Resource, policy string) error
+	// release removes the foreground deletion finalizer of an owner
+	release func(resource types.Resource) error
+}
+
+// NewGarbageCollector creates a garbage collector for the resources of the engine.
+func (ec *EngineContext) NewGarbageCollector() *GarbageCollector {
+	return &GarbageCollector{
+		pending: ec.ResourceModel.PendingOwners,
+		forget: func(owner types.OwnerReference, revision int64) error {
+			return ec.ResourceModel.ForgetOwner(owner.Resource, owner.Name, revision)
+		},
+		get: func(resourceType string, name string) (types.Resource, bool, error) {
+			resource, err := ec.ResourceModel.FindOne(name, resourceType)
+			if errors.Is(err, models.ErrResourceNotFound) {
+				return types.Resource{}, false, nil
+			}
+			return resource, err == nil, err
+		},
+		dependents: ec.ResourceModel.FindDependents,
+		delete: func(resource types.Resource, policy string) error {
+			deleted, started, err := ec.ResourceModel.Delete(resource.Name, resource.Resource, policy)
+			if err != nil || !started {
+				return err
+			}
+			// Let the drivers clean up what they made for the dependent
+			_, err = PublishResourceEvent(types.EventDelete, deleted, ec.NatsContext.JetStream)
+			return err
+		},
+		release: func(resource types.Resource) error {
+			_, err := ec.ResourceModel.RemoveFinalizer(resource.Name, resource.Resource, types.FinalizerForegroundDeletion)
+			return err
+		},
+	}
+}
+
+// Run collects garbage every gcInterval until ctx is cancelled.
+func (gc *GarbageCollector) Run(ctx context.Context) {
+	ticker := time.NewTicker(gcInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := gc.Collect(); err != nil {
+				log.Println("Error collecting garbage: ", err)
+			}
+		}
+	}
+}
+
+// Collect deletes the dependents of the pending owners and releases the foreground owners without dependents left.
+// Owners are forgotten once nothing is left to do for them. Dependents deleted by a collection release their owners
+// in a later one.
+func (gc *GarbageCollector) Collect() error {
+	owners, revision, err := gc.pending()
+	if err != nil {
+		return err
+	}
+
+	// Resources are read once per collection
+	current := map[string]*types.Resource{}
+	lookup := func(resourceType string, name string) (*types.Resource, error) {
+		key := resourceType + "/" + name
+		if resource, ok := current[key]; ok {
+			return resource, nil
+		}
+		resource, ok, err := gc.get(resourceType, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			current[key] = &resource
+		} else {
+			current[key] = nil
+		}
+		return current[key], nil
+	}
+
+	for _, owner := range owners {
+		done, err := gc.collectOwner(owner, lookup)
+		if err != nil {
+			log.Printf("Error collecting dependents of %s of type %s: %v", owner.Name, owner.Resource, err)
+			continue
+		}
+		if !done {
+			continue
+		}
+		if err := gc.forget(owner, revision); err != nil {
+			log.Printf("Error forgetting owner %s of type %s: %v", owner.Name, owner.Resource, err)
+		}
+	}
+	return nil
+}
+
+// collectOwner deletes the dependents of an owner that are left without owners, or whose owner is deleted in the
+// foreground, and releases the owner once it has no dependents left. It reports whether the owner needs no more visits.
+func (gc *GarbageCollector) collectOwner(reference types.OwnerReference, lookup func(string, string) (*types.Resource, error)) (bool, error) {
+	ownerResource, err := lookup(reference.Resource, reference.Name)
+	if err != nil {
+		return false, err
+	}
+	dependents, err := gc.dependents(reference.Resource, reference.Name)
+	if err != nil {
+		return false, err
+	}
+
+	// left counts the dependents the owner still owns
+	left := 0
+	failed := false
+	for _, dependent := range dependents {
+		references := map[types.OwnerReference]types.Resource{}
+		for _, ref := range dependent.OwnerReferences {
+			o, err := lookup(ref.Resource, ref.Name)
+			if err != nil {
+				return false, err
+			}
+			if o != nil && ref.Owns(*o) {
+				references[ref] = *o
+			}
+		}
+		owner := func(ref types.OwnerReference) (types.Resource, bool) {
+			o, ok := references[ref]
+			return o, ok
+		}
+		if ownerResource != nil && slices.ContainsFunc(dependent.OwnerReferences, func(ref types.OwnerReference) bool {
+			return ref.Owns(*ownerResource)
+		}) {
+			left++
+		}
+
+		if dependent.DeletionTimestamp != nil {
+			// Already being deleted
+			continue
+		}
+		policy, ok := deletionPolicy(dependent, owner)
+		if !ok {
+			continue
+		}
+		owned, err := gc.dependents(dependent.Resource, dependent.Name)
+		if err != nil {
+			return false, err
+		}
+		if len(owned) == 0 {
+			// Nothing to wait for
+			policy = types.DeletionBackground
+		}
+		if err := gc.delete(dependent, policy); err != nil {
+			log.Printf("Error deleting dependent %s of type %s: %v", dependent.Name, dependent.Resource, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		// Visit the owner again to retry
+		return false, nil
+	}
+	if ownerResource == nil || ownerResource.DeletionTimestamp == nil || !slices.Contains(ownerResource.Finalizers, types.FinalizerForegroundDeletion) {
+		return true, nil
+	}
+	if left > 0 {
+		// The owner waits for its dependents
+		return false, nil
+	}
+	// Releasing the owner purges it, which marks it again
+	return true, gc.release(*ownerResource)
+}
+
+// deletionPolicy reports whether a dependent is to be deleted, and with which policy. owner looks up the
+// owner a reference refers to, and reports false when it does not exist.
+func deletionPolicy(resource types.Resource, owner func(types.OwnerReference) (types.Resource, bool)) (string, bool) {
+	orphaned := true
+	for _, reference := range resource.OwnerReferences {
+		o, ok := owner(reference)
+		if !ok {
+			continue
+		}
+		if o.DeletionTimestamp != nil && slices.Contains(o.Finalizers, types.FinalizerForegroundDeletion) {
+			// The owner waits for its dependents, so do theirs
+			return types.DeletionForeground, true
+		}
+		orphaned = false
+	}
+	return types.DeletionBackground, orphaned
+}
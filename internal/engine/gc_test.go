@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGarbageCollector(t *testing.T) {
+	now := time.Now()
+	owner := func(resource, name, id string) []types.OwnerReference {
+		return []types.OwnerReference{{Resource: resource, Name: name, ID: id}}
+	}
+	resources := []types.Resource{
+		// A release deleted in the foreground, its deployment waits for its pods in turn
+		{ID: "1", Resource: "release", Name: "v1", DeletionTimestamp: &now, Finalizers: []string{types.FinalizerForegroundDeletion}},
+		{ID: "2", Resource: "deployment", Name: "web-v1", OwnerReferences: owner("release", "v1", "1")},
+		{ID: "9", Resource: "pod", Name: "web-v1-a", OwnerReferences: owner("deployment", "web-v1", "")},
+		{ID: "10", Resource: "configmap", Name: "web-v1-config", OwnerReferences: owner("release", "v1", "")},
+		// A release deleted in the foreground whose dependents are gone
+		{ID: "3", Resource: "release", Name: "v0", DeletionTimestamp: &now, Finalizers: []string{types.FinalizerForegroundDeletion}},
+		// A deployment whose release is gone, or was created again
+		{ID: "4", Resource: "deployment", Name: "web-v2", OwnerReferences: owner("release", "v2", "")},
+		{ID: "5", Resource: "release", Name: "v3"},
+		{ID: "6", Resource: "deployment", Name: "web-v3", OwnerReferences: owner("release", "v3", "old")},
+		// A deployment with an owner left
+		{ID: "7", Resource: "deployment", Name: "shared", OwnerReferences: []types.OwnerReference{
+			{Resource: "release", Name: "v2"}, {Resource: "release", Name: "v3", ID: "5"},
+		}},
+		// A deployment that is already being deleted
+		{ID: "8", Resource: "deployment", Name: "web-v4", DeletionTimestamp: &now, OwnerReferences: owner("release", "v4", "")},
+	}
+
+	// Owners whose foreground deletion started, or that were purged
+	pending := []types.OwnerReference{
+		{Resource: "release", Name: "v0"}, {Resource: "release", Name: "v1"}, {Resource: "release", Name: "v2"},
+		{Resource: "release", Name: "v3"}, {Resource: "release", Name: "v4"},
+	}
+
+	deleted := map[string]string{}
+	var released, forgotten []string
+	gc := &GarbageCollector{
+		pending: func() ([]types.OwnerReference, int64, error) { return pending, 42, nil },
+		forget: func(owner types.OwnerReference, revision int64) error {
+			assert.Equal(t, int64(42), revision)
+			forgotten = append(forgotten, owner.Name)
+			return nil
+		},
+		get: func(resourceType string, name string) (types.Resource, bool, error) {
+			for _, resource := range resources {
+				if resource.Resource == resourceType && resource.Name == name {
+					return resource, true, nil
+				}
+			}
+			return types.Resource{}, false, nil
+		},
+		dependents: func(resourceType string, name string) ([]types.Resource, error) {
+			var dependents []types.Resource
+			for _, resource := range resources {
+				for _, reference := range resource.OwnerReferences {
+					if reference.Resource == resourceType && reference.Name == name {
+						dependents = append(dependents, resource)
+						break
+					}
+				}
+			}
+			return dependents, nil
+		},
+		delete: func(resource types.Resource, policy string) error {
+			deleted[resource.Name] = policy
+			return nil
+		},
+		release: func(resource types.Resource) error {
+			released = append(released, resource.Name)
+			return nil
+		},
+	}
+	require.NoError(t, gc.Collect())
+
+	assert.Equal(t, map[string]string{
+		"web-v1": types.DeletionForeground,
+		// Nothing depends on the config map
+		"web-v1-config": types.DeletionBackground,
+		"web-v2":        types.DeletionBackground,
+		"web-v3":        types.DeletionBackground,
+	}, deleted)
+	assert.Equal(t, []string{"v0"}, released, "v1 waits for its deployment")
+	assert.Equal(t, []string{"v0", "v2", "v3", "v4"}, forgotten, "v1 is visited again")
+}
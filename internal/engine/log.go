@@ -1,11 +1,11 @@
 package engine
 
 import (
-	"encoding/json"
+	"bytes"
 	"log"
 
 	"github.com/nats-io/nats.go/jetstream"
-	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/open-ug/conveyor/internal/models"
 )
 
 func (ec *EngineContext) consumeLogEvents(msg jetstream.Msg) {
@@ -14,15 +14,15 @@ func (ec *EngineContext) consumeLogEvents(msg jetstream.Msg) {
 
 	data := msg.Data()
 
-	var logEvent types.Log
-	err := json.Unmarshal(data, &logEvent)
+	// A message holds one log, or a batch of newline delimited logs
+	logs, err := models.DecodeLogs(bytes.NewReader(data))
 	if err != nil {
 		log.Println("Error unmarshaling log event: ", err)
 		return
 	}
 
-	// Process the log event
-	err = ec.LogModel.Insert(logEvent)
+	// Process the log events
+	err = ec.LogModel.InsertBatch(logs)
 	if err != nil {
 		log.Println("Error inserting log event: ", err)
 		return
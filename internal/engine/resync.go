@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/open-ug/conveyor/internal/models"
+	"github.com/open-ug/conveyor/internal/utils"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+const (
+	// resyncCheckInterval is how often the driver registry is checked for drivers that are due for a resync.
+	resyncCheckInterval = 10 * time.Second
+	// minResyncInterval bounds how often a driver can ask for resyncs.
+	minResyncInterval = time.Minute
+	// resyncJitter spreads resyncs by up to this fraction of the interval, so drivers started together do not resync together.
+	resyncJitter = 0.1
+	// resyncRate is the number of resync events published per second, across all drivers.
+	resyncRate = 20
+	// resyncPageSize is the number of resources read at once.
+	resyncPageSize = 100
+)
+
+// resyncTarget is a driver that asked for resyncs, merged over its registered instances.
+type resyncTarget struct {
+	interval  time.Duration
+	resources map[string]bool
+}
+
+// resourcePage lists a page of the resources of a type, see models.ResourceModel.List.
+type resourcePage func(resourceType string, after string, limit int) (*types.ResourceList, error)
+
+/*
+Resyncer periodically delivers a resync event for every resource to the drivers with a resync
+interval. Events are published at resyncRate, and the resyncs of a driver are jittered.
+*/
+type Resyncer struct {
+	ec *EngineContext
+	// list reads the resources to resync
+	list resourcePage
+	// publish sends a resync event to a driver
+	publish func(subject string, message types.DriverMessage) error
+	// throttle waits for the turn of the next event
+	throttle <-chan time.Time
+
+	// next is when each driver is resynced next
+	next map[string]time.Time
+	now  func() time.Time
+}
+
+// NewResyncer creates a resyncer for the drivers of the engine.
+func (ec *EngineContext) NewResyncer() *Resyncer {
+	return &Resyncer{
+		ec: ec,
+		list: func(resourceType string, after string, limit int) (*types.ResourceList, error) {
+			return ec.ResourceModel.List(resourceType, models.ResourceListOptions{After: after, Limit: limit})
+		},
+		publish:  ec.publishEvent,
+		throttle: time.NewTicker(time.Second / resyncRate).C,
+		next:     map[string]time.Time{},
+		now:      time.Now,
+	}
+}
+
+// Run resyncs drivers until ctx is cancelled.
+func (r *Resyncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(resyncCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			targets, err := r.targets(ctx)
+			if err != nil {
+				log.Println("Error listing drivers to resync: ", err)
+				continue
+			}
+			r.resyncDue(ctx, targets)
+		}
+	}
+}
+
+// resyncDue resyncs the drivers whose resync is due and schedules their next resync.
+func (r *Resyncer) resyncDue(ctx context.Context, targets map[string]resyncTarget) {
+	for driver := range r.next {
+		if _, ok := targets[driver]; !ok {
+			// The driver stopped or no longer wants resyncs
+			delete(r.next, driver)
+		}
+	}
+
+	for driver, target := range targets {
+		next, scheduled := r.next[driver]
+		if !scheduled {
+			// Drivers are resynced one interval after they are first seen, they reconcile new events meanwhile
+			r.next[driver] = r.schedule(target.interval)
+			continue
+		}
+		if r.now().Before(next) {
+			continue
+		}
+
+		for resourceType := range target.resources {
+			if err := r.resync(ctx, driver, resourceType); err != nil {
+				log.Printf("Error resyncing %s resources of driver %s: %v", resourceType, driver, err)
+			}
+		}
+		r.next[driver] = r.schedule(target.interval)
+	}
+}
+
+// schedule returns when a driver with the given interval is resynced next.
+func (r *Resyncer) schedule(interval time.Duration) time.Time {
+	jitter := time.Duration((rand.Float64()*2 - 1) * resyncJitter * float64(interval))
+	return r.now().Add(interval + jitter)
+}
+
+// resync delivers a resync event for every resource of a type to a driver.
+func (r *Resyncer) resync(ctx context.Context, driver string, resourceType string) error {
+	after := ""
+	for {
+		list, err := r.list(resourceType, after, resyncPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, resource := range list.Items {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-r.throttle:
+			}
+
+			payload, err := json.Marshal(resource)
+			if err != nil {
+				return err
+			}
+			id, err := utils.GenerateRandomID()
+			if err != nil {
+				return err
+			}
+			message := types.DriverMessage{
+				Event:   types.EventResync,
+				RunID:   uuid.New().String(),
+				ID:      id,
+				Payload: string(payload),
+			}
+			if err := r.publish("drivers."+driver+".resources."+resourceType, message); err != nil {
+				return err
+			}
+		}
+
+		if list.Continue == "" {
+			return nil
+		}
+		after = list.Continue
+	}
+}
+
+// targets returns the drivers that asked for resyncs, with the shortest interval and all resources of their instances.
+func (r *Resyncer) targets(ctx context.Context) (map[string]resyncTarget, error) {
+	instances, err := r.ec.driverInstances(ctx, ">")
+	if err != nil {
+		return nil, err
+	}
+
+	targets := map[string]resyncTarget{}
+	for _, instance := range instances {
+		if instance.ResyncInterval <= 0 {
+			continue
+		}
+
+		interval := max(instance.ResyncInterval, minResyncInterval)
+		target, ok := targets[instance.Driver]
+		if !ok {
+			target = resyncTarget{interval: interval, resources: map[string]bool{}}
+		}
+		target.interval = min(target.interval, interval)
+		for _, resource := range instance.Resources {
+			target.resources[resource] = true
+		}
+		targets[instance.Driver] = target
+	}
+	return targets, nil
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/open-ug/conveyor/internal/utils"
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResyncer(t *testing.T) {
+	natsContext := utils.NewNatsConn(&types.ServerConfig{
+		API:  types.APIConfig{Data: t.TempDir()},
+		NATS: types.NATSConfig{Port: -1},
+	})
+	t.Cleanup(natsContext.Shutdown)
+	natsContext.JetStream.DeleteKeyValue(context.Background(), "drivers")
+	require.NoError(t, natsContext.InitiateStreams())
+
+	registry, err := natsContext.JetStream.KeyValue(context.Background(), "drivers")
+	require.NoError(t, err)
+	for key, instance := range map[string]types.DriverInstance{
+		"infra.1":  {Driver: "infra", Resources: []string{"cluster"}, ResyncInterval: 30 * time.Second},
+		"infra.2":  {Driver: "infra", Resources: []string{"bucket"}, ResyncInterval: 5 * time.Minute},
+		"builds.1": {Driver: "builds", Resources: []string{"pipe"}},
+	} {
+		value, err := json.Marshal(instance)
+		require.NoError(t, err)
+		_, err = registry.Put(context.Background(), key, value)
+		require.NoError(t, err)
+	}
+
+	resources := map[string][]string{"cluster": {"a", "b", "c"}, "bucket": {"logs"}}
+	var published []string
+	now := time.Now()
+	r := &Resyncer{
+		ec: &EngineContext{NatsContext: *natsContext},
+		list: func(resourceType string, after string, limit int) (*types.ResourceList, error) {
+			// Pages of two resources
+			names := resources[resourceType]
+			start := sort.SearchStrings(names, after)
+			if after != "" {
+				start++
+			}
+			end := min(start+2, len(names))
+			page := &types.ResourceList{}
+			for _, name := range names[start:end] {
+				page.Items = append(page.Items, types.Resource{Name: name, Resource: resourceType})
+			}
+			if end < len(names) {
+				page.Continue = names[end-1]
+			}
+			return page, nil
+		},
+		publish: func(subject string, message types.DriverMessage) error {
+			var resource types.Resource
+			require.NoError(t, json.Unmarshal([]byte(message.Payload), &resource))
+			assert.Equal(t, types.EventResync, message.Event)
+			assert.NotEmpty(t, message.RunID)
+			published = append(published, subject+":"+resource.Name)
+			return nil
+		},
+		throttle: time.NewTicker(time.Millisecond).C,
+		next:     map[string]time.Time{},
+		now:      func() time.Time { return now },
+	}
+
+	targets, err := r.targets(context.Background())
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+	// Intervals are raised to the minimum, the shortest interval of the instances wins
+	assert.Equal(t, minResyncInterval, targets["infra"].interval)
+	assert.Equal(t, map[string]bool{"cluster": true, "bucket": true}, targets["infra"].resources)
+
+	// Drivers are resynced one jittered interval after they are first seen
+	r.resyncDue(context.Background(), targets)
+	assert.Empty(t, published)
+	assert.WithinDuration(t, now.Add(minResyncInterval), r.next["infra"], time.Duration(resyncJitter*float64(minResyncInterval)))
+
+	now = now.Add(2 * minResyncInterval)
+	r.resyncDue(context.Background(), targets)
+	sort.Strings(published)
+	assert.Equal(t, []string{
+		"drivers.infra.resources.bucket:logs",
+		"drivers.infra.resources.cluster:a",
+		"drivers.infra.resources.cluster:b",
+		"drivers.infra.resources.cluster:c",
+	}, published)
+	assert.True(t, r.next["infra"].After(now))
+
+	// Drivers that are gone are forgotten
+	r.resyncDue(context.Background(), map[string]resyncTarget{})
+	assert.Empty(t, r.next)
+
+	// Instances that stopped renewing their registration are not resynced
+	defer func(ttl time.Duration) { registrationTTL = ttl }(registrationTTL)
+	registrationTTL = 50 * time.Millisecond
+	time.Sleep(100 * time.Millisecond)
+	targets, err = r.targets(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, targets)
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+// ErrNoMatchingDriver is returned when no running instance of a driver matches the selector of a step.
+var ErrNoMatchingDriver = errors.New("no driver instance matches the step selector")
+
+// registrationTTL is how long ago an instance must have renewed its registry entry to count as running.
+var registrationTTL = types.DriverRegistrationTTL
+
+/*
+stepSubject returns the subject the message of a step is published on.
+Steps without a selector go to the shared subject of the driver, which any instance may take.
+Steps with a selector go to the pool of registered instances whose labels match it. When several
+pools match, the one with the most instances is chosen, so the work lands where capacity is.
+*/
+func (ec *EngineContext) stepSubject(step types.Step, resource string) (string, error) {
+	if len(step.Selector) == 0 {
+		return "drivers." + step.Driver + ".resources." + resource, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	instances, err := ec.driverInstances(ctx, step.Driver+".*")
+	if err != nil {
+		return "", err
+	}
+
+	pools := map[string]int{}
+	for _, instance := range instances {
+		if instance.Pool != "" && instance.Matches(step.Selector) {
+			pools[instance.Pool]++
+		}
+	}
+	if len(pools) == 0 {
+		return "", fmt.Errorf("%w: driver %s, selector %v", ErrNoMatchingDriver, step.Driver, step.Selector)
+	}
+
+	names := make([]string, 0, len(pools))
+	for pool := range pools {
+		names = append(names, pool)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if pools[names[i]] != pools[names[j]] {
+			return pools[names[i]] > pools[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return types.DriverPoolSubject(step.Driver, names[0], resource), nil
+}
+
+// driverInstances lists the running instances whose registry keys match filter, e.g. `build.*` for the instances
+// of the build driver. Instances that did not renew their entry within registrationTTL are skipped.
+func (ec *EngineContext) driverInstances(ctx context.Context, filter string) ([]types.DriverInstance, error) {
+	registry, err := ec.NatsContext.JetStream.KeyValue(ctx, "drivers")
+	if err != nil {
+		return nil, fmt.Errorf("driver registry unavailable: %w", err)
+	}
+
+	lister, err := registry.ListKeysFiltered(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []types.DriverInstance
+	for key := range lister.Keys() {
+		entry, err := registry.Get(ctx, key)
+		if errors.Is(err, jetstream.ErrKeyNotFound) {
+			// Deregistered while listing
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if time.Since(entry.Created()) > registrationTTL {
+			// The instance stopped without deregistering
+			continue
+		}
+
+		var instance types.DriverInstance
+		if err := json.Unmarshal(entry.Value(), &instance); err != nil {
+			continue
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/open-ug/conveyor/internal/utils"
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStepSubject(t *testing.T) {
+	natsContext := utils.NewNatsConn(&types.ServerConfig{
+		API:  types.APIConfig{Data: t.TempDir()},
+		NATS: types.NATSConfig{Port: -1},
+	})
+	t.Cleanup(natsContext.Shutdown)
+	natsContext.JetStream.DeleteKeyValue(context.Background(), "drivers")
+	require.NoError(t, natsContext.InitiateStreams())
+
+	registry, err := natsContext.JetStream.KeyValue(context.Background(), "drivers")
+	require.NoError(t, err)
+	register := func(id string, labels map[string]string) {
+		value, err := json.Marshal(types.DriverInstance{ID: id, Driver: "build", Labels: labels, Pool: types.DriverPool(labels)})
+		require.NoError(t, err)
+		_, err = registry.Put(context.Background(), "build."+id, value)
+		require.NoError(t, err)
+	}
+	armGPU := map[string]string{"arch": "arm64", "gpu": "true"}
+	arm := map[string]string{"arch": "arm64", "gpu": "false"}
+	register("1", armGPU)
+	register("2", arm)
+	register("3", arm)
+	register("4", map[string]string{"arch": "amd64"})
+	register("5", nil)
+
+	ec := &EngineContext{NatsContext: *natsContext}
+
+	subject, err := ec.stepSubject(types.Step{Driver: "build"}, "pipe")
+	require.NoError(t, err)
+	assert.Equal(t, "drivers.build.resources.pipe", subject)
+
+	subject, err = ec.stepSubject(types.Step{Driver: "build", Selector: map[string]string{"gpu": "true"}}, "pipe")
+	require.NoError(t, err)
+	assert.Equal(t, types.DriverPoolSubject("build", types.DriverPool(armGPU), "pipe"), subject)
+
+	// Both arm64 pools match, the one with more instances wins
+	subject, err = ec.stepSubject(types.Step{Driver: "build", Selector: map[string]string{"arch": "arm64"}}, "pipe")
+	require.NoError(t, err)
+	assert.Equal(t, types.DriverPoolSubject("build", types.DriverPool(arm), "pipe"), subject)
+
+	_, err = ec.stepSubject(types.Step{Driver: "build", Selector: map[string]string{"arch": "riscv64"}}, "pipe")
+	assert.ErrorIs(t, err, ErrNoMatchingDriver)
+
+	// Instances that stopped renewing their registration do not count
+	defer func(ttl time.Duration) { registrationTTL = ttl }(registrationTTL)
+	registrationTTL = 50 * time.Millisecond
+	time.Sleep(100 * time.Millisecond)
+	register("6", armGPU)
+	subject, err = ec.stepSubject(types.Step{Driver: "build", Selector: map[string]string{"arch": "arm64"}}, "pipe")
+	require.NoError(t, err)
+	assert.Equal(t, types.DriverPoolSubject("build", types.DriverPool(armGPU), "pipe"), subject)
+}
@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+func (ec *EngineContext) consumeProgressEvents(msg jetstream.Msg) {
+	// Logic to consume driver progress reports from NATS
+	msg.Ack()
+
+	var progress types.Progress
+	err := json.Unmarshal(msg.Data(), &progress)
+	if err != nil {
+		log.Println("Error unmarshaling progress event: ", err)
+		return
+	}
+
+	ec.updateRun(progress.RunID, func(run *types.Run) {
+		step := run.Step(progress.Driver)
+		if step.Status == types.RunSucceeded || step.Status == types.RunFailed {
+			// The result of the step arrived first, keep it
+			return
+		}
+		step.Status = types.RunRunning
+		step.RequeuedUntil = nil
+		step.Phase = progress.Phase
+		step.Percent = progress.Percent
+		step.Message = progress.Message
+		step.UpdatedAt = progress.Timestamp
+		run.UpdateStatus()
+	})
+}
+
+// startRun creates the run record of a pipeline run with a pending step per pipeline step.
+func (ec *EngineContext) startRun(event PipelineEvent, pipeline *types.Pipeline) {
+	ec.updateRun(event.RunID, func(run *types.Run) {
+		run.Pipeline = pipeline.Name
+		run.Resource = event.Resource.Resource
+		run.ResourceName = event.Resource.Name
+		run.Event = event.Event
+		for i, pipelineStep := range pipeline.Steps {
+			step := run.Step(pipelineStep.Driver)
+			if i == 0 && step.Status == types.RunPending {
+				step.Status = types.RunRunning
+				step.UpdatedAt = time.Now()
+			}
+		}
+		run.UpdateStatus()
+	})
+}
+
+// recordDriverResult stores the result of a driver in the step state of its run.
+func (ec *EngineContext) recordDriverResult(event PipelineEvent) {
+	ec.updateRun(event.RunID, func(run *types.Run) {
+		if run.Resource == "" {
+			run.Pipeline = event.Resource.Pipeline
+			run.Resource = event.Resource.Resource
+			run.ResourceName = event.Resource.Name
+		}
+
+		result := event.DriverResultEvent
+		step := run.Step(result.Driver)
+		step.Message = result.Message
+		step.UpdatedAt = time.Now()
+		if result.Attempt > step.Attempts {
+			step.Attempts = result.Attempt
+		}
+
+		if result.Requeued() {
+			// The driver reconciles the event again later, the step is still running
+			requeuedUntil := step.UpdatedAt.Add(result.RequeueAfter)
+			step.Status = types.RunRunning
+			step.RequeuedUntil = &requeuedUntil
+			run.UpdateStatus()
+			return
+		}
+
+		step.RequeuedUntil = nil
+		step.Status = types.RunFailed
+		if result.Success {
+			step.Status = types.RunSucceeded
+			step.Percent = 100
+		}
+		run.UpdateStatus()
+	})
+}
+
+// startStep marks the step of the given driver as running.
+func (ec *EngineContext) startStep(runID string, driver string) {
+	ec.updateRun(runID, func(run *types.Run) {
+		step := run.Step(driver)
+		if step.Status == types.RunPending {
+			step.Status = types.RunRunning
+			step.UpdatedAt = time.Now()
+		}
+		run.UpdateStatus()
+	})
+}
+
+// failStep marks the step of the given driver as failed, e.g. when it could not be routed to a driver.
+func (ec *EngineContext) failStep(runID string, driver string, message string) {
+	ec.updateRun(runID, func(run *types.Run) {
+		step := run.Step(driver)
+		step.Status = types.RunFailed
+		step.Message = message
+		step.UpdatedAt = time.Now()
+		run.UpdateStatus()
+	})
+}
+
+// updateRun updates a run record and publishes it to the clients streaming the run status.
+func (ec *EngineContext) updateRun(runID string, fn func(run *types.Run)) {
+	if runID == "" {
+		return
+	}
+
+	run, err := ec.RunModel.Update(runID, fn)
+	if err != nil {
+		log.Println("Error updating run: ", err)
+		return
+	}
+
+	runJson, err := json.Marshal(run)
+	if err != nil {
+		log.Println("Error marshaling run: ", err)
+		return
+	}
+
+	err = ec.NatsContext.NatsCon.Publish("live.runs."+runID, runJson)
+	if err != nil {
+		log.Println("Error publishing run status: ", err)
+	}
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/open-ug/conveyor/internal/storage"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+// ChecksumHeader carries the hex encoded SHA-256 checksum of an artifact.
+const ChecksumHeader = "X-Checksum-Sha256"
+
+type ArtifactHandler struct {
+	Store storage.Store
+}
+
+func NewArtifactHandler(store storage.Store) *ArtifactHandler {
+	return &ArtifactHandler{
+		Store: store,
+	}
+}
+
+// artifactKey returns the storage key and the cleaned path of an artifact from the request parameters.
+func artifactKey(c *fiber.Ctx) (string, string, error) {
+	artifactPath, err := url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return "", "", err
+	}
+	artifactPath = strings.Trim(artifactPath, "/")
+	if artifactPath == "" {
+		return "", "", fmt.Errorf("artifact path is required")
+	}
+	return "artifacts/" + c.Params("runid") + "/" + artifactPath, artifactPath, nil
+}
+
+// UploadArtifact stores an artifact of a run
+// @Summary Upload an artifact
+// @Description Streams the request body into the artifact store under the given path of the run, replacing any existing artifact. If the X-Checksum-Sha256 header is set, the upload is rejected when the checksum does not match, and any existing artifact is kept.
+// @Tags artifacts
+// @Accept octet-stream
+// @Produce json
+// @Param runid path string true "Run ID"
+// @Param path path string true "Artifact path"
+// @Param X-Checksum-Sha256 header string false "Expected hex encoded SHA-256 checksum"
+// @Success 201 {object} types.Artifact "Artifact stored"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid path or checksum mismatch"
+// @Failure 409 {object} map[string]interface{} "The path is a directory of other artifacts, or a directory of it is another artifact"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /runs/{runid}/artifacts/{path} [put]
+func (h *ArtifactHandler) UploadArtifact(c *fiber.Ctx) error {
+	key, artifactPath, err := artifactKey(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid artifact path: %v", err),
+		})
+	}
+
+	// Large bodies are streamed instead of being buffered in memory
+	var body io.Reader = c.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(c.Body())
+	}
+
+	object, err := h.Store.Put(c.UserContext(), key, body, c.Get(ChecksumHeader))
+	if errors.Is(err, storage.ErrInvalidKey) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid artifact path: %v", err),
+		})
+	}
+	if errors.Is(err, storage.ErrChecksumMismatch) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, storage.ErrKeyConflict) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": fmt.Sprintf("Artifact %s conflicts with another artifact of the run", artifactPath),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to store artifact: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(types.Artifact{
+		RunID:     c.Params("runid"),
+		Path:      artifactPath,
+		Size:      object.Size,
+		SHA256:    object.SHA256,
+		CreatedAt: object.ModTime,
+	})
+}
+
+// DownloadArtifact streams an artifact of a run
+// @Summary Download an artifact
+// @Description Streams the artifact stored under the given path of the run. The X-Checksum-Sha256 response header holds its checksum. With S3 storage the client is redirected to a presigned URL of the bucket instead.
+// @Tags artifacts
+// @Produce octet-stream
+// @Param runid path string true "Run ID"
+// @Param path path string true "Artifact path"
+// @Success 200 {file} file "Artifact contents"
+// @Success 307 "Redirect to a presigned download URL"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid path"
+// @Failure 404 {object} map[string]interface{} "Artifact not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /runs/{runid}/artifacts/{path} [get]
+func (h *ArtifactHandler) DownloadArtifact(c *fiber.Ctx) error {
+	key, artifactPath, err := artifactKey(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid artifact path: %v", err),
+		})
+	}
+
+	// Stores that can presign URLs serve the download themselves
+	if presigner, ok := h.Store.(storage.Presigner); ok {
+		return h.redirectToArtifact(c, presigner, key, artifactPath)
+	}
+
+	reader, object, err := h.Store.Get(c.UserContext(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": fmt.Sprintf("Artifact %s not found", artifactPath),
+		})
+	}
+	if errors.Is(err, storage.ErrInvalidKey) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid artifact path: %v", err),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to get artifact: %v", err),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+	c.Set(ChecksumHeader, object.SHA256)
+	return c.SendStream(reader, int(object.Size))
+}
+
+// redirectToArtifact redirects the client to a presigned URL of the artifact.
+// The checksum is set on the redirect, since the storage does not send it under the same header.
+func (h *ArtifactHandler) redirectToArtifact(c *fiber.Ctx, presigner storage.Presigner, key string, artifactPath string) error {
+	object, err := h.Store.Stat(c.UserContext(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": fmt.Sprintf("Artifact %s not found", artifactPath),
+		})
+	}
+	if errors.Is(err, storage.ErrInvalidKey) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid artifact path: %v", err),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to get artifact: %v", err),
+		})
+	}
+
+	location, err := presigner.PresignGet(c.UserContext(), key)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to presign artifact download: %v", err),
+		})
+	}
+
+	c.Set(ChecksumHeader, object.SHA256)
+	return c.Redirect(location, fiber.StatusTemporaryRedirect)
+}
+
+// DeleteArtifact deletes an artifact of a run
+// @Summary Delete an artifact
+// @Description Deletes the artifact stored under the given path of the run
+// @Tags artifacts
+// @Param runid path string true "Run ID"
+// @Param path path string true "Artifact path"
+// @Success 204 "Artifact deleted"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid path"
+// @Failure 404 {object} map[string]interface{} "Artifact not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /runs/{runid}/artifacts/{path} [delete]
+func (h *ArtifactHandler) DeleteArtifact(c *fiber.Ctx) error {
+	key, artifactPath, err := artifactKey(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid artifact path: %v", err),
+		})
+	}
+
+	err = h.Store.Delete(c.UserContext(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": fmt.Sprintf("Artifact %s not found", artifactPath),
+		})
+	}
+	if errors.Is(err, storage.ErrInvalidKey) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid artifact path: %v", err),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to delete artifact: %v", err),
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
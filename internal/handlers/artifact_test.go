@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/open-ug/conveyor/internal/storage"
+)
+
+func TestUploadArtifactChecksum(t *testing.T) {
+	store, err := storage.NewFileSystemStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	handler := NewArtifactHandler(store)
+
+	app := fiber.New(fiber.Config{StreamRequestBody: true})
+	app.Put("/runs/:runid/artifacts/*", handler.UploadArtifact)
+	app.Get("/runs/:runid/artifacts/*", handler.DownloadArtifact)
+
+	// sha256("binary")
+	const checksum = "9a3a45d01531a20e89ac6ae10b0b0beb0492acd7216a368aa062d1a5fecaf9cd"
+
+	req := httptest.NewRequest(http.MethodPut, "/runs/run-1/artifacts/bin/app", strings.NewReader("corrupted"))
+	req.Header.Set(ChecksumHeader, checksum)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("PUT artifact failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", fiber.StatusBadRequest, resp.StatusCode)
+	}
+
+	// The rejected upload is not kept
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/runs/run-1/artifacts/bin/app", nil))
+	if err != nil {
+		t.Fatalf("GET artifact failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("expected status %d, got %d", fiber.StatusNotFound, resp.StatusCode)
+	}
+
+	req = httptest.NewRequest(http.MethodPut, "/runs/run-1/artifacts/bin/app", strings.NewReader("binary"))
+	req.Header.Set(ChecksumHeader, checksum)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("PUT artifact failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Errorf("expected status %d, got %d", fiber.StatusCreated, resp.StatusCode)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/runs/run-1/artifacts/bin/app", nil))
+	if err != nil {
+		t.Fatalf("GET artifact failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "binary" {
+		t.Errorf("expected body %q, got %q", "binary", string(body))
+	}
+	if resp.Header.Get(ChecksumHeader) != checksum {
+		t.Errorf("expected checksum %s, got %s", checksum, resp.Header.Get(ChecksumHeader))
+	}
+
+	// A rejected upload keeps the existing artifact
+	req = httptest.NewRequest(http.MethodPut, "/runs/run-1/artifacts/bin/app", strings.NewReader("corrupted"))
+	req.Header.Set(ChecksumHeader, checksum)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("PUT artifact failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", fiber.StatusBadRequest, resp.StatusCode)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/runs/run-1/artifacts/bin/app", nil))
+	if err != nil {
+		t.Fatalf("GET artifact failed: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	if string(body) != "binary" {
+		t.Errorf("expected body %q, got %q", "binary", string(body))
+	}
+
+	// A path cannot be both an artifact and the directory of other artifacts
+	resp, err = app.Test(httptest.NewRequest(http.MethodPut, "/runs/run-1/artifacts/bin/app/debug", strings.NewReader("nested")))
+	if err != nil {
+		t.Fatalf("PUT artifact failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusConflict {
+		t.Errorf("expected status %d, got %d", fiber.StatusConflict, resp.StatusCode)
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/open-ug/conveyor/internal/storage"
+)
+
+type CacheHandler struct {
+	Cache *storage.Cache
+}
+
+func NewCacheHandler(cache *storage.Cache) *CacheHandler {
+	return &CacheHandler{
+		Cache: cache,
+	}
+}
+
+// cacheError converts an error of the cache into a response.
+func cacheError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, storage.ErrCacheMiss):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": fmt.Sprintf("Cache entry %s not found", c.Params("key")),
+		})
+	case errors.Is(err, storage.ErrInvalidKey):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid cache key: %v", err),
+		})
+	case errors.Is(err, storage.ErrChecksumMismatch):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, storage.ErrCacheEntryTooLarge):
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Cache error: %v", err),
+		})
+	}
+}
+
+// PutCacheEntry stores an entry in the build cache
+// @Summary Store a cache entry
+// @Description Streams the request body into the build cache under the given key, replacing any existing entry. Entries with the same content share storage. If the X-Checksum-Sha256 header is set, the upload is rejected when the checksum does not match.
+// @Tags cache
+// @Accept octet-stream
+// @Produce json
+// @Param key path string true "Cache key"
+// @Param ttl query string false "How long the entry is kept, e.g. 24h. Defaults to the configured cache TTL"
+// @Param X-Checksum-Sha256 header string false "Expected hex encoded SHA-256 checksum"
+// @Success 201 {object} types.CacheEntry "Cache entry stored"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid key, TTL or checksum mismatch"
+// @Failure 413 {object} map[string]interface{} "Entry is larger than the cache"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /cache/{key} [put]
+func (h *CacheHandler) PutCacheEntry(c *fiber.Ctx) error {
+	var ttl time.Duration
+	if value := c.Query("ttl"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Invalid ttl %q", value),
+			})
+		}
+		ttl = parsed
+	}
+
+	// Large bodies are streamed instead of being buffered in memory
+	var body io.Reader = c.Context().RequestBodyStream()
+	if body == nil {
+		body = bytes.NewReader(c.Body())
+	}
+
+	entry, err := h.Cache.Put(c.UserContext(), c.Params("key"), body, strings.ToLower(c.Get(ChecksumHeader)), ttl)
+	if err != nil {
+		return cacheError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(entry)
+}
+
+// GetCacheEntry streams an entry of the build cache
+// @Summary Get a cache entry
+// @Description Streams the cache entry stored under the given key. The X-Checksum-Sha256 response header holds its checksum. With S3 storage the client is redirected to a presigned URL of the bucket instead.
+// @Tags cache
+// @Produce octet-stream
+// @Param key path string true "Cache key"
+// @Success 200 {file} file "Cache entry contents"
+// @Success 307 "Redirect to a presigned download URL"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid key"
+// @Failure 404 {object} map[string]interface{} "Cache miss"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /cache/{key} [get]
+func (h *CacheHandler) GetCacheEntry(c *fiber.Ctx) error {
+	record, err := h.Cache.Lookup(c.UserContext(), c.Params("key"))
+	if err != nil {
+		return cacheError(c, err)
+	}
+
+	// Stores that can presign URLs serve the download themselves
+	if presigner, ok := h.Cache.Store.(storage.Presigner); ok {
+		location, err := presigner.PresignGet(c.UserContext(), record.Object)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": fmt.Sprintf("Failed to presign cache download: %v", err),
+			})
+		}
+		c.Set(ChecksumHeader, record.SHA256)
+		return c.Redirect(location, fiber.StatusTemporaryRedirect)
+	}
+
+	reader, err := h.Cache.Open(c.UserContext(), record)
+	if err != nil {
+		return cacheError(c, err)
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMEOctetStream)
+	c.Set(ChecksumHeader, record.SHA256)
+	return c.SendStream(reader, int(record.Size))
+}
+
+// DeleteCacheEntry deletes an entry of the build cache
+// @Summary Delete a cache entry
+// @Description Deletes the cache entry stored under the given key
+// @Tags cache
+// @Param key path string true "Cache key"
+// @Success 204 "Cache entry deleted"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid key"
+// @Failure 404 {object} map[string]interface{} "Cache entry not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /cache/{key} [delete]
+func (h *CacheHandler) DeleteCacheEntry(c *fiber.Ctx) error {
+	if err := h.Cache.Delete(c.UserContext(), c.Params("key")); err != nil {
+		return cacheError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
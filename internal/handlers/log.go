@@ -1,13 +1,20 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"log"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/nats-io/nats.go"
 	"github.com/open-ug/conveyor/internal/models"
 	"github.com/open-ug/conveyor/pkg/types"
 )
 
 type LogHandler struct {
 	Model *models.LogModel
+	// NatsCon streams created logs to clients watching them, when set
+	NatsCon *nats.Conn
 }
 
 // CreateLog persists a new log entry in BadgerDB
@@ -30,28 +37,77 @@ func (h *LogHandler) CreateLog(c *fiber.Ctx) error {
 	if err := h.Model.Insert(log); err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
 	}
+	h.publishLive([]types.Log{log})
 
 	return c.SendStatus(fiber.StatusCreated)
 }
 
+// CreateLogBatch persists a batch of log entries in BadgerDB
+// @Summary Create log entries in bulk
+// @Description Accepts newline delimited JSON log entries (NDJSON), one log per line, and stores them in BadgerDB in a single batch. Either all entries are stored or none.
+// @Tags logs
+// @Accept x-ndjson
+// @Produce json
+// @Param logs body string true "Newline delimited log entries"
+// @Success 201 {object} map[string]int "Number of logs created"
+// @Failure 400 {object} map[string]string "Bad request - Invalid log entry"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /logs/batch [post]
+func (h *LogHandler) CreateLogBatch(c *fiber.Ctx) error {
+	logs, err := models.DecodeLogs(bytes.NewReader(c.Body()))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	if err := h.Model.InsertBatch(logs); err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
+	}
+	h.publishLive(logs)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"count": len(logs)})
+}
+
+// publishLive streams persisted logs to the clients watching the logs of their run and driver, like drivers do.
+// A failure is only logged, the logs are already persisted.
+func (h *LogHandler) publishLive(logs []types.Log) {
+	if h.NatsCon == nil {
+		return
+	}
+	for _, entry := range logs {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			log.Println("Error marshalling log: ", err)
+			continue
+		}
+		if err := h.NatsCon.Publish("live.logs."+entry.RunID+"."+entry.Driver, data); err != nil {
+			log.Println("Error streaming log: ", err)
+		}
+	}
+}
+
 // GetLogs retrieves log entries from BadgerDB with optional filtering
 // @Summary Get log entries
-// @Description Returns logs filtered by pipeline, driver, and runid
+// @Description Returns logs filtered by pipeline, driver, runid, step, minimum level and labels
 // @Tags logs
 // @Accept json
 // @Produce json
 // @Param pipeline query string false "Pipeline name"
 // @Param driver query string false "Driver name"
 // @Param runid query string false "Run ID"
+// @Param step query string false "Step ID"
+// @Param level query string false "Minimum log level: debug, info, warn or error"
+// @Param labels query string false "Comma separated key=value labels the logs must have"
 // @Success 200 {array} types.Log "List of logs"
+// @Failure 400 {object} map[string]string "Bad request - Invalid level or labels"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /logs [get]
 func (h *LogHandler) GetLogs(c *fiber.Ctx) error {
-	pipeline := c.Query("pipeline")
-	driver := c.Query("driver")
-	runid := c.Query("runid")
+	filter, err := models.NewLogFilter(c.Query("pipeline"), c.Query("driver"), c.Query("runid"), c.Query("step"), c.Query("level"), c.Query("labels"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
 
-	logs, err := h.Model.Query(pipeline, driver, runid)
+	logs, err := h.Model.Find(filter)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).SendString(err.Error())
 	}
@@ -11,6 +11,7 @@ import (
 	"github.com/dgraph-io/badger/v4"
 	"github.com/gofiber/fiber/v2"
 	"github.com/open-ug/conveyor/internal/models"
+	"github.com/open-ug/conveyor/internal/utils"
 	"github.com/open-ug/conveyor/pkg/types"
 )
 
@@ -108,3 +109,167 @@ func TestCreateLogAndGetLogs(t *testing.T) {
 		t.Errorf("expected 0 logs, got %d", len(logs))
 	}
 }
+
+func TestGetLogsFilters(t *testing.T) {
+	app := fiber.New()
+	handler := setupTestHandler(t)
+	app.Get("/logs", handler.GetLogs)
+
+	for _, log := range []types.Log{
+		{RunID: "run-1", Driver: "builder", Step: "build", Level: types.LogLevelInfo, Message: "compiling", Labels: map[string]string{"stage": "compile"}},
+		{RunID: "run-1", Driver: "builder", Step: "build", Level: types.LogLevelError, Message: "compile failed", Labels: map[string]string{"stage": "compile"}},
+		{RunID: "run-1", Driver: "tester", Step: "test", Level: types.LogLevelWarn, Message: "flaky test"},
+		{RunID: "run-1", Driver: "tester", Step: "test", Message: "legacy log without level"},
+	} {
+		log.Timestamp = types.FormatLogTimestamp(time.Now())
+		if err := handler.Model.Insert(log); err != nil {
+			t.Fatalf("failed to insert log: %v", err)
+		}
+	}
+
+	query := func(url string) []string {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil))
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", url, err)
+		}
+		if resp.StatusCode != fiber.StatusOK {
+			t.Fatalf("GET %s: expected status %d, got %d", url, fiber.StatusOK, resp.StatusCode)
+		}
+		var logs []types.Log
+		if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		messages := []string{}
+		for _, log := range logs {
+			messages = append(messages, log.Message)
+		}
+		return messages
+	}
+
+	cases := map[string][]string{
+		"/logs?runid=run-1&level=error":          {"compile failed"},
+		"/logs?runid=run-1&level=warn":           {"compile failed", "flaky test"},
+		"/logs?runid=run-1&step=test&level=info": {"flaky test", "legacy log without level"},
+		"/logs?labels=stage=compile":             {"compiling", "compile failed"},
+	}
+	for url, expected := range cases {
+		got := query(url)
+		if len(got) != len(expected) {
+			t.Errorf("GET %s: expected %v, got %v", url, expected, got)
+			continue
+		}
+		for _, message := range expected {
+			found := false
+			for _, g := range got {
+				found = found || g == message
+			}
+			if !found {
+				t.Errorf("GET %s: expected %v, got %v", url, expected, got)
+			}
+		}
+	}
+
+	for _, url := range []string{"/logs?level=fatal", "/logs?labels=stage"} {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil))
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", url, err)
+		}
+		if resp.StatusCode != fiber.StatusBadRequest {
+			t.Errorf("GET %s: expected status %d, got %d", url, fiber.StatusBadRequest, resp.StatusCode)
+		}
+	}
+}
+
+func TestCreateLogBatch(t *testing.T) {
+	app := fiber.New()
+	handler := setupTestHandler(t)
+	natsContext := utils.NewNatsConn(&types.ServerConfig{
+		API:  types.APIConfig{Data: t.TempDir()},
+		NATS: types.NATSConfig{Port: -1},
+	})
+	t.Cleanup(natsContext.Shutdown)
+	handler.NatsCon = natsContext.NatsCon
+	live, err := natsContext.NatsCon.SubscribeSync("live.logs.batch1.builder")
+	if err != nil {
+		t.Fatalf("failed to subscribe to live logs: %v", err)
+	}
+	app.Post("/logs/batch", handler.CreateLogBatch)
+	app.Get("/logs", handler.GetLogs)
+
+	var body bytes.Buffer
+	for i, message := range []string{"compiling", "testing", "done"} {
+		line, _ := json.Marshal(types.Log{
+			RunID:     "batch1",
+			Driver:    "builder",
+			Pipeline:  "build",
+			Timestamp: types.FormatLogTimestamp(time.Unix(0, int64(i))),
+			Message:   message,
+		})
+		body.Write(line)
+		body.WriteString("\n\n")
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/logs/batch", &body)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("POST /logs/batch failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("expected status %d, got %d", fiber.StatusCreated, resp.StatusCode)
+	}
+	var created map[string]int
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if created["count"] != 3 {
+		t.Errorf("expected 3 logs created, got %d", created["count"])
+	}
+
+	// The logs are streamed to the clients watching the run
+	for _, message := range []string{"compiling", "testing", "done"} {
+		msg, err := live.NextMsg(time.Second)
+		if err != nil {
+			t.Fatalf("expected live log %q: %v", message, err)
+		}
+		var entry types.Log
+		if err := json.Unmarshal(msg.Data, &entry); err != nil || entry.Message != message {
+			t.Errorf("expected live log %q, got %s", message, msg.Data)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/logs?runid=batch1", nil)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("GET /logs failed: %v", err)
+	}
+	var logs []types.Log
+	if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(logs) != 3 || logs[0].Message != "compiling" || logs[2].Message != "done" {
+		t.Errorf("expected the batch in order, got %+v", logs)
+	}
+
+	// A batch with an invalid line is rejected as a whole
+	req = httptest.NewRequest(http.MethodPost, "/logs/batch", bytes.NewReader([]byte("{\"runid\":\"batch2\"}\nnot json\n")))
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("POST /logs/batch failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", fiber.StatusBadRequest, resp.StatusCode)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/logs?runid=batch2", nil)
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatalf("GET /logs failed: %v", err)
+	}
+	logs = nil
+	if err := json.NewDecoder(resp.Body).Decode(&logs); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(logs) != 0 {
+		t.Errorf("expected no logs of the rejected batch, got %d", len(logs))
+	}
+}
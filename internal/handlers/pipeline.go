@@ -33,7 +33,7 @@ func NewPipelineHandler(cli *clientv3.Client, natsCon *nats.Conn, db *badger.DB)
 // @Produce json
 // @Param pipeline body types.Pipeline true "Pipeline object"
 // @Success 201 {object} types.Pipeline "Pipeline created successfully"
-// @Failure 400 {object} map[string]interface{} "Bad request - Invalid payload"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid payload or resource selector"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /pipelines [post]
 func (h *PipelineHandler) CreatePipeline(c *fiber.Ctx) error {
@@ -43,6 +43,11 @@ func (h *PipelineHandler) CreatePipeline(c *fiber.Ctx) error {
 			"error": "Invalid request payload",
 		})
 	}
+	if _, err := types.ParseLabelSelector(pipeline.ResourceSelector); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid resource selector: %v", err),
+		})
+	}
 	// Validate that the resource definition exists
 	resourceDefinition, err := h.ResourceDefinitionModel.FindOne(pipeline.Resource)
 	if err != nil {
@@ -96,7 +101,7 @@ func (h *PipelineHandler) GetPipeline(c *fiber.Ctx) error {
 // @Param name path string true "Pipeline name"
 // @Param pipeline body types.Pipeline true "Updated pipeline object"
 // @Success 200 {object} types.Pipeline "Pipeline updated successfully"
-// @Failure 400 {object} map[string]interface{} "Bad request - Invalid payload"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid payload or resource selector"
 // @Failure 404 {object} map[string]interface{} "Not found - Pipeline does not exist"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /pipelines/{name} [put]
@@ -113,6 +118,11 @@ func (h *PipelineHandler) UpdatePipeline(c *fiber.Ctx) error {
 			"error": "Pipeline name in URL and body do not match",
 		})
 	}
+	if _, err := types.ParseLabelSelector(pipeline.ResourceSelector); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid resource selector: %v", err),
+		})
+	}
 	err := h.Model.UpdatePipeline(&pipeline)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -143,3 +153,25 @@ func (h *PipelineHandler) DeletePipeline(c *fiber.Ctx) error {
 	}
 	return c.SendStatus(fiber.StatusNoContent)
 }
+
+// ListPipelines lists all pipelines
+// @Summary List pipelines
+// @Description List all pipelines
+// @Tags pipelines
+// @Accept json
+// @Produce json
+// @Success 200 {array} types.Pipeline "List of pipelines"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /pipelines [get]
+func (h *PipelineHandler) ListPipelines(c *fiber.Ctx) error {
+	pipelines, err := h.Model.ListPipelines()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to list pipelines: %v", err),
+		})
+	}
+	if pipelines == nil {
+		pipelines = []*types.Pipeline{}
+	}
+	return c.Status(fiber.StatusOK).JSON(pipelines)
+}
@@ -2,11 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/dgraph-io/badger/v4"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/open-ug/conveyor/internal/config/auth"
 	"github.com/open-ug/conveyor/internal/engine"
 	models "github.com/open-ug/conveyor/internal/models"
 	utils "github.com/open-ug/conveyor/internal/utils"
@@ -14,6 +19,16 @@ import (
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
+const (
+	// defaultListLimit is the number of resources listed when the request sets no limit.
+	defaultListLimit = 100
+	// maxListLimit bounds the number of resources listed at once.
+	maxListLimit = 1000
+)
+
+// RunIDHeader carries the ID of the pipeline run an update triggered.
+const RunIDHeader = "X-Run-Id"
+
 type ResourceHandler struct {
 	PipelineModel           *models.PipelineModel
 	ResourceModel           *models.ResourceModel
@@ -60,9 +75,15 @@ func (h *ResourceHandler) CreateResource(c *fiber.Ctx) error {
 	}
 
 	resource.ID = uuid.New().String()
+	resource.ResourceVersion = ""
+	// The status is observed by drivers, it is updated through the status subresource
+	resource.Status = types.ResourceStatus{}
+	resource.DeletionTimestamp = nil
 	resource.Metadata = make(map[string]string)
 	// set version to 1
 	resource.Metadata["version"] = "1"
+	resource.Metadata[types.MetadataUpdatedAt] = time.Now().UTC().Format(time.RFC3339)
+	setAuthor(c, &resource)
 
 	resourceType := resource.Resource
 	if resourceType == "" {
@@ -71,6 +92,26 @@ func (h *ResourceHandler) CreateResource(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := validateLabelsAndAnnotations(resource); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err := types.ValidateFinalizers(resource.Finalizers); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err := h.resolveOwnerReferences(resource.Name, resourceType, resource.OwnerReferences); errors.Is(err, errInvalidOwner) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	resourceDefinition, err := h.ResourceDefinitionModel.FindOne(resourceType)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -129,6 +170,17 @@ func (h *ResourceHandler) CreateResource(c *fiber.Ctx) error {
 				"error": fmt.Sprintf("Resource type %s does not match pipeline resource type %s", resource.Resource, pipeline.Resource),
 			})
 		}
+	} else {
+		// Resources without a pipeline run the pipeline whose resource selector matches their labels
+		pipeline, err := h.PipelineModel.FindTriggered(resource)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": fmt.Sprintf("Failed to find pipelines: %v", err),
+			})
+		}
+		if pipeline != nil {
+			resource.Pipeline = pipeline.Name
+		}
 	}
 
 	resourceData, err := json.Marshal(resource)
@@ -146,7 +198,7 @@ func (h *ResourceHandler) CreateResource(c *fiber.Ctx) error {
 	}
 
 	// Publish resource creation event to NATS JetStream
-	run_id, err := engine.PublishResourceEvent("create", resource, h.NatsContext.JetStream)
+	run_id, err := engine.PublishResourceEvent(types.EventCreate, resource, h.NatsContext.JetStream)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": fmt.Sprintf("Failed to publish resource event: %v", err),
@@ -161,6 +213,46 @@ func (h *ResourceHandler) CreateResource(c *fiber.Ctx) error {
 	})
 }
 
+// validateLabelsAndAnnotations checks the user owned labels and annotations of a resource.
+func validateLabelsAndAnnotations(resource types.Resource) error {
+	if err := types.ValidateLabels(resource.Labels); err != nil {
+		return fmt.Errorf("Invalid labels: %v", err)
+	}
+	if err := types.ValidateAnnotations(resource.Annotations); err != nil {
+		return fmt.Errorf("Invalid annotations: %v", err)
+	}
+	return nil
+}
+
+// errInvalidOwner is returned for owner references that cannot be resolved to an owner.
+var errInvalidOwner = errors.New("Invalid owner references")
+
+/*
+resolveOwnerReferences checks that the owners of a resource exist, and sets the IDs of the references that
+have none, so an owner that is deleted and created again does not own the resource. Dependents of owners
+that don't exist would be deleted by the garbage collector right away.
+*/
+func (h *ResourceHandler) resolveOwnerReferences(resourceName string, resourceType string, references []types.OwnerReference) error {
+	if err := types.ValidateOwnerReferences(types.Resource{Name: resourceName, Resource: resourceType, OwnerReferences: references}); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidOwner, err)
+	}
+	for i, reference := range references {
+		owner, err := h.ResourceModel.FindOne(reference.Name, reference.Resource)
+		if errors.Is(err, models.ErrResourceNotFound) {
+			return fmt.Errorf("%w: owner %s of type %s not found", errInvalidOwner, reference.Name, reference.Resource)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to find owner: %v", err)
+		}
+		if reference.ID == "" {
+			references[i].ID = owner.ID
+		} else if !reference.Owns(owner) {
+			return fmt.Errorf("%w: owner %s of type %s has ID %s, not %s", errInvalidOwner, reference.Name, reference.Resource, owner.ID, reference.ID)
+		}
+	}
+	return nil
+}
+
 // GetResource retrieves a specific resource by name and type
 // @Summary Get a resource
 // @Description Retrieve a specific resource by its name and type
@@ -169,8 +261,11 @@ func (h *ResourceHandler) CreateResource(c *fiber.Ctx) error {
 // @Produce json
 // @Param type path string true "Resource type"
 // @Param name path string true "Resource name"
-// @Success 200 {object} types.Resource "Resource object"
+// @Param watch query bool false "Stream the changes of the resource instead, as SSE or NDJSON"
+// @Param revision query int false "Revision to resume a watch after"
+// @Success 200 {object} types.Resource "Resource object, its resource version is also sent as ETag"
 // @Failure 400 {object} map[string]interface{} "Bad request - Missing parameters"
+// @Failure 404 {object} map[string]interface{} "Resource not found"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /resources/{type}/{name} [get]
 func (h *ResourceHandler) GetResource(c *fiber.Ctx) error {
@@ -183,25 +278,33 @@ func (h *ResourceHandler) GetResource(c *fiber.Ctx) error {
 	}
 
 	resource, err := h.ResourceModel.FindOne(resourceName, resourceType)
+	if errors.Is(err, models.ErrResourceNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": fmt.Sprintf("Failed to find resource: %v", err),
 		})
 	}
 
+	c.Set(fiber.HeaderETag, etag(resource))
 	return c.JSON(resource)
 }
 
 // DeleteResource deletes a specific resource by name and type
 // @Summary Delete a resource
-// @Description Delete a specific resource by its name and type
+// @Description Delete a specific resource by its name and type. The drivers are sent a delete event. A resource without finalizers is removed along with its versions right away, a resource with finalizers is marked with a deletion timestamp and removed once its finalizers are removed. The dependents of the resource, the resources naming it in their owner_references, are deleted by the garbage collector.
 // @Tags resources
 // @Accept json
 // @Produce json
 // @Param type path string true "Resource type"
 // @Param name path string true "Resource name"
+// @Param propagation_policy query string false "background (default) deletes the resource right away and its dependents afterwards, foreground keeps the resource until its dependents are deleted"
+// @Success 202 {object} types.Resource "Resource marked for deletion, waiting for its finalizers"
 // @Success 204 {string} string "Resource deleted successfully"
-// @Failure 400 {object} map[string]interface{} "Bad request - Missing parameters"
+// @Failure 400 {object} map[string]interface{} "Bad request - Missing parameters or invalid propagation policy"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /resources/{type}/{name} [delete]
 func (h *ResourceHandler) DeleteResource(c *fiber.Ctx) error {
@@ -213,25 +316,135 @@ func (h *ResourceHandler) DeleteResource(c *fiber.Ctx) error {
 		})
 	}
 
-	err := h.ResourceModel.Delete(resourceName, resourceType)
+	policy := c.Query("propagation_policy", types.DeletionBackground)
+	if policy != types.DeletionBackground && policy != types.DeletionForeground {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid propagation policy %q, expected %s or %s", policy, types.DeletionBackground, types.DeletionForeground),
+		})
+	}
+
+	resource, started, err := h.ResourceModel.Delete(resourceName, resourceType, policy)
+	if errors.Is(err, models.ErrResourceNotFound) {
+		// Deleting a resource that does not exist is not an error
+		return c.SendStatus(fiber.StatusNoContent)
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": fmt.Sprintf("Failed to delete resource: %v", err),
 		})
 	}
 
+	if started {
+		// Let the drivers clean up what they made for the resource
+		if _, err := engine.PublishResourceEvent(types.EventDelete, resource, h.NatsContext.JetStream); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": fmt.Sprintf("Failed to publish resource event: %v", err),
+			})
+		}
+	}
+
+	if len(resource.Finalizers) > 0 {
+		c.Set(fiber.HeaderETag, etag(resource))
+		return c.Status(fiber.StatusAccepted).JSON(resource)
+	}
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
-// ListResources lists all resources of a specific type
+// AddResourceFinalizer adds a finalizer to a specific resource
+// @Summary Add a finalizer to a resource
+// @Description Add a finalizer to a resource, which keeps the resource when it is deleted until the finalizer is removed. Adding a finalizer the resource already has does nothing.
+// @Tags resources
+// @Accept json
+// @Produce json
+// @Param type path string true "Resource type"
+// @Param name path string true "Resource name"
+// @Param finalizer path string true "Finalizer, e.g. example.com/cleanup"
+// @Success 200 {object} types.Resource "Resource with the finalizer"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid finalizer"
+// @Failure 404 {object} map[string]interface{} "Resource not found"
+// @Failure 409 {object} map[string]interface{} "Conflict - The resource is being deleted"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /resources/{type}/{name}/finalizers/{finalizer} [put]
+func (h *ResourceHandler) AddResourceFinalizer(c *fiber.Ctx) error {
+	return h.modifyResourceFinalizers(c, h.ResourceModel.AddFinalizer)
+}
+
+// RemoveResourceFinalizer removes a finalizer from a specific resource
+// @Summary Remove a finalizer from a resource
+// @Description Remove a finalizer from a resource. A resource that is being deleted is removed along with its versions once its last finalizer is removed.
+// @Tags resources
+// @Accept json
+// @Produce json
+// @Param type path string true "Resource type"
+// @Param name path string true "Resource name"
+// @Param finalizer path string true "Finalizer, e.g. example.com/cleanup"
+// @Success 200 {object} types.Resource "Resource without the finalizer"
+// @Success 204 {string} string "Resource deleted, it was waiting for this finalizer"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid finalizer"
+// @Failure 404 {object} map[string]interface{} "Resource not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /resources/{type}/{name}/finalizers/{finalizer} [delete]
+func (h *ResourceHandler) RemoveResourceFinalizer(c *fiber.Ctx) error {
+	return h.modifyResourceFinalizers(c, h.ResourceModel.RemoveFinalizer)
+}
+
+// modifyResourceFinalizers adds or removes the finalizer of the request with modify.
+func (h *ResourceHandler) modifyResourceFinalizers(c *fiber.Ctx, modify func(name, resourceType, finalizer string) (types.Resource, error)) error {
+	resourceName := c.Params("name")
+	resourceType := c.Params("type")
+	finalizer := c.Params("+")
+	if resourceName == "" || resourceType == "" || finalizer == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Resource name, type and finalizer are required",
+		})
+	}
+	if err := types.ValidateFinalizers([]string{finalizer}); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	r, err := modify(resourceName, resourceType, finalizer)
+	if errors.Is(err, models.ErrResourceNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, models.ErrResourceDeleting) || errors.Is(err, models.ErrResourceConflict) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to update resource finalizers: %v", err),
+		})
+	}
+
+	if r.DeletionTimestamp != nil && len(r.Finalizers) == 0 {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+	c.Set(fiber.HeaderETag, etag(r))
+	return c.JSON(r)
+}
+
+// ListResources lists the resources of a specific type
 // @Summary List resources
-// @Description List all resources of a specific type
+// @Description List the current resources of a specific type ordered by name, a page at a time
 // @Tags resources
 // @Accept json
 // @Produce json
 // @Param type path string true "Resource type"
-// @Success 200 {array} types.Resource "List of resources"
-// @Failure 400 {object} map[string]interface{} "Bad request - Missing parameters"
+// @Param limit query int false "Maximum number of resources to return, 100 by default and at most 1000"
+// @Param continue query string false "Continue token of the previous page"
+// @Param sort query string false "Order of the resources, name (default) or -name for reverse order"
+// @Param pipeline query string false "Pipeline the resources reference"
+// @Param metadata query string false "Comma separated key=value metadata the resources must have"
+// @Param labels query string false "Label selector the resources must match, e.g. env=prod,team in (a,b),!legacy"
+// @Param watch query bool false "Stream the changes of the resources instead, as SSE or NDJSON"
+// @Param revision query int false "Revision to resume a watch after"
+// @Success 200 {object} types.ResourceList "Page of resources"
+// @Failure 400 {object} map[string]interface{} "Bad request - Missing parameters or invalid limit, sort, metadata or labels"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /resources/{type} [get]
 func (h *ResourceHandler) ListResources(c *fiber.Ctx) error {
@@ -242,27 +455,57 @@ func (h *ResourceHandler) ListResources(c *fiber.Ctx) error {
 		})
 	}
 
-	resources, err := h.ResourceModel.List(resourceType)
+	limit := c.QueryInt("limit", defaultListLimit)
+	if limit <= 0 || limit > maxListLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Limit must be between 1 and %d", maxListLimit),
+		})
+	}
+
+	opts := models.ResourceListOptions{After: c.Query("continue"), Limit: limit}
+	switch c.Query("sort", "name") {
+	case "name":
+	case "-name":
+		opts.Descending = true
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Sort must be name or -name",
+		})
+	}
+
+	filter, err := models.NewResourceFilter(c.Query("pipeline"), c.Query("metadata"), c.Query("labels"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	opts.Filter = filter
+
+	list, err := h.ResourceModel.List(resourceType, opts)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": fmt.Sprintf("Failed to list resources: %v", err),
 		})
 	}
 
-	return c.JSON(resources)
+	return c.JSON(list)
 }
 
 // UpdateResource updates a specific resource by name and type
 // @Summary Update a resource
-// @Description Update a specific resource by its name and type
+// @Description Update a specific resource by its name and type. Its status is left unchanged, it is updated through the status subresource.
 // @Tags resources
 // @Accept json
 // @Produce json
 // @Param type path string true "Resource type"
 // @Param name path string true "Resource name"
 // @Param resource body types.Resource true "Resource object"
+// @Param If-Match header string false "ETag of the resource the update is based on, takes precedence over resource_version"
+// @Param trigger query bool false "Run the pipeline of the resource for the new version, the run ID is sent in the X-Run-Id header"
 // @Success 200 {object} types.Resource "Resource updated successfully"
-// @Failure 400 {object} map[string]interface{} "Bad request - Invalid payload or missing parameters"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid payload, resource version or missing parameters"
+// @Failure 404 {object} map[string]interface{} "Resource not found"
+// @Failure 409 {object} map[string]interface{} "Conflict - The resource was modified since the given resource version, or is being deleted"
 // @Failure 500 {object} map[string]interface{} "Internal server error"
 // @Router /resources/{type}/{name} [put]
 func (h *ResourceHandler) UpdateResource(c *fiber.Ctx) error {
@@ -281,6 +524,21 @@ func (h *ResourceHandler) UpdateResource(c *fiber.Ctx) error {
 		})
 	}
 
+	if err := validateLabelsAndAnnotations(resource); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err := h.resolveOwnerReferences(resourceName, resourceType, resource.OwnerReferences); errors.Is(err, errInvalidOwner) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
 	resourceDefinition, err := h.ResourceDefinitionModel.FindOne(resourceType)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -322,16 +580,398 @@ func (h *ResourceHandler) UpdateResource(c *fiber.Ctx) error {
 		})
 	}
 
+	resource.ResourceVersion, err = requestResourceVersion(c, resource)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if resource.Metadata == nil {
+		resource.Metadata = make(map[string]string)
+	}
+	setAuthor(c, &resource)
+
 	r, err := h.ResourceModel.Update(resourceName, resourceType, resource)
+	if errors.Is(err, models.ErrResourceNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, models.ErrResourceConflict) || errors.Is(err, models.ErrResourceDeleting) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": fmt.Sprintf("Failed to update resource: %v", err),
 		})
 	}
 
+	trigger := c.QueryBool("trigger")
+	runID, err := h.publishUpdate(r, trigger)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to publish resource event: %v", err),
+		})
+	}
+	if trigger {
+		c.Set(RunIDHeader, runID)
+	}
+
+	c.Set(fiber.HeaderETag, etag(r))
+	return c.JSON(r)
+}
+
+// publishUpdate delivers an update event to the drivers of a resource. A pipeline run is only started when trigger
+// is set, so editing a resource does not run its pipeline. It returns the ID of the run of the event.
+func (h *ResourceHandler) publishUpdate(resource types.Resource, trigger bool) (string, error) {
+	if trigger {
+		return engine.PublishResourceEvent(types.EventUpdate, resource, h.NatsContext.JetStream)
+	}
+	return engine.PublishDriverEvent(types.EventUpdate, resource, h.NatsContext.JetStream)
+}
+
+// UpdateResourceStatus updates the status of a specific resource
+// @Summary Update the status of a resource
+// @Description Replace the status of a resource, such as its conditions, leaving its spec and version unchanged. Only the status and resource_version of the body are used.
+// @Tags resources
+// @Accept json
+// @Produce json
+// @Param type path string true "Resource type"
+// @Param name path string true "Resource name"
+// @Param resource body types.Resource true "Resource with the new status"
+// @Param If-Match header string false "ETag of the resource the update is based on, takes precedence over resource_version"
+// @Success 200 {object} types.Resource "Resource with the updated status"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid payload, status or resource version"
+// @Failure 404 {object} map[string]interface{} "Resource not found"
+// @Failure 409 {object} map[string]interface{} "Conflict - The resource was modified since the given resource version"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /resources/{type}/{name}/status [put]
+func (h *ResourceHandler) UpdateResourceStatus(c *fiber.Ctx) error {
+	resourceName := c.Params("name")
+	resourceType := c.Params("type")
+	if resourceName == "" || resourceType == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Resource name and type are required",
+		})
+	}
+
+	var resource types.Resource
+	if err := c.BodyParser(&resource); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request payload",
+		})
+	}
+	if err := types.ValidateStatus(resource.Status); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": fmt.Sprintf("Invalid status: %v", err),
+		})
+	}
+
+	resourceVersion, err := requestResourceVersion(c, resource)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	r, err := h.ResourceModel.UpdateStatus(resourceName, resourceType, resource.Status, resourceVersion)
+	if errors.Is(err, models.ErrResourceNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, models.ErrResourceConflict) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to update resource status: %v", err),
+		})
+	}
+
+	c.Set(fiber.HeaderETag, etag(r))
 	return c.JSON(r)
 }
 
+// requestResourceVersion returns the resource version an update is based on, from the If-Match header or the resource.
+// It is empty when the update is not based on a version.
+func requestResourceVersion(c *fiber.Ctx, resource types.Resource) (string, error) {
+	resourceVersion := resource.ResourceVersion
+	if ifMatch := c.Get(fiber.HeaderIfMatch); ifMatch != "" && ifMatch != "*" {
+		resourceVersion = strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`)
+	}
+	if resourceVersion != "" {
+		if _, err := strconv.ParseUint(resourceVersion, 10, 64); err != nil {
+			return "", fmt.Errorf("Invalid resource version %q", resourceVersion)
+		}
+	}
+	return resourceVersion, nil
+}
+
+// etag returns the ETag of a resource, its quoted resource version. It is sent back in If-Match to update the resource.
+func etag(resource types.Resource) string {
+	return `"` + resource.ResourceVersion + `"`
+}
+
+// setAuthor records who writes a version of a resource in its metadata, the author of the request.
+func setAuthor(c *fiber.Ctx, resource *types.Resource) {
+	if author := auth.Subject(c); author != "" {
+		resource.Metadata[types.MetadataUpdatedBy] = author
+	} else {
+		delete(resource.Metadata, types.MetadataUpdatedBy)
+	}
+}
+
+// ListResourceVersions lists the versions of a specific resource
+// @Summary List the versions of a resource
+// @Description List every version of a resource, oldest first, with when and by whom it was written
+// @Tags resources
+// @Accept json
+// @Produce json
+// @Param type path string true "Resource type"
+// @Param name path string true "Resource name"
+// @Success 200 {object} types.ResourceVersionList "Versions of the resource"
+// @Failure 400 {object} map[string]interface{} "Bad request - Missing parameters"
+// @Failure 404 {object} map[string]interface{} "Resource not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /resources/{type}/{name}/versions [get]
+func (h *ResourceHandler) ListResourceVersions(c *fiber.Ctx) error {
+	resourceName := c.Params("name")
+	resourceType := c.Params("type")
+	if resourceName == "" || resourceType == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Resource name and type are required",
+		})
+	}
+
+	versions, err := h.ResourceModel.ListVersions(resourceName, resourceType)
+	if errors.Is(err, models.ErrResourceNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to list resource versions: %v", err),
+		})
+	}
+
+	list := types.ResourceVersionList{Items: make([]types.ResourceVersionInfo, 0, len(versions))}
+	for _, version := range versions {
+		info := types.ResourceVersionInfo{UpdatedBy: version.Metadata[types.MetadataUpdatedBy]}
+		info.Version, _ = strconv.Atoi(version.Metadata["version"])
+		// Versions written before the time was recorded have none
+		info.UpdatedAt, _ = time.Parse(time.RFC3339, version.Metadata[types.MetadataUpdatedAt])
+		list.Items = append(list.Items, info)
+	}
+	return c.JSON(list)
+}
+
+// DiffResourceVersions compares two versions of a specific resource
+// @Summary Compare two versions of a resource
+// @Description List the changes of the spec and the metadata of a resource between two of its versions, as JSON Pointer paths with their old and new values
+// @Tags resources
+// @Accept json
+// @Produce json
+// @Param type path string true "Resource type"
+// @Param name path string true "Resource name"
+// @Param from query int true "Older version"
+// @Param to query int true "Newer version"
+// @Success 200 {object} types.ResourceDiff "Changes between the versions"
+// @Failure 400 {object} map[string]interface{} "Bad request - Missing parameters or invalid versions"
+// @Failure 404 {object} map[string]interface{} "Resource or version not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /resources/{type}/{name}/diff [get]
+func (h *ResourceHandler) DiffResourceVersions(c *fiber.Ctx) error {
+	resourceName := c.Params("name")
+	resourceType := c.Params("type")
+	if resourceName == "" || resourceType == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Resource name and type are required",
+		})
+	}
+
+	from, fromErr := strconv.Atoi(c.Query("from"))
+	to, toErr := strconv.Atoi(c.Query("to"))
+	if fromErr != nil || toErr != nil || from < 1 || to < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The from and to query parameters must be versions of the resource",
+		})
+	}
+
+	var versions [2]types.Resource
+	for i, version := range []int{from, to} {
+		resource, err := h.ResourceModel.FindByVersion(resourceName, resourceType, strconv.Itoa(version))
+		if errors.Is(err, models.ErrResourceNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": fmt.Sprintf("Failed to find resource: %v", err),
+			})
+		}
+		versions[i] = resource
+	}
+
+	changes, err := types.DiffResources(versions[0], versions[1])
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to compare resource versions: %v", err),
+		})
+	}
+	return c.JSON(types.ResourceDiff{From: from, To: to, Changes: changes})
+}
+
+// RollbackResource rolls a specific resource back to one of its versions
+// @Summary Roll a resource back to a version
+// @Description Create a new version of a resource with the spec, labels, annotations and pipeline of one of its versions. The status, finalizers and owner references of the resource are kept.
+// @Tags resources
+// @Accept json
+// @Produce json
+// @Param type path string true "Resource type"
+// @Param name path string true "Resource name"
+// @Param to query int true "Version to roll back to"
+// @Param trigger query bool false "Run the pipeline of the resource for the new version, drivers are notified either way"
+// @Param If-Match header string false "ETag of the resource the rollback is based on"
+// @Success 200 {object} types.RollbackResponse "Resource at its new version, and the run of the pipeline if triggered"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid version, or the version does not conform to the current schema"
+// @Failure 404 {object} map[string]interface{} "Resource or version not found"
+// @Failure 409 {object} map[string]interface{} "Conflict - The resource was modified since the given resource version, or is being deleted"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /resources/{type}/{name}/rollback [post]
+func (h *ResourceHandler) RollbackResource(c *fiber.Ctx) error {
+	resourceName := c.Params("name")
+	resourceType := c.Params("type")
+	if resourceName == "" || resourceType == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Resource name and type are required",
+		})
+	}
+	to, err := strconv.Atoi(c.Query("to"))
+	if err != nil || to < 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "The to query parameter must be a version of the resource",
+		})
+	}
+
+	target, err := h.ResourceModel.FindByVersion(resourceName, resourceType, strconv.Itoa(to))
+	if errors.Is(err, models.ErrResourceNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to find resource: %v", err),
+		})
+	}
+	current, err := h.ResourceModel.FindOne(resourceName, resourceType)
+	if errors.Is(err, models.ErrResourceNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to find resource: %v", err),
+		})
+	}
+
+	resource := current
+	resource.Spec = target.Spec
+	resource.Labels = target.Labels
+	resource.Annotations = target.Annotations
+	resource.Pipeline = target.Pipeline
+	resource.Metadata = target.Metadata
+	if resource.Metadata == nil {
+		resource.Metadata = make(map[string]string)
+	}
+	setAuthor(c, &resource)
+
+	// The schema may have changed since the version was written
+	if status, err := h.validateSchema(resource); err != nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Roll back the version that was read, unless the request names the version it is based on
+	resource.ResourceVersion, err = requestResourceVersion(c, types.Resource{ResourceVersion: current.ResourceVersion})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	r, err := h.ResourceModel.Update(resourceName, resourceType, resource)
+	if errors.Is(err, models.ErrResourceNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if errors.Is(err, models.ErrResourceConflict) || errors.Is(err, models.ErrResourceDeleting) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to roll back resource: %v", err),
+		})
+	}
+
+	// Drivers always learn about the new version, the pipeline only runs when triggered
+	trigger := c.QueryBool("trigger")
+	runID, err := h.publishUpdate(r, trigger)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to publish resource event: %v", err),
+		})
+	}
+	response := types.RollbackResponse{Resource: r}
+	if trigger {
+		response.RunID = runID
+	}
+
+	c.Set(fiber.HeaderETag, etag(r))
+	return c.JSON(response)
+}
+
+// validateSchema checks a resource against the schema of its resource definition. It returns the status code of the failure.
+func (h *ResourceHandler) validateSchema(resource types.Resource) (int, error) {
+	resourceDefinition, err := h.ResourceDefinitionModel.FindOne(resource.Resource)
+	if err != nil {
+		return fiber.StatusInternalServerError, fmt.Errorf("Failed to find resource definition: %v", err)
+	}
+	if resourceDefinition == nil {
+		return fiber.StatusNotFound, fmt.Errorf("Resource definition for type %s not found", resource.Resource)
+	}
+
+	var resourceDef types.ResourceDefinition
+	if err := json.Unmarshal(resourceDefinition, &resourceDef); err != nil {
+		return fiber.StatusInternalServerError, fmt.Errorf("Failed to unmarshal resource definition")
+	}
+	if resourceDef.Schema == nil {
+		return fiber.StatusBadRequest, fmt.Errorf("Resource definition schema is required")
+	}
+
+	isValid, err := utils.ValidateResource(resource, resourceDef)
+	if err != nil {
+		return fiber.StatusBadRequest, fmt.Errorf("Resource validation failed: %v", err)
+	}
+	if !isValid {
+		return fiber.StatusBadRequest, fmt.Errorf("Resource does not conform to the schema")
+	}
+	return fiber.StatusOK, nil
+}
+
 // GetResourceByVersion retrieves a specific resource by name, type, and version
 // @Summary Get a resource by version
 // @Description Retrieve a specific resource by its name, type, and version
@@ -357,6 +997,11 @@ func (h *ResourceHandler) GetResourceByVersion(c *fiber.Ctx) error {
 	}
 
 	resource, err := h.ResourceModel.FindByVersion(resourceName, resourceType, resourceVersion)
+	if errors.Is(err, models.ErrResourceNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": fmt.Sprintf("Failed to find resource: %v", err),
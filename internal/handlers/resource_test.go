@@ -2,16 +2,25 @@ package handlers_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/nats-io/nats.go/jetstream"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/open-ug/conveyor/internal/config"
 	"github.com/open-ug/conveyor/internal/config/initialize"
+	"github.com/open-ug/conveyor/internal/engine"
+	"github.com/open-ug/conveyor/internal/models"
+	driverruntime "github.com/open-ug/conveyor/pkg/driver-runtime"
 	"github.com/open-ug/conveyor/pkg/server"
 	"github.com/open-ug/conveyor/pkg/types"
 )
@@ -195,6 +204,63 @@ func Test_Resource_CRUD(t *testing.T) {
 		}
 	})
 
+	// --- List Resources ---
+	t.Run("list-resources", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/resources/"+resource.Resource+"?limit=10", nil)
+
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("list resources request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		respBody, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "expected 200 OK on list resources")
+
+		// Versions of the updated resource are not listed
+		var list types.ResourceList
+		if assert.NoError(t, json.Unmarshal(respBody, &list), "unmarshal list response") && assert.Len(t, list.Items, 1) {
+			assert.Equal(t, resource.Name, list.Items[0].Name)
+			assert.Empty(t, list.Continue)
+		}
+
+		req = httptest.NewRequest(http.MethodGet, "/resources/"+resource.Resource+"?limit=0", nil)
+		resp, err = app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("list resources request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "expected 400 Bad Request on invalid limit")
+
+		// The updated resource is at version 2
+		for query, want := range map[string]int{
+			"?sort=-name&metadata=version%3D2": 1,
+			"?metadata=version%3D1":            0,
+			"?pipeline=missing":                0,
+		} {
+			req = httptest.NewRequest(http.MethodGet, "/resources/"+resource.Resource+query, nil)
+			resp, err = app.Test(req, -1)
+			if err != nil {
+				t.Fatalf("list resources request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			respBody, _ := io.ReadAll(resp.Body)
+			var list types.ResourceList
+			if assert.Equal(t, http.StatusOK, resp.StatusCode, query) && assert.NoError(t, json.Unmarshal(respBody, &list)) {
+				assert.Len(t, list.Items, want, query)
+			}
+		}
+
+		req = httptest.NewRequest(http.MethodGet, "/resources/"+resource.Resource+"?sort=age", nil)
+		resp, err = app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("list resources request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "expected 400 Bad Request on invalid sort")
+	})
+
 	// --- Delete Resource ---
 	t.Run("delete-resource", func(t *testing.T) {
 		url := "/resources/" + resource.Resource + "/" + resource.Name
@@ -209,7 +275,7 @@ func Test_Resource_CRUD(t *testing.T) {
 		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "expected 204 No Content on delete resource")
 	})
 
-	// --- Get after delete (should fail based on current handler behavior) ---
+	// --- Get after delete ---
 	t.Run("get-after-delete", func(t *testing.T) {
 		url := "/resources/" + resource.Resource + "/" + resource.Name
 		req := httptest.NewRequest(http.MethodGet, url, nil)
@@ -220,10 +286,760 @@ func Test_Resource_CRUD(t *testing.T) {
 		}
 		defer resp.Body.Close()
 
-		// Current implementation returns 500 when FindOne fails / not found.
-		// If you change handler behavior to return 404, update this assertion accordingly.
-		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode, "expected 500 after deleted resource (handler's current behavior)")
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "expected 404 Not Found after deleted resource")
 	})
 
 	appctx.ShutDown()
 }
+
+// startTestAPI serves the API on a local port and returns its context, its URL and a client of it.
+func startTestAPI(t *testing.T) (server.APIServerContext, string, *driverruntime.Client) {
+	configFile, err := initialize.Run(&initialize.Options{
+		Force:   true,
+		TempDir: t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize config: %v", err)
+	}
+	config.LoadTestEnvConfig(configFile)
+
+	cfg, err := config.GetTestConfig()
+	if err != nil {
+		t.Fatalf("failed to get test config: %v", err)
+	}
+
+	appctx, err := server.Setup(&cfg)
+	if err != nil {
+		t.Fatalf("failed to setup api: %v", err)
+	}
+	t.Cleanup(appctx.ShutDown)
+	// Streams only notice that their client is gone on their next heartbeat
+	t.Cleanup(func() { appctx.App.ShutdownWithTimeout(time.Second) })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go appctx.App.Listener(listener)
+	apiURL := "http://" + listener.Addr().String()
+
+	client, err := driverruntime.NewClient(apiURL, "", driverruntime.ConfigOptions{})
+	require.NoError(t, err)
+	return appctx, apiURL, client
+}
+
+func Test_Resource_Watch(t *testing.T) {
+	_, apiURL, client := startTestAPI(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := client.CreateOrUpdateResourceDefinition(ctx, &types.ResourceDefinition{
+		Name:    "watched",
+		Version: "1.0.0",
+		Schema:  map[string]interface{}{"properties": map[string]interface{}{"image": map[string]interface{}{"type": "string"}}},
+	})
+	require.NoError(t, err)
+	for _, name := range []string{"app", "db"} {
+		client.DeleteResource(ctx, name, "watched")
+	}
+	_, err = client.CreateResource(ctx, &types.Resource{Name: "app", Resource: "watched", Spec: map[string]interface{}{"image": "nginx"}})
+	require.NoError(t, err)
+
+	list, err := client.ListResources(ctx, "watched", nil)
+	require.NoError(t, err)
+	require.NotZero(t, list.Revision)
+
+	// Changes after the list
+	_, err = client.UpdateResource(ctx, &types.Resource{Name: "app", Resource: "watched", Spec: map[string]interface{}{"image": "caddy"}})
+	require.NoError(t, err)
+	_, err = client.CreateResource(ctx, &types.Resource{Name: "db", Resource: "watched", Spec: map[string]interface{}{"image": "postgres"}})
+	require.NoError(t, err)
+	_, err = client.DeleteResource(ctx, "app", "watched")
+	require.NoError(t, err)
+
+	t.Run("watch resources", func(t *testing.T) {
+		var events []string
+		for event, err := range client.WatchResources(ctx, "watched", &driverruntime.WatchOptions{Revision: list.Revision}) {
+			require.NoError(t, err)
+			events = append(events, event.Type+" "+event.Resource.Name+" "+event.Resource.Spec.(map[string]interface{})["image"].(string))
+			if len(events) == 3 {
+				break
+			}
+		}
+		assert.Equal(t, []string{"MODIFIED app caddy", "ADDED db postgres", "DELETED app caddy"}, events)
+	})
+
+	t.Run("watch a resource", func(t *testing.T) {
+		for event, err := range client.WatchResources(ctx, "watched", &driverruntime.WatchOptions{Name: "db", Revision: list.Revision}) {
+			require.NoError(t, err)
+			assert.Equal(t, types.WatchAdded, event.Type)
+			assert.Equal(t, "db", event.Resource.Name)
+			break
+		}
+	})
+
+	t.Run("watch as ndjson", func(t *testing.T) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/resources/watched?watch=true&revision=%d", apiURL, list.Revision), nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept", "application/x-ndjson")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+		var event types.WatchEvent
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&event))
+		assert.Equal(t, types.WatchModified, event.Type)
+		assert.Greater(t, event.Revision, list.Revision)
+	})
+}
+
+func Test_Resource_Labels(t *testing.T) {
+	_, _, client := startTestAPI(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := client.CreateOrUpdateResourceDefinition(ctx, &types.ResourceDefinition{
+		Name:    "labeled",
+		Version: "1.0.0",
+		Schema:  map[string]interface{}{"properties": map[string]interface{}{"image": map[string]interface{}{"type": "string"}}},
+	})
+	require.NoError(t, err)
+	for _, name := range []string{"api", "billing", "legacy", "plain"} {
+		client.DeleteResource(ctx, name, "labeled")
+	}
+
+	_, err = client.CreatePipeline(ctx, &types.Pipeline{Name: "labeled-prod", Resource: "labeled", ResourceSelector: "env=prod,!legacy"})
+	require.NoError(t, err)
+	defer client.DeletePipeline(ctx, "labeled-prod")
+
+	resources := []types.Resource{
+		{Name: "api", Labels: map[string]string{"env": "prod", "example.com/team": "payments"}, Annotations: map[string]string{"owner": "Payments team <payments@example.com>"}},
+		{Name: "billing", Labels: map[string]string{"env": "staging", "example.com/team": "billing"}},
+		{Name: "legacy", Labels: map[string]string{"env": "prod", "legacy": ""}},
+		{Name: "plain"},
+	}
+	for _, resource := range resources {
+		resource.Resource = "labeled"
+		resource.Spec = map[string]interface{}{"image": "nginx"}
+		_, err := client.CreateResource(ctx, &resource)
+		require.NoError(t, err)
+	}
+
+	list := func(t *testing.T, selector string, descending bool) []string {
+		var names []string
+		opts := &driverruntime.ListOptions{Limit: 1, LabelSelector: selector, Descending: descending}
+		for {
+			list, err := client.ListResources(ctx, "labeled", opts)
+			require.NoError(t, err)
+			for _, resource := range list.Items {
+				names = append(names, resource.Name)
+			}
+			if list.Continue == "" {
+				return names
+			}
+			opts.Continue = list.Continue
+		}
+	}
+
+	t.Run("invalid labels", func(t *testing.T) {
+		var apiErr *driverruntime.APIError
+		_, err := client.CreateResource(ctx, &types.Resource{Name: "invalid", Resource: "labeled", Labels: map[string]string{"bad key": "x"}, Spec: map[string]interface{}{}})
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+
+		_, err = client.ListResources(ctx, "labeled", &driverruntime.ListOptions{LabelSelector: "env in (prod"})
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+
+		_, err = client.CreatePipeline(ctx, &types.Pipeline{Name: "labeled-invalid", Resource: "labeled", ResourceSelector: "env=="})
+		assert.NoError(t, err, "an empty value is valid")
+		client.DeletePipeline(ctx, "labeled-invalid")
+		_, err = client.CreatePipeline(ctx, &types.Pipeline{Name: "labeled-invalid", Resource: "labeled", ResourceSelector: "env=a b"})
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	})
+
+	t.Run("select resources", func(t *testing.T) {
+		for selector, want := range map[string][]string{
+			"":                                 {"api", "billing", "legacy", "plain"},
+			"env=prod":                         {"api", "legacy"},
+			"env in (prod,staging)":            {"api", "billing", "legacy"},
+			"env=prod,!legacy":                 {"api"},
+			"example.com/team notin (billing)": {"api", "legacy", "plain"},
+			"!env":                             {"plain"},
+			"env!=prod":                        {"billing", "plain"},
+			"example.com/team":                 {"api", "billing"},
+		} {
+			assert.Equal(t, want, list(t, selector, false), selector)
+		}
+		assert.Equal(t, []string{"legacy", "billing", "api"}, list(t, "env in (prod,staging)", true))
+	})
+
+	t.Run("annotations", func(t *testing.T) {
+		resource, err := client.GetResource(ctx, "api", "labeled")
+		require.NoError(t, err)
+		assert.Equal(t, "Payments team <payments@example.com>", resource.Annotations["owner"])
+	})
+
+	t.Run("pipeline triggers", func(t *testing.T) {
+		resource, err := client.GetResource(ctx, "api", "labeled")
+		require.NoError(t, err)
+		assert.Equal(t, "labeled-prod", resource.Pipeline)
+
+		resource, err = client.GetResource(ctx, "legacy", "labeled")
+		require.NoError(t, err)
+		assert.Empty(t, resource.Pipeline)
+	})
+
+	t.Run("label changes", func(t *testing.T) {
+		before, err := client.ListResources(ctx, "labeled", nil)
+		require.NoError(t, err)
+
+		_, err = client.UpdateResource(ctx, &types.Resource{Name: "api", Resource: "labeled", Labels: map[string]string{"env": "staging"}, Spec: map[string]interface{}{"image": "caddy"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"legacy"}, list(t, "env=prod", false))
+		assert.Equal(t, []string{"api", "billing"}, list(t, "env=staging", false))
+
+		_, err = client.DeleteResource(ctx, "billing", "labeled")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"api"}, list(t, "env=staging", false))
+
+		// The resource left the selection when its labels changed
+		for event, err := range client.WatchResources(ctx, "labeled", &driverruntime.WatchOptions{Revision: before.Revision, LabelSelector: "env=prod"}) {
+			require.NoError(t, err)
+			assert.Equal(t, types.WatchDeleted, event.Type)
+			assert.Equal(t, "api", event.Resource.Name)
+			break
+		}
+	})
+}
+
+func Test_Resource_Concurrency(t *testing.T) {
+	_, apiURL, client := startTestAPI(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := client.CreateOrUpdateResourceDefinition(ctx, &types.ResourceDefinition{
+		Name:    "versioned",
+		Version: "1.0.0",
+		Schema:  map[string]interface{}{"properties": map[string]interface{}{"image": map[string]interface{}{"type": "string"}}},
+	})
+	require.NoError(t, err)
+	client.DeleteResource(ctx, "app", "versioned")
+	_, err = client.CreateResource(ctx, &types.Resource{Name: "app", Resource: "versioned", Spec: map[string]interface{}{"image": "nginx"}})
+	require.NoError(t, err)
+
+	put := func(t *testing.T, ifMatch string) int {
+		body, _ := json.Marshal(types.Resource{Name: "app", Resource: "versioned", Spec: map[string]interface{}{"image": "caddy"}})
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, apiURL+"/resources/versioned/app", bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	t.Run("resource versions", func(t *testing.T) {
+		resource, err := client.GetResource(ctx, "app", "versioned")
+		require.NoError(t, err)
+		require.NotEmpty(t, resource.ResourceVersion)
+
+		resource.Spec = map[string]interface{}{"image": "caddy"}
+		updated, err := client.UpdateResource(ctx, resource)
+		require.NoError(t, err)
+		assert.NotEqual(t, resource.ResourceVersion, updated.ResourceVersion)
+
+		// The update was based on a stale version
+		_, err = client.UpdateResource(ctx, resource)
+		assert.True(t, driverruntime.IsConflict(err), "expected a conflict, got %v", err)
+
+		// Updates without a version are not checked
+		_, err = client.UpdateResource(ctx, &types.Resource{Name: "app", Resource: "versioned", Spec: map[string]interface{}{"image": "nginx"}})
+		assert.NoError(t, err)
+
+		_, err = client.UpdateResource(ctx, &types.Resource{Name: "missing", Resource: "versioned", Spec: map[string]interface{}{}})
+		assert.True(t, driverruntime.IsNotFound(err), "expected not found, got %v", err)
+	})
+
+	t.Run("if-match", func(t *testing.T) {
+		resp, err := http.Get(apiURL + "/resources/versioned/app")
+		require.NoError(t, err)
+		resp.Body.Close()
+		etag := resp.Header.Get("ETag")
+		require.NotEmpty(t, etag)
+
+		assert.Equal(t, http.StatusOK, put(t, etag))
+		assert.Equal(t, http.StatusConflict, put(t, etag))
+		assert.Equal(t, http.StatusOK, put(t, "*"))
+		assert.Equal(t, http.StatusBadRequest, put(t, `"latest"`))
+	})
+
+	t.Run("concurrent updates", func(t *testing.T) {
+		resource, err := client.GetResource(ctx, "app", "versioned")
+		require.NoError(t, err)
+
+		// Writers that read the same version race, only one of them wins
+		results := make(chan error)
+		for i := range 8 {
+			go func() {
+				update := *resource
+				update.Spec = map[string]interface{}{"image": fmt.Sprintf("nginx:%d", i)}
+				_, err := client.UpdateResource(ctx, &update)
+				results <- err
+			}()
+		}
+		succeeded := 0
+		for range 8 {
+			if err := <-results; err == nil {
+				succeeded++
+			} else {
+				assert.True(t, driverruntime.IsConflict(err), "expected a conflict, got %v", err)
+			}
+		}
+		assert.Equal(t, 1, succeeded)
+	})
+}
+
+func Test_Resource_Status(t *testing.T) {
+	appctx, _, client := startTestAPI(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := client.CreateOrUpdateResourceDefinition(ctx, &types.ResourceDefinition{
+		Name:    "observed",
+		Version: "1.0.0",
+		Schema:  map[string]interface{}{"properties": map[string]interface{}{"image": map[string]interface{}{"type": "string"}}},
+	})
+	require.NoError(t, err)
+	client.DeleteResource(ctx, "app", "observed")
+
+	// The status cannot be set with the resource
+	_, err = client.CreateResource(ctx, &types.Resource{
+		Name: "app", Resource: "observed", Spec: map[string]interface{}{"image": "nginx"},
+		Status: types.ResourceStatus{ObservedGeneration: 7},
+	})
+	require.NoError(t, err)
+	resource, err := client.GetResource(ctx, "app", "observed")
+	require.NoError(t, err)
+	assert.Zero(t, resource.Status)
+
+	var readySince time.Time
+	t.Run("update status", func(t *testing.T) {
+		resource.Status.ObservedGeneration = 1
+		resource.Status.SetCondition(types.Condition{Type: "Ready", Status: types.ConditionFalse, Reason: "Deploying"})
+		updated, err := client.UpdateResourceStatus(ctx, resource)
+		require.NoError(t, err)
+		assert.Equal(t, "1", updated.Metadata["version"], "status updates keep the version")
+		assert.NotEqual(t, resource.ResourceVersion, updated.ResourceVersion)
+
+		// The status was read at a stale version
+		_, err = client.UpdateResourceStatus(ctx, resource)
+		assert.True(t, driverruntime.IsConflict(err), "expected a conflict, got %v", err)
+
+		// The transition time is kept while the status of the condition does not change
+		ready := updated.Status.FindCondition("Ready")
+		require.NotNil(t, ready)
+		readySince = ready.LastTransitionTime
+		updated.Status.Conditions[0].Message = "Waiting for 2 replicas"
+		updated, err = client.UpdateResourceStatus(ctx, updated)
+		require.NoError(t, err)
+		assert.True(t, readySince.Equal(updated.Status.FindCondition("Ready").LastTransitionTime))
+		assert.Equal(t, "Waiting for 2 replicas", updated.Status.FindCondition("Ready").Message)
+
+		updated.Status.Conditions[0].Status = types.ConditionTrue
+		updated, err = client.UpdateResourceStatus(ctx, updated)
+		require.NoError(t, err)
+		assert.True(t, updated.Status.FindCondition("Ready").LastTransitionTime.After(readySince))
+	})
+
+	t.Run("updates keep the status", func(t *testing.T) {
+		updated, err := client.UpdateResource(ctx, &types.Resource{Name: "app", Resource: "observed", Spec: map[string]interface{}{"image": "caddy"}})
+		require.NoError(t, err)
+		assert.Equal(t, "2", updated.Metadata["version"])
+		assert.Equal(t, int64(1), updated.Status.ObservedGeneration)
+		assert.Equal(t, types.ConditionTrue, updated.Status.FindCondition("Ready").Status)
+	})
+
+	t.Run("driver results", func(t *testing.T) {
+		resourceModel := models.NewResourceModel(appctx.ETCD.Client, nil)
+		require.NoError(t, resourceModel.SaveDriverResult("app", "observed", "deployer", types.DriverResult{Success: true, Message: "deployed"}, 2))
+
+		resource, err := client.GetResource(ctx, "app", "observed")
+		require.NoError(t, err)
+		assert.Equal(t, "2", resource.Metadata["version"])
+		assert.Equal(t, int64(2), resource.Status.ObservedGeneration)
+		assert.Equal(t, "deployed", resource.Status.DriverResults["deployer"].Message)
+		assert.NotNil(t, resource.Status.FindCondition("Ready"), "saving driver results keeps the conditions")
+	})
+
+	t.Run("invalid status", func(t *testing.T) {
+		var apiErr *driverruntime.APIError
+		_, err := client.UpdateResourceStatus(ctx, &types.Resource{Name: "app", Resource: "observed", Status: types.ResourceStatus{
+			Conditions: []types.Condition{{Type: "Ready", Status: "yes"}},
+		}})
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+
+		_, err = client.UpdateResourceStatus(ctx, &types.Resource{Name: "missing", Resource: "observed"})
+		assert.True(t, driverruntime.IsNotFound(err), "expected not found, got %v", err)
+	})
+}
+
+func Test_Resource_Finalizers(t *testing.T) {
+	_, _, client := startTestAPI(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := client.CreateOrUpdateResourceDefinition(ctx, &types.ResourceDefinition{
+		Name:    "finalized",
+		Version: "1.0.0",
+		Schema:  map[string]interface{}{"properties": map[string]interface{}{"image": map[string]interface{}{"type": "string"}}},
+	})
+	require.NoError(t, err)
+	client.DeleteResource(ctx, "app", "finalized")
+	client.RemoveFinalizer(ctx, "finalized", "app", "example.com/cleanup")
+	client.DeleteResource(ctx, "plain", "finalized")
+
+	_, err = client.CreateResource(ctx, &types.Resource{Name: "app", Resource: "finalized", Spec: map[string]interface{}{"image": "nginx"}})
+	require.NoError(t, err)
+	_, err = client.UpdateResource(ctx, &types.Resource{Name: "app", Resource: "finalized", Spec: map[string]interface{}{"image": "caddy"}})
+	require.NoError(t, err)
+
+	t.Run("add finalizer", func(t *testing.T) {
+		resource, err := client.AddFinalizer(ctx, "finalized", "app", "example.com/cleanup")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"example.com/cleanup"}, resource.Finalizers)
+
+		// Adding it again does nothing
+		resource, err = client.AddFinalizer(ctx, "finalized", "app", "example.com/cleanup")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"example.com/cleanup"}, resource.Finalizers)
+
+		// Updates keep the finalizers
+		updated, err := client.UpdateResource(ctx, &types.Resource{Name: "app", Resource: "finalized", Spec: map[string]interface{}{"image": "httpd"}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"example.com/cleanup"}, updated.Finalizers)
+
+		var apiErr *driverruntime.APIError
+		_, err = client.AddFinalizer(ctx, "finalized", "app", "-invalid")
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+		_, err = client.AddFinalizer(ctx, "finalized", "missing", "example.com/cleanup")
+		assert.True(t, driverruntime.IsNotFound(err), "expected not found, got %v", err)
+	})
+
+	t.Run("delete waits for finalizers", func(t *testing.T) {
+		_, err := client.DeleteResource(ctx, "app", "finalized")
+		require.NoError(t, err)
+
+		resource, err := client.GetResource(ctx, "app", "finalized")
+		require.NoError(t, err)
+		require.NotNil(t, resource.DeletionTimestamp)
+		assert.Equal(t, []string{"example.com/cleanup"}, resource.Finalizers)
+
+		// Deleting again keeps the deletion timestamp
+		_, err = client.DeleteResource(ctx, "app", "finalized")
+		require.NoError(t, err)
+		again, err := client.GetResource(ctx, "app", "finalized")
+		require.NoError(t, err)
+		assert.True(t, resource.DeletionTimestamp.Equal(*again.DeletionTimestamp))
+
+		// A resource that is being deleted cannot be changed or given more finalizers
+		_, err = client.UpdateResource(ctx, &types.Resource{Name: "app", Resource: "finalized", Spec: map[string]interface{}{"image": "caddy"}})
+		assert.True(t, driverruntime.IsConflict(err), "expected a conflict, got %v", err)
+		_, err = client.AddFinalizer(ctx, "finalized", "app", "example.com/other")
+		assert.True(t, driverruntime.IsConflict(err), "expected a conflict, got %v", err)
+	})
+
+	t.Run("removing the last finalizer purges the resource", func(t *testing.T) {
+		_, err := client.RemoveFinalizer(ctx, "finalized", "app", "example.com/cleanup")
+		require.NoError(t, err)
+
+		_, err = client.GetResource(ctx, "app", "finalized")
+		assert.True(t, driverruntime.IsNotFound(err), "expected not found, got %v", err)
+		_, err = client.GetResourceVersion(ctx, "app", "finalized", "1")
+		assert.True(t, driverruntime.IsNotFound(err), "expected the versions to be purged, got %v", err)
+	})
+
+	t.Run("delete without finalizers", func(t *testing.T) {
+		_, err := client.CreateResource(ctx, &types.Resource{Name: "plain", Resource: "finalized", Spec: map[string]interface{}{"image": "nginx"}})
+		require.NoError(t, err)
+
+		_, err = client.DeleteResource(ctx, "plain", "finalized")
+		require.NoError(t, err)
+		_, err = client.GetResource(ctx, "plain", "finalized")
+		assert.True(t, driverruntime.IsNotFound(err), "expected not found, got %v", err)
+		_, err = client.GetResourceVersion(ctx, "plain", "finalized", "1")
+		assert.True(t, driverruntime.IsNotFound(err), "expected the versions to be purged, got %v", err)
+	})
+}
+
+func Test_Resource_OwnerReferences(t *testing.T) {
+	appctx, _, client := startTestAPI(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, name := range []string{"release", "deployment"} {
+		_, err := client.CreateOrUpdateResourceDefinition(ctx, &types.ResourceDefinition{
+			Name:    name,
+			Version: "1.0.0",
+			Schema:  map[string]interface{}{"properties": map[string]interface{}{"image": map[string]interface{}{"type": "string"}}},
+		})
+		require.NoError(t, err)
+	}
+	gc := engine.NewEngineContext(appctx.ETCD.Client, appctx.LogModel, *appctx.NatsContext, appctx.BadgerDB).NewGarbageCollector()
+	for _, name := range []string{"v1", "v2"} {
+		client.DeleteResource(ctx, name, "release")
+	}
+	require.NoError(t, gc.Collect())
+	require.NoError(t, gc.Collect())
+
+	createRelease := func(t *testing.T, name string) *types.Resource {
+		_, err := client.CreateResource(ctx, &types.Resource{Name: name, Resource: "release", Spec: map[string]interface{}{}})
+		require.NoError(t, err)
+		_, err = client.CreateResource(ctx, &types.Resource{
+			Name: "web-" + name, Resource: "deployment", Spec: map[string]interface{}{"image": "nginx"},
+			OwnerReferences: []types.OwnerReference{{Resource: "release", Name: name}},
+		})
+		require.NoError(t, err)
+		release, err := client.GetResource(ctx, name, "release")
+		require.NoError(t, err)
+		return release
+	}
+
+	t.Run("owner references", func(t *testing.T) {
+		release := createRelease(t, "v1")
+		deployment, err := client.GetResource(ctx, "web-v1", "deployment")
+		require.NoError(t, err)
+		assert.Equal(t, []types.OwnerReference{{Resource: "release", Name: "v1", ID: release.ID}}, deployment.OwnerReferences)
+
+		var apiErr *driverruntime.APIError
+		_, err = client.CreateResource(ctx, &types.Resource{
+			Name: "orphan", Resource: "deployment", Spec: map[string]interface{}{},
+			OwnerReferences: []types.OwnerReference{{Resource: "release", Name: "missing"}},
+		})
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+
+		deployment.OwnerReferences[0].ID = "another"
+		_, err = client.UpdateResource(ctx, deployment)
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+
+		_, err = client.DeleteResourceWithOptions(ctx, "v1", "release", &driverruntime.DeleteOptions{PropagationPolicy: "eventually"})
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	})
+
+	t.Run("foreground deletion", func(t *testing.T) {
+		_, err := client.DeleteResourceWithOptions(ctx, "v1", "release", &driverruntime.DeleteOptions{PropagationPolicy: types.DeletionForeground})
+		require.NoError(t, err)
+		release, err := client.GetResource(ctx, "v1", "release")
+		require.NoError(t, err)
+		require.NotNil(t, release.DeletionTimestamp)
+		assert.Equal(t, []string{types.FinalizerForegroundDeletion}, release.Finalizers)
+
+		// The release is kept until its deployment is deleted
+		require.NoError(t, gc.Collect())
+		_, err = client.GetResource(ctx, "web-v1", "deployment")
+		assert.True(t, driverruntime.IsNotFound(err), "expected the deployment to be deleted, got %v", err)
+		_, err = client.GetResource(ctx, "v1", "release")
+		require.NoError(t, err)
+
+		require.NoError(t, gc.Collect())
+		_, err = client.GetResource(ctx, "v1", "release")
+		assert.True(t, driverruntime.IsNotFound(err), "expected the release to be deleted, got %v", err)
+	})
+
+	t.Run("background deletion", func(t *testing.T) {
+		createRelease(t, "v2")
+		_, err := client.DeleteResource(ctx, "v2", "release")
+		require.NoError(t, err)
+		_, err = client.GetResource(ctx, "v2", "release")
+		assert.True(t, driverruntime.IsNotFound(err), "expected the release to be deleted, got %v", err)
+
+		// The deployment is deleted afterwards
+		_, err = client.GetResource(ctx, "web-v2", "deployment")
+		require.NoError(t, err)
+		require.NoError(t, gc.Collect())
+		_, err = client.GetResource(ctx, "web-v2", "deployment")
+		assert.True(t, driverruntime.IsNotFound(err), "expected the deployment to be deleted, got %v", err)
+	})
+}
+
+func Test_Resource_Versions(t *testing.T) {
+	appctx, _, client := startTestAPI(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := client.CreateOrUpdateResourceDefinition(ctx, &types.ResourceDefinition{
+		Name:    "versioned",
+		Version: "1.0.0",
+		Schema:  map[string]interface{}{"properties": map[string]interface{}{"image": map[string]interface{}{"type": "string"}}},
+	})
+	require.NoError(t, err)
+	client.DeleteResource(ctx, "app", "versioned")
+
+	_, err = client.CreateResource(ctx, &types.Resource{Name: "app", Resource: "versioned", Spec: map[string]interface{}{"image": "nginx"}})
+	require.NoError(t, err)
+	for _, image := range []string{"caddy", "httpd"} {
+		_, err = client.UpdateResource(ctx, &types.Resource{
+			Name: "app", Resource: "versioned", Spec: map[string]interface{}{"image": image},
+			Labels: map[string]string{"image": image},
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("list versions", func(t *testing.T) {
+		versions, err := client.ListResourceVersions(ctx, "app", "versioned")
+		require.NoError(t, err)
+		require.Len(t, versions.Items, 3)
+		for i, version := range versions.Items {
+			assert.Equal(t, i+1, version.Version)
+			assert.WithinDuration(t, time.Now(), version.UpdatedAt, time.Minute)
+			assert.Empty(t, version.UpdatedBy, "requests are not authenticated")
+		}
+
+		_, err = client.ListResourceVersions(ctx, "missing", "versioned")
+		assert.True(t, driverruntime.IsNotFound(err), "expected not found, got %v", err)
+	})
+
+	t.Run("diff", func(t *testing.T) {
+		diff, err := client.DiffResourceVersions(ctx, "app", "versioned", 1, 3)
+		require.NoError(t, err)
+		assert.Equal(t, 1, diff.From)
+		assert.Equal(t, 3, diff.To)
+		assert.Contains(t, diff.Changes, types.FieldChange{Path: "/spec/image", Operation: types.ChangeModified, From: "nginx", To: "httpd"})
+		assert.Contains(t, diff.Changes, types.FieldChange{Path: "/metadata/version", Operation: types.ChangeModified, From: "1", To: "3"})
+
+		_, err = client.DiffResourceVersions(ctx, "app", "versioned", 1, 9)
+		assert.True(t, driverruntime.IsNotFound(err), "expected not found, got %v", err)
+		_, err = client.DiffResourceVersions(ctx, "app", "versioned", 0, 2)
+		var apiErr *driverruntime.APIError
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		consumer, err := appctx.NatsContext.JetStream.OrderedConsumer(ctx, "messages", jetstream.OrderedConsumerConfig{
+			FilterSubjects: []string{"resources.versioned"},
+		})
+		require.NoError(t, err)
+
+		rollback, err := client.RollbackResource(ctx, "app", "versioned", 1, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "4", rollback.Resource.Metadata["version"])
+		assert.Equal(t, "nginx", rollback.Resource.Spec.(map[string]interface{})["image"])
+		assert.Empty(t, rollback.Resource.Labels)
+		assert.Empty(t, rollback.RunID)
+
+		// Drivers are told about the new version without a trigger
+		msg, err := consumer.Next(jetstream.FetchMaxWait(5 * time.Second))
+		require.NoError(t, err)
+		var message types.DriverMessage
+		require.NoError(t, json.Unmarshal(msg.Data(), &message))
+		assert.Equal(t, types.EventUpdate, message.Event)
+		var notified types.Resource
+		require.NoError(t, json.Unmarshal([]byte(message.Payload), &notified))
+		assert.Equal(t, "4", notified.Metadata["version"])
+
+		// The older versions are kept
+		resource, err := client.GetResourceVersion(ctx, "app", "versioned", "3")
+		require.NoError(t, err)
+		assert.Equal(t, "httpd", resource.Spec.(map[string]interface{})["image"])
+
+		rollback, err = client.RollbackResource(ctx, "app", "versioned", 2, &driverruntime.RollbackOptions{Trigger: true})
+		require.NoError(t, err)
+		assert.Equal(t, "5", rollback.Resource.Metadata["version"])
+		assert.Equal(t, map[string]string{"image": "caddy"}, rollback.Resource.Labels)
+		assert.NotEmpty(t, rollback.RunID)
+
+		_, err = client.RollbackResource(ctx, "app", "versioned", 42, nil)
+		assert.True(t, driverruntime.IsNotFound(err), "expected not found, got %v", err)
+	})
+}
+
+func Test_Resource_UpdateEvent(t *testing.T) {
+	appctx, _, client := startTestAPI(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := client.CreateOrUpdateResourceDefinition(ctx, &types.ResourceDefinition{
+		Name:    "updated",
+		Version: "1.0.0",
+		Schema:  map[string]interface{}{"properties": map[string]interface{}{"image": map[string]interface{}{"type": "string"}}},
+	})
+	require.NoError(t, err)
+	client.DeleteResource(ctx, "app", "updated")
+
+	// Messages are only kept while a consumer is interested in them
+	consumer, err := appctx.NatsContext.JetStream.OrderedConsumer(ctx, "messages", jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{"resources.updated"},
+	})
+	require.NoError(t, err)
+
+	_, err = client.CreateResource(ctx, &types.Resource{Name: "app", Resource: "updated", Spec: map[string]interface{}{"image": "nginx"}})
+	require.NoError(t, err)
+	_, err = client.UpdateResource(ctx, &types.Resource{Name: "app", Resource: "updated", Spec: map[string]interface{}{"image": "caddy"}})
+	require.NoError(t, err)
+
+	// Drivers are told about the creation, then the update
+	var events []string
+	var message types.DriverMessage
+	for range 2 {
+		msg, err := consumer.Next(jetstream.FetchMaxWait(5 * time.Second))
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(msg.Data(), &message))
+		events = append(events, message.Event)
+	}
+	assert.Equal(t, []string{types.EventCreate, types.EventUpdate}, events)
+
+	var resource types.Resource
+	require.NoError(t, json.Unmarshal([]byte(message.Payload), &resource))
+	assert.Equal(t, "caddy", resource.Spec.(map[string]interface{})["image"])
+	assert.Equal(t, "2", resource.Metadata["version"])
+	assert.NotEmpty(t, message.RunID)
+}
+
+func Test_Resource_UpdateTrigger(t *testing.T) {
+	appctx, _, client := startTestAPI(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := client.CreateOrUpdateResourceDefinition(ctx, &types.ResourceDefinition{
+		Name:    "triggered",
+		Version: "1.0.0",
+		Schema:  map[string]interface{}{"properties": map[string]interface{}{"image": map[string]interface{}{"type": "string"}}},
+	})
+	require.NoError(t, err)
+	client.DeletePipeline(ctx, "triggered-deploy")
+	_, err = client.CreatePipeline(ctx, &types.Pipeline{Name: "triggered-deploy", Resource: "triggered"})
+	require.NoError(t, err)
+	client.DeleteResource(ctx, "app", "triggered")
+	_, err = client.CreateResource(ctx, &types.Resource{Name: "app", Resource: "triggered", Pipeline: "triggered-deploy", Spec: map[string]interface{}{"image": "nginx"}})
+	require.NoError(t, err)
+
+	consumer, err := appctx.NatsContext.JetStream.OrderedConsumer(ctx, "messages", jetstream.OrderedConsumerConfig{
+		FilterSubjects: []string{"resources.triggered"},
+	})
+	require.NoError(t, err)
+
+	// A plain update goes to the drivers, without starting a pipeline run
+	_, runID, err := client.UpdateResourceWithOptions(ctx, &types.Resource{Name: "app", Resource: "triggered", Pipeline: "triggered-deploy", Spec: map[string]interface{}{"image": "caddy"}}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, runID)
+
+	msg, err := consumer.Next(jetstream.FetchMaxWait(5 * time.Second))
+	require.NoError(t, err)
+	var message types.DriverMessage
+	require.NoError(t, json.Unmarshal(msg.Data(), &message))
+	assert.Equal(t, types.EventUpdate, message.Event)
+	assert.Empty(t, message.Step)
+
+	// A triggered update starts a run of the pipeline
+	resource, runID, err := client.UpdateResourceWithOptions(ctx, &types.Resource{Name: "app", Resource: "triggered", Pipeline: "triggered-deploy", Spec: map[string]interface{}{"image": "httpd"}}, &driverruntime.UpdateOptions{Trigger: true})
+	require.NoError(t, err)
+	assert.Equal(t, "3", resource.Metadata["version"])
+	assert.NotEmpty(t, runID)
+}
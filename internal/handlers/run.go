@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/open-ug/conveyor/internal/models"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+type RunHandler struct {
+	Model   *models.RunModel
+	NatsCon *nats.Conn
+}
+
+func NewRunHandler(cli *clientv3.Client, natsCon *nats.Conn) *RunHandler {
+	return &RunHandler{
+		Model:   models.NewRunModel(cli),
+		NatsCon: natsCon,
+	}
+}
+
+// GetRun retrieves the record of a run
+// @Summary Get a run
+// @Description Returns the run record with the state and last reported progress of every step
+// @Tags runs
+// @Accept json
+// @Produce json
+// @Param runid path string true "Run ID"
+// @Success 200 {object} types.Run "Run record"
+// @Failure 404 {object} map[string]interface{} "Run not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /runs/{runid} [get]
+func (h *RunHandler) GetRun(c *fiber.Ctx) error {
+	runID := c.Params("runid")
+
+	run, err := h.Model.FindOne(runID)
+	if errors.Is(err, models.ErrRunNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": fmt.Sprintf("Run %s not found", runID),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to get run: %v", err),
+		})
+	}
+
+	return c.JSON(run)
+}
+
+// CancelRun cancels a run
+// @Summary Cancel a run
+// @Description Cancels the in-flight reconciles of a run. The drivers stop their work and report the step as failed.
+// @Tags runs
+// @Accept json
+// @Produce json
+// @Param runid path string true "Run ID"
+// @Success 202 {object} map[string]interface{} "Cancellation requested"
+// @Failure 404 {object} map[string]interface{} "Run not found"
+// @Failure 500 {object} map[string]interface{} "Internal server error"
+// @Router /runs/{runid}/cancel [post]
+func (h *RunHandler) CancelRun(c *fiber.Ctx) error {
+	runID := c.Params("runid")
+
+	if _, err := h.Model.FindOne(runID); errors.Is(err, models.ErrRunNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": fmt.Sprintf("Run %s not found", runID),
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to get run: %v", err),
+		})
+	}
+
+	// Driver managers cancel the reconciles of the run they are running
+	if err := h.NatsCon.Publish("runs.cancel."+runID, nil); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to cancel run: %v", err),
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": fmt.Sprintf("Run %s is being cancelled", runID),
+	})
+}
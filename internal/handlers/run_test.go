@@ -0,0 +1,123 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/open-ug/conveyor/internal/config"
+	"github.com/open-ug/conveyor/internal/config/initialize"
+	"github.com/open-ug/conveyor/internal/models"
+	"github.com/open-ug/conveyor/pkg/server"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+func Test_Run_Get(t *testing.T) {
+	configFile, err := initialize.Run(&initialize.Options{
+		Force:   true,
+		TempDir: t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize config: %v", err)
+	}
+	config.LoadTestEnvConfig(configFile)
+
+	cfg, err := config.GetTestConfig()
+	if err != nil {
+		t.Fatalf("failed to get test config: %v", err)
+	}
+
+	appctx, err := server.Setup(&cfg)
+	if err != nil {
+		t.Fatalf("failed to setup api: %v", err)
+	}
+
+	app := appctx.App
+	runModel := models.NewRunModel(appctx.ETCD.Client)
+
+	// Progress reported by the second step before the first one finished
+	_, err = runModel.Update("run-progress", func(run *types.Run) {
+		run.Pipeline = "deploy"
+		run.Step("build").Status = types.RunSucceeded
+		deploy := run.Step("deploy")
+		deploy.Status = types.RunRunning
+		deploy.Phase = "rolling-out"
+		deploy.Percent = 40
+		run.UpdateStatus()
+	})
+	if err != nil {
+		t.Fatalf("failed to save run: %v", err)
+	}
+
+	t.Run("get-run", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/runs/run-progress", nil)
+
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("get run request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		respBody, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "expected 200 OK on get run")
+
+		var got types.Run
+		if assert.NoError(t, json.Unmarshal(respBody, &got), "unmarshal get run response") {
+			assert.Equal(t, "run-progress", got.ID)
+			assert.Equal(t, types.RunRunning, got.Status)
+			if assert.Len(t, got.Steps, 2) {
+				assert.Equal(t, types.RunSucceeded, got.Steps[0].Status)
+				assert.Equal(t, "rolling-out", got.Steps[1].Phase)
+				assert.Equal(t, 40, got.Steps[1].Percent)
+			}
+		}
+	})
+
+	t.Run("get-missing-run", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/runs/missing", nil)
+
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("get run request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, "expected 404 Not Found on missing run")
+	})
+
+	t.Run("finished-run-expires", func(t *testing.T) {
+		runModel.Retention = time.Hour
+		ctx := context.Background()
+
+		getResp, err := appctx.ETCD.Client.Get(ctx, "/runs/run-progress")
+		if assert.NoError(t, err) && assert.Len(t, getResp.Kvs, 1) {
+			assert.Zero(t, getResp.Kvs[0].Lease, "a running run must not expire")
+		}
+
+		_, err = runModel.Update("run-progress", func(run *types.Run) {
+			run.Step("deploy").Status = types.RunSucceeded
+			run.UpdateStatus()
+		})
+		if err != nil {
+			t.Fatalf("failed to save run: %v", err)
+		}
+
+		getResp, err = appctx.ETCD.Client.Get(ctx, "/runs/run-progress")
+		if assert.NoError(t, err) && assert.Len(t, getResp.Kvs, 1) {
+			lease := clientv3.LeaseID(getResp.Kvs[0].Lease)
+			if assert.NotZero(t, lease, "a finished run must expire") {
+				ttl, err := appctx.ETCD.Client.TimeToLive(ctx, lease)
+				if assert.NoError(t, err) {
+					assert.InDelta(t, time.Hour.Seconds(), ttl.TTL, 5)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+// webhookRelayTimeout is how long the API server waits for the webhook bridge to accept a callback.
+const webhookRelayTimeout = 10 * time.Second
+
+type WebhookHandler struct {
+	NatsCon *nats.Conn
+}
+
+func NewWebhookHandler(natsCon *nats.Conn) *WebhookHandler {
+	return &WebhookHandler{
+		NatsCon: natsCon,
+	}
+}
+
+// PostCallbackResult relays the result of a webhook driver to the waiting bridge
+// @Summary Post the result of a webhook delivery
+// @Description Relays the DriverResult of an asynchronous webhook delivery to the webhook bridge waiting for it. The callback URL is sent to the webhook endpoint in the X-Conveyor-Callback-URL header. If the bridge has a secret, the body must be signed like webhook requests.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path string true "Callback ID"
+// @Param result body types.DriverResult true "Driver result"
+// @Param X-Conveyor-Signature header string false "Signature of the body"
+// @Param X-Conveyor-Timestamp header string false "Unix time the body was signed at"
+// @Success 202 {object} types.WebhookCallbackReply "Result accepted"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid result"
+// @Failure 401 {object} map[string]interface{} "Invalid signature"
+// @Failure 404 {object} map[string]interface{} "No delivery is waiting for the callback"
+// @Router /webhooks/callbacks/{id}/result [post]
+func (h *WebhookHandler) PostCallbackResult(c *fiber.Ctx) error {
+	return h.relay(c, "result")
+}
+
+// PostCallbackLogs relays logs of a webhook driver to the waiting bridge
+// @Summary Post logs of a webhook delivery
+// @Description Relays newline delimited JSON logs (NDJSON) of a webhook delivery to the webhook bridge, which writes them to the logs of the run. Only the message, level and labels of the logs are used. Logs can be posted while the webhook request is in progress or until the result is posted.
+// @Tags webhooks
+// @Accept x-ndjson
+// @Produce json
+// @Param id path string true "Callback ID"
+// @Param logs body string true "Newline delimited log entries"
+// @Param X-Conveyor-Signature header string false "Signature of the body"
+// @Param X-Conveyor-Timestamp header string false "Unix time the body was signed at"
+// @Success 202 {object} types.WebhookCallbackReply "Logs accepted"
+// @Failure 400 {object} map[string]interface{} "Bad request - Invalid logs"
+// @Failure 401 {object} map[string]interface{} "Invalid signature"
+// @Failure 404 {object} map[string]interface{} "No delivery is waiting for the callback"
+// @Router /webhooks/callbacks/{id}/logs [post]
+func (h *WebhookHandler) PostCallbackLogs(c *fiber.Ctx) error {
+	return h.relay(c, "logs")
+}
+
+// relay forwards a callback to the webhook bridge over NATS and answers with the reply of the bridge.
+func (h *WebhookHandler) relay(c *fiber.Ctx, kind string) error {
+	msg := nats.NewMsg(types.WebhookCallbackSubject(c.Params("id"), kind))
+	msg.Data = c.Body()
+	for _, header := range []string{types.WebhookSignatureHeader, types.WebhookTimestampHeader} {
+		if value := c.Get(header); value != "" {
+			msg.Header.Set(header, value)
+		}
+	}
+
+	response, err := h.NatsCon.RequestMsg(msg, webhookRelayTimeout)
+	if errors.Is(err, nats.ErrNoResponders) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": fmt.Sprintf("No delivery is waiting for callback %s", c.Params("id")),
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": fmt.Sprintf("Failed to relay callback: %v", err),
+		})
+	}
+
+	var reply types.WebhookCallbackReply
+	if err := json.Unmarshal(response.Data, &reply); err != nil || reply.Status == 0 {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Invalid reply from the webhook bridge",
+		})
+	}
+	if reply.Error != "" {
+		return c.Status(reply.Status).JSON(fiber.Map{
+			"error": reply.Error,
+		})
+	}
+	return c.Status(reply.Status).JSON(reply)
+}
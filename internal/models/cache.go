@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+// ErrCacheEntryNotFound is returned when a cache entry does not exist.
+var ErrCacheEntryNotFound = errors.New("cache entry not found")
+
+// cacheKeyPrefix prefixes the BadgerDB keys of cache entries.
+const cacheKeyPrefix = "cache|"
+
+// CacheRecord is the index record of a cache entry.
+type CacheRecord struct {
+	types.CacheEntry
+	// Object is the storage key the content of the entry is stored under.
+	Object string `json:"object"`
+}
+
+type CacheModel struct {
+	DB *badger.DB
+}
+
+func NewCacheModel(db *badger.DB) *CacheModel {
+	return &CacheModel{
+		DB: db,
+	}
+}
+
+// FindOne retrieves the record of a cache entry.
+// It returns ErrCacheEntryNotFound if the entry does not exist.
+func (m *CacheModel) FindOne(key string) (CacheRecord, error) {
+	var record CacheRecord
+	err := m.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(cacheKeyPrefix + key))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return ErrCacheEntryNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return item.Value(func(v []byte) error {
+			return json.Unmarshal(v, &record)
+		})
+	})
+	return record, err
+}
+
+// Save stores the record of a cache entry, replacing any record with the same key.
+func (m *CacheModel) Save(record CacheRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return m.DB.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(cacheKeyPrefix+record.Key), value)
+	})
+}
+
+// Delete removes the record of a cache entry.
+func (m *CacheModel) Delete(key string) error {
+	return m.DB.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(cacheKeyPrefix + key))
+	})
+}
+
+// FindAll retrieves the records of all cache entries.
+func (m *CacheModel) FindAll() ([]CacheRecord, error) {
+	records := []CacheRecord{}
+	err := m.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(cacheKeyPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			err := it.Item().Value(func(v []byte) error {
+				var record CacheRecord
+				if err := json.Unmarshal(v, &record); err != nil {
+					return err
+				}
+				records = append(records, record)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return records, err
+}
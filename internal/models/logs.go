@@ -1,14 +1,21 @@
 package models
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/dgraph-io/badger/v4"
 	"github.com/google/uuid"
 	"github.com/open-ug/conveyor/pkg/types"
 )
 
+// maxLogLineSize is the size of the longest log entry DecodeLogs accepts.
+const maxLogLineSize = 1 << 20
+
 type LogModel struct {
 	DB *badger.DB
 }
@@ -30,8 +37,130 @@ func (m *LogModel) Insert(log types.Log) error {
 	})
 }
 
+// InsertBatch stores log entries in a single write batch
+func (m *LogModel) InsertBatch(logs []types.Log) error {
+	batch := m.DB.NewWriteBatch()
+	defer batch.Cancel()
+
+	for _, log := range logs {
+		value, err := json.Marshal(log)
+		if err != nil {
+			return err
+		}
+		if err := batch.Set([]byte(makeKey(log.Pipeline, log.Driver, log.RunID, log.Timestamp)), value); err != nil {
+			return err
+		}
+	}
+	return batch.Flush()
+}
+
+/*
+DecodeLogs decodes newline delimited JSON log entries, as published by batching driver loggers
+and sent to `POST /logs/batch`. Blank lines are skipped.
+*/
+func DecodeLogs(r io.Reader) ([]types.Log, error) {
+	logs := []types.Log{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLogLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		var log types.Log
+		if err := json.Unmarshal(data, &log); err != nil {
+			return nil, fmt.Errorf("invalid log on line %d: %w", line, err)
+		}
+		logs = append(logs, log)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return logs, nil
+}
+
+// LogFilter selects logs. Empty fields match every log.
+type LogFilter struct {
+	Pipeline string
+	Driver   string
+	RunID    string
+	Step     string
+	// Level is the minimum level of the logs, e.g. `warn` selects warnings and errors.
+	Level string
+	// Labels must all be present on a log with the same values.
+	Labels map[string]string
+}
+
+// logLevels ranks the log levels by severity.
+var logLevels = map[string]int{
+	types.LogLevelDebug: 0,
+	types.LogLevelInfo:  1,
+	types.LogLevelWarn:  2,
+	types.LogLevelError: 3,
+}
+
+/*
+NewLogFilter creates a log filter from query parameters. Labels are given as a comma separated
+list of `key=value` pairs, e.g. `stage=test,os=linux`.
+*/
+func NewLogFilter(pipeline, driver, runid, step, level, labels string) (LogFilter, error) {
+	filter := LogFilter{Pipeline: pipeline, Driver: driver, RunID: runid, Step: step, Level: level}
+	if _, ok := logLevels[level]; level != "" && !ok {
+		return LogFilter{}, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+	}
+
+	if labels != "" {
+		filter.Labels = map[string]string{}
+		for _, pair := range strings.Split(labels, ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok || key == "" {
+				return LogFilter{}, fmt.Errorf("invalid label selector %q, expected key=value", pair)
+			}
+			filter.Labels[key] = value
+		}
+	}
+	return filter, nil
+}
+
+// Matches reports whether a log is selected by the filter.
+func (f LogFilter) Matches(log types.Log) bool {
+	if f.Pipeline != "" && log.Pipeline != f.Pipeline {
+		return false
+	}
+	if f.Driver != "" && log.Driver != f.Driver {
+		return false
+	}
+	if f.RunID != "" && log.RunID != f.RunID {
+		return false
+	}
+	if f.Step != "" && log.Step != f.Step {
+		return false
+	}
+	if f.Level != "" {
+		level := log.Level
+		if level == "" {
+			level = types.LogLevelInfo
+		}
+		if logLevels[level] < logLevels[f.Level] {
+			return false
+		}
+	}
+	for key, value := range f.Labels {
+		if label, ok := log.Labels[key]; !ok || label != value {
+			return false
+		}
+	}
+	return true
+}
+
 // Query logs by filters (any combination)
 func (m *LogModel) Query(pipeline, driver, runid string) ([]types.Log, error) {
+	return m.Find(LogFilter{Pipeline: pipeline, Driver: driver, RunID: runid})
+}
+
+// Find returns the logs selected by the filter, in the order they were written.
+func (m *LogModel) Find(filter LogFilter) ([]types.Log, error) {
 	logs := []types.Log{}
 
 	err := m.DB.View(func(txn *badger.Txn) error {
@@ -39,36 +168,29 @@ func (m *LogModel) Query(pipeline, driver, runid string) ([]types.Log, error) {
 		it := txn.NewIterator(opts)
 		defer it.Close()
 
-		prefix := ""
-		if pipeline != "" {
-			prefix += pipeline
-		}
-		prefix += "|"
-		if driver != "" {
-			prefix += driver
-		}
-		prefix += "|"
-		if runid != "" {
-			prefix += runid
-		}
-
 		for it.Rewind(); it.Valid(); it.Next() {
 			item := it.Item()
 			k := string(item.Key())
 
-			if pipeline != "" && !matchPart(k, 0, pipeline) {
+			// The database is shared with other models, whose keys are not made of five parts
+			if strings.Count(k, "|") != 4 {
+				continue
+			}
+
+			// Skip logs by their key before decoding them
+			if filter.Pipeline != "" && !matchPart(k, 0, filter.Pipeline) {
 				continue
 			}
-			if driver != "" && !matchPart(k, 1, driver) {
+			if filter.Driver != "" && !matchPart(k, 1, filter.Driver) {
 				continue
 			}
-			if runid != "" && !matchPart(k, 2, runid) {
+			if filter.RunID != "" && !matchPart(k, 2, filter.RunID) {
 				continue
 			}
 
 			err := item.Value(func(v []byte) error {
 				var l types.Log
-				if e := json.Unmarshal(v, &l); e == nil {
+				if e := json.Unmarshal(v, &l); e == nil && filter.Matches(l) {
 					logs = append(logs, l)
 				}
 				return nil
@@ -117,3 +117,29 @@ func (pm *PipelineModel) ListPipelines() ([]*types.Pipeline, error) {
 
 	return pipelines, nil
 }
+
+/*
+FindTriggered returns the first pipeline, in name order, whose resource selector matches the labels of a
+resource of its type. It returns nil when no pipeline is triggered by the resource.
+*/
+func (pm *PipelineModel) FindTriggered(resource types.Resource) (*types.Pipeline, error) {
+	pipelines, err := pm.ListPipelines()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pipeline := range pipelines {
+		if pipeline.Resource != resource.Resource || pipeline.ResourceSelector == "" {
+			continue
+		}
+		selector, err := types.ParseLabelSelector(pipeline.ResourceSelector)
+		if err != nil {
+			// Selectors are validated when pipelines are saved
+			continue
+		}
+		if selector.Matches(resource.Labels) {
+			return pipeline, nil
+		}
+	}
+	return nil, nil
+}
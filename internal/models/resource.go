@@ -3,8 +3,12 @@ package models
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dgraph-io/badger/v4"
@@ -12,6 +16,18 @@ import (
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
+// ErrResourceNotFound is returned when a resource or a version of it does not exist.
+var ErrResourceNotFound = errors.New("resource not found")
+
+// ErrResourceConflict is returned when a resource was changed since the resource version an update was based on.
+var ErrResourceConflict = errors.New("resource was modified, get it again and retry")
+
+// ErrResourceDeleting is returned when a resource that is being deleted is updated or given a finalizer.
+var ErrResourceDeleting = errors.New("resource is being deleted")
+
+// maxDriverResultAttempts bounds the attempts to save a driver result, finalizers or a deletion while the resource is changed concurrently.
+const maxDriverResultAttempts = 5
+
 type ResourceModel struct {
 	Client *clientv3.Client
 	DB     *badger.DB
@@ -29,7 +45,7 @@ func (m *ResourceModel) key(name string, resourceType string) string {
 	return fmt.Sprintf("/resources/%s/%s", resourceType, name)
 }
 
-// Insert adds a new resource to the etcd store.
+// Insert adds a new resource to the etcd store, along with its first version and the label and owner index entries of it.
 // It returns an error if a resource with the same name and type already exists.
 func (m *ResourceModel) Insert(name string, resourceType string, resource []byte) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -37,22 +53,30 @@ func (m *ResourceModel) Insert(name string, resourceType string, resource []byte
 
 	key := m.key(name, resourceType)
 
-	// Check existence
-	getResp, err := m.Client.Get(ctx, key)
-	if err != nil {
-		return err
-	}
-	if len(getResp.Kvs) > 0 {
-		return fmt.Errorf("resource with name %s and type %s already exists", name, resourceType)
+	var labeled types.Resource
+	if err := json.Unmarshal(resource, &labeled); err != nil {
+		return fmt.Errorf("failed to unmarshal resource: %v", err)
 	}
 
-	_, err = m.Client.Put(ctx, key, string(resource))
+	puts := []clientv3.Op{
+		clientv3.OpPut(key, string(resource)),
+		clientv3.OpPut(key+"/1", string(resource)),
+	}
+	puts = append(puts, m.labelIndexOps(name, resourceType, nil, labeled.Labels)...)
+	puts = append(puts, m.ownerIndexOps(name, resourceType, nil, labeled.OwnerReferences)...)
+
+	// The existence check and the writes are atomic, so concurrent inserts cannot overwrite each other
+	txnResp, err := m.Client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(puts...).
+		Commit()
 	if err != nil {
 		return fmt.Errorf("failed to insert resource: %v", err)
 	}
-
-	_, err = m.Client.Put(ctx, key+"/1", string(resource))
-	return err
+	if !txnResp.Succeeded {
+		return fmt.Errorf("resource with name %s and type %s already exists", name, resourceType)
+	}
+	return nil
 }
 
 func (m *ResourceModel) BadgerDBInsert(name string, resourceType string, resource []byte) error {
@@ -88,7 +112,17 @@ func (m *ResourceModel) BadgerDBInsert(name string, resourceType string, resourc
 	})
 }
 
-// FindOne retrieves a single resource by its name and type.
+// decodeResource unmarshals a resource stored in etcd and sets its resource version to the revision it was last modified at.
+func decodeResource(value []byte, modRevision int64) (types.Resource, error) {
+	var resource types.Resource
+	if err := json.Unmarshal(value, &resource); err != nil {
+		return types.Resource{}, err
+	}
+	resource.ResourceVersion = strconv.FormatInt(modRevision, 10)
+	return resource, nil
+}
+
+// FindOne retrieves a single resource by its name and type, along with its resource version.
 // It returns the resource data as a byte slice or an error if not found.
 func (m *ResourceModel) FindOne(name string, resourceType string) (types.Resource, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -101,11 +135,10 @@ func (m *ResourceModel) FindOne(name string, resourceType string) (types.Resourc
 		return types.Resource{}, err
 	}
 	if len(getResp.Kvs) == 0 {
-		return types.Resource{}, fmt.Errorf("resource with name %s and type %s not found", name, resourceType)
+		return types.Resource{}, fmt.Errorf("resource with name %s and type %s: %w", name, resourceType, ErrResourceNotFound)
 	}
 
-	resource := types.Resource{}
-	err = json.Unmarshal(getResp.Kvs[0].Value, &resource)
+	resource, err := decodeResource(getResp.Kvs[0].Value, getResp.Kvs[0].ModRevision)
 	if err != nil {
 		return types.Resource{}, fmt.Errorf("failed to unmarshal resource: %v", err)
 	}
@@ -113,40 +146,554 @@ func (m *ResourceModel) FindOne(name string, resourceType string) (types.Resourc
 	return resource, nil
 }
 
-// Delete removes a resource by its name and type.
-// It returns an error if the resource does not exist.
-func (m *ResourceModel) Delete(name string, resourceType string) error {
+/*
+Delete starts the deletion of a resource. A resource without finalizers is purged right away, along with its versions
+and label index entries. A resource with finalizers is marked with a deletion timestamp instead, and purged once its
+last finalizer is removed. It returns the resource, which still has finalizers when it was kept, and whether this call
+started the deletion, which is false when the resource was already being deleted.
+With the DeletionForeground policy, the resource is kept with the FinalizerForegroundDeletion finalizer until the
+garbage collector deleted its dependents.
+It returns an error wrapping ErrResourceNotFound if the resource does not exist.
+*/
+func (m *ResourceModel) Delete(name string, resourceType string, policy string) (types.Resource, bool, error) {
+	for attempt := 1; ; attempt++ {
+		resource, started, err := m.delete(name, resourceType, policy)
+		if !errors.Is(err, ErrResourceConflict) || attempt == maxDriverResultAttempts {
+			return resource, started, err
+		}
+	}
+}
+
+// delete starts the deletion of a resource, unless the resource is modified while doing so.
+func (m *ResourceModel) delete(name string, resourceType string, policy string) (types.Resource, bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	key := m.key(name, resourceType)
 
-	_, err := m.Client.Delete(ctx, key)
-	return err
+	current, err := m.FindOne(name, resourceType)
+	if err != nil {
+		return types.Resource{}, false, fmt.Errorf("failed to find resource: %w", err)
+	}
+	if current.DeletionTimestamp != nil {
+		return current, false, nil
+	}
+
+	now := time.Now().UTC()
+	current.DeletionTimestamp = &now
+	if policy == types.DeletionForeground && !slices.Contains(current.Finalizers, types.FinalizerForegroundDeletion) {
+		// The garbage collector removes the finalizer once the dependents of the resource are deleted
+		current.Finalizers = append(current.Finalizers, types.FinalizerForegroundDeletion)
+	}
+	ops := m.purgeOps(name, resourceType, current)
+	if len(current.Finalizers) > 0 {
+		// Keep the resource until its finalizers are removed
+		ops, err = m.putOps(key, &current)
+		if err != nil {
+			return types.Resource{}, false, err
+		}
+		if policy == types.DeletionForeground {
+			// The garbage collector deletes the dependents right away
+			ops = append(ops, clientv3.OpPut(pendingOwnerKey(resourceType, name), ""))
+		}
+	}
+
+	txnResp, err := m.Client.Txn(ctx).
+		If(m.unmodifiedSince(key, current.ResourceVersion)).
+		Then(ops...).
+		Commit()
+	if err != nil {
+		return types.Resource{}, false, fmt.Errorf("failed to delete resource: %v", err)
+	}
+	if !txnResp.Succeeded {
+		return types.Resource{}, false, fmt.Errorf("failed to delete resource: %w", ErrResourceConflict)
+	}
+
+	current.ResourceVersion = strconv.FormatInt(txnResp.Header.Revision, 10)
+	return current, true, nil
+}
+
+// purgeOps returns the operations that remove a resource, its versions and its index entries.
+// The resource is left to the garbage collector, which deletes its dependents.
+func (m *ResourceModel) purgeOps(name string, resourceType string, resource types.Resource) []clientv3.Op {
+	key := m.key(name, resourceType)
+	ops := []clientv3.Op{
+		clientv3.OpDelete(key),
+		clientv3.OpDelete(key+"/", clientv3.WithPrefix()),
+		clientv3.OpPut(pendingOwnerKey(resourceType, name), ""),
+	}
+	ops = append(ops, m.labelIndexOps(name, resourceType, resource.Labels, nil)...)
+	return append(ops, m.ownerIndexOps(name, resourceType, resource.OwnerReferences, nil)...)
+}
+
+// putOps returns the operation that saves a resource, without its resource version, which is derived from etcd.
+func (m *ResourceModel) putOps(key string, resource *types.Resource) ([]clientv3.Op, error) {
+	resourceVersion := resource.ResourceVersion
+	resource.ResourceVersion = ""
+	resourceData, err := json.Marshal(resource)
+	resource.ResourceVersion = resourceVersion
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal resource: %v", err)
+	}
+	return []clientv3.Op{clientv3.OpPut(key, string(resourceData))}, nil
+}
+
+/*
+AddFinalizer adds a finalizer to a resource, which keeps the resource when it is deleted until the finalizer is removed.
+Adding a finalizer the resource already has does nothing. Finalizers cannot be added to resources that are being
+deleted, ErrResourceDeleting is returned instead.
+*/
+func (m *ResourceModel) AddFinalizer(name string, resourceType string, finalizer string) (types.Resource, error) {
+	return m.modifyFinalizers(name, resourceType, func(resource *types.Resource) (bool, error) {
+		if slices.Contains(resource.Finalizers, finalizer) {
+			return false, nil
+		}
+		if resource.DeletionTimestamp != nil {
+			return false, fmt.Errorf("resource with name %s and type %s: %w", name, resourceType, ErrResourceDeleting)
+		}
+		resource.Finalizers = append(resource.Finalizers, finalizer)
+		return true, nil
+	})
+}
+
+/*
+RemoveFinalizer removes a finalizer from a resource. When the resource is being deleted and this was its last
+finalizer, the resource is purged along with its versions. Removing a finalizer the resource does not have does nothing.
+*/
+func (m *ResourceModel) RemoveFinalizer(name string, resourceType string, finalizer string) (types.Resource, error) {
+	return m.modifyFinalizers(name, resourceType, func(resource *types.Resource) (bool, error) {
+		if !slices.Contains(resource.Finalizers, finalizer) {
+			return false, nil
+		}
+		resource.Finalizers = slices.DeleteFunc(resource.Finalizers, func(f string) bool { return f == finalizer })
+		return true, nil
+	})
+}
+
+// modifyFinalizers modifies the finalizers of a resource, reading the resource again when it is modified concurrently.
+// modify reports whether it changed the finalizers. A deleted resource without finalizers left is purged.
+func (m *ResourceModel) modifyFinalizers(name string, resourceType string, modify func(*types.Resource) (bool, error)) (types.Resource, error) {
+	for attempt := 1; ; attempt++ {
+		resource, err := m.modifyFinalizersOnce(name, resourceType, modify)
+		if !errors.Is(err, ErrResourceConflict) || attempt == maxDriverResultAttempts {
+			return resource, err
+		}
+	}
 }
 
-// List retrieves all resources of a specific type.
-// It returns a slice of resource names or an error if the operation fails.
-func (m *ResourceModel) List(resourceType string) ([]string, error) {
+// modifyFinalizersOnce modifies the finalizers of a resource, unless the resource is modified while doing so.
+func (m *ResourceModel) modifyFinalizersOnce(name string, resourceType string, modify func(*types.Resource) (bool, error)) (types.Resource, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	key := fmt.Sprintf("/resources/%s/", resourceType)
+	key := m.key(name, resourceType)
 
-	getResp, err := m.Client.Get(ctx, key, clientv3.WithPrefix())
+	resource, err := m.FindOne(name, resourceType)
 	if err != nil {
-		return nil, err
+		return types.Resource{}, fmt.Errorf("failed to find resource: %w", err)
+	}
+	changed, err := modify(&resource)
+	if err != nil || !changed {
+		return resource, err
 	}
 
-	var resources []string
-	for _, kv := range getResp.Kvs {
-		resources = append(resources, string(kv.Key))
+	ops := m.purgeOps(name, resourceType, resource)
+	if resource.DeletionTimestamp == nil || len(resource.Finalizers) > 0 {
+		ops, err = m.putOps(key, &resource)
+		if err != nil {
+			return types.Resource{}, err
+		}
+	}
+
+	txnResp, err := m.Client.Txn(ctx).
+		If(m.unmodifiedSince(key, resource.ResourceVersion)).
+		Then(ops...).
+		Commit()
+	if err != nil {
+		return types.Resource{}, fmt.Errorf("failed to save finalizers: %v", err)
+	}
+	if !txnResp.Succeeded {
+		return types.Resource{}, fmt.Errorf("failed to save finalizers: %w", ErrResourceConflict)
+	}
+
+	resource.ResourceVersion = strconv.FormatInt(txnResp.Header.Revision, 10)
+	return resource, nil
+}
+
+/*
+ownerIndexKey returns the key of the owner index entry of a dependent. The owner index holds an empty entry
+per owner reference of every resource, under the prefix of the owner, so the garbage collector finds the
+dependents of an owner with a range read instead of reading every resource.
+*/
+func ownerIndexKey(ownerType string, ownerName string, resourceType string, name string) string {
+	return ownerIndexPrefix(ownerType, ownerName) + resourceType + "/" + name
+}
+
+// ownerIndexPrefix returns the prefix of the owner index entries of the dependents of an owner.
+func ownerIndexPrefix(ownerType string, ownerName string) string {
+	return fmt.Sprintf("/owners/%s/%s/", ownerType, ownerName)
+}
+
+// ownerIndexOps returns the operations that update the owner index of a resource whose owner references change from old to references.
+func (m *ResourceModel) ownerIndexOps(name string, resourceType string, old []types.OwnerReference, references []types.OwnerReference) []clientv3.Op {
+	keys := func(references []types.OwnerReference) []string {
+		keys := make([]string, 0, len(references))
+		for _, reference := range references {
+			key := ownerIndexKey(reference.Resource, reference.Name, resourceType, name)
+			// A transaction cannot write a key twice
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	}
+	previous, current := keys(old), keys(references)
+
+	var ops []clientv3.Op
+	for _, key := range previous {
+		if !slices.Contains(current, key) {
+			ops = append(ops, clientv3.OpDelete(key))
+		}
+	}
+	for _, key := range current {
+		if !slices.Contains(previous, key) {
+			ops = append(ops, clientv3.OpPut(key, ""))
+		}
+	}
+	return ops
+}
+
+// pendingOwnerKey returns the key that marks a resource whose dependents the garbage collector has to visit.
+// Resources are marked when they are purged, and when their foreground deletion starts.
+func pendingOwnerKey(resourceType string, name string) string {
+	return fmt.Sprintf("/gc/%s/%s", resourceType, name)
+}
+
+/*
+labelIndexKey returns the key of the label index entry of a resource. The label index holds an empty
+entry per label of every resource, under the prefix of the label's key and value, so the resources
+with a label value are found with a range read instead of reading every resource of the type.
+*/
+func labelIndexKey(resourceType string, key string, value string, name string) string {
+	return labelIndexPrefix(resourceType, key, value) + name
+}
+
+// labelIndexPrefix returns the prefix of the label index entries of the resources of a type with a label value.
+// Label keys may hold a '/', so they are escaped.
+func labelIndexPrefix(resourceType string, key string, value string) string {
+	return fmt.Sprintf("/labels/%s/%s=%s/", resourceType, url.PathEscape(key), value)
+}
+
+// labelIndexOps returns the operations that update the label index of a resource whose labels change from old to labels.
+func (m *ResourceModel) labelIndexOps(name string, resourceType string, old map[string]string, labels map[string]string) []clientv3.Op {
+	var ops []clientv3.Op
+	for key, value := range old {
+		if current, ok := labels[key]; !ok || current != value {
+			ops = append(ops, clientv3.OpDelete(labelIndexKey(resourceType, key, value, name)))
+		}
+	}
+	for key, value := range labels {
+		if previous, ok := old[key]; !ok || previous != value {
+			ops = append(ops, clientv3.OpPut(labelIndexKey(resourceType, key, value, name), ""))
+		}
+	}
+	return ops
+}
+
+// ResourceFilter selects resources. Empty fields match every resource.
+type ResourceFilter struct {
+	Pipeline string
+	// Metadata must all be present on a resource with the same values.
+	Metadata map[string]string
+	// Labels must be satisfied by the labels of a resource.
+	Labels types.LabelSelector
+}
+
+/*
+NewResourceFilter creates a resource filter from query parameters. Metadata is given as a comma
+separated list of `key=value` pairs, e.g. `team=payments,tier=backend`, and labels as a label
+selector, e.g. `env=prod,team in (payments,billing)`.
+*/
+func NewResourceFilter(pipeline, metadata, labels string) (ResourceFilter, error) {
+	selector, err := types.ParseLabelSelector(labels)
+	if err != nil {
+		return ResourceFilter{}, err
+	}
+	filter := ResourceFilter{Pipeline: pipeline, Labels: selector}
+
+	if metadata != "" {
+		filter.Metadata = map[string]string{}
+		for _, pair := range strings.Split(metadata, ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok || key == "" {
+				return ResourceFilter{}, fmt.Errorf("invalid metadata selector %q, expected key=value", pair)
+			}
+			filter.Metadata[key] = value
+		}
 	}
-	return resources, nil
+	return filter, nil
 }
 
-// Update modifies an existing resource's data.
-// It returns an error if the resource does not exist.
+// Matches reports whether a resource is selected by the filter.
+func (f ResourceFilter) Matches(resource types.Resource) bool {
+	if f.Pipeline != "" && resource.Pipeline != f.Pipeline {
+		return false
+	}
+	for key, value := range f.Metadata {
+		if field, ok := resource.Metadata[key]; !ok || field != value {
+			return false
+		}
+	}
+	return f.Labels.Matches(resource.Labels)
+}
+
+// ResourceListOptions select the page of resources List returns.
+type ResourceListOptions struct {
+	// After is the name of the last resource of the previous page, the first page starts at the first resource.
+	After string
+	// Limit is the maximum number of resources of the page.
+	Limit int
+	// Descending lists resources in reverse name order.
+	Descending bool
+	// Filter selects the listed resources.
+	Filter ResourceFilter
+}
+
+/*
+List retrieves a page of the current resources of a specific type ordered by name, without their versions.
+The resources are read in batches over an etcd range starting after opts.After, until the page holds
+opts.Limit resources selected by the filter. When the label selector of the filter requires label values,
+only the resources found in the label index are read.
+The list holds the name to pass as After for the next page, which is empty after the last page, and the
+etcd revision the page was read at, which watches can start from.
+*/
+func (m *ResourceModel) List(resourceType string, opts ResourceListOptions) (*types.ResourceList, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, requirement := range opts.Filter.Labels {
+		if requirement.Operator == types.SelectorIn {
+			return m.listIndexed(ctx, resourceType, requirement, opts)
+		}
+	}
+
+	prefix := fmt.Sprintf("/resources/%s/", resourceType)
+	start, end := prefix, clientv3.GetPrefixRangeEnd(prefix)
+	if opts.After != "" {
+		if opts.Descending {
+			// Versions of the resource sort after it, so they are excluded too
+			end = m.key(opts.After, resourceType)
+		} else {
+			start = m.key(opts.After, resourceType) + "\x00"
+		}
+	}
+	order := clientv3.SortAscend
+	if opts.Descending {
+		order = clientv3.SortDescend
+	}
+
+	list := &types.ResourceList{Items: []types.Resource{}}
+	for len(list.Items) < opts.Limit {
+		// Versions of resources are stored under the same prefix, so more keys than resources are read
+		getOpts := []clientv3.OpOption{
+			clientv3.WithRange(end),
+			clientv3.WithSort(clientv3.SortByKey, order),
+			clientv3.WithLimit(int64(opts.Limit * 4)),
+		}
+		if list.Revision != 0 {
+			// Read every batch at the same revision
+			getOpts = append(getOpts, clientv3.WithRev(list.Revision))
+		}
+		getResp, err := m.Client.Get(ctx, start, getOpts...)
+		if err != nil {
+			return nil, err
+		}
+		list.Revision = getResp.Header.Revision
+
+		for _, kv := range getResp.Kvs {
+			if strings.Contains(strings.TrimPrefix(string(kv.Key), prefix), "/") {
+				// A version of a resource
+				continue
+			}
+			resource, err := decodeResource(kv.Value, kv.ModRevision)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unmarshal resource %s: %v", kv.Key, err)
+			}
+			if !opts.Filter.Matches(resource) {
+				continue
+			}
+			list.Items = append(list.Items, resource)
+			if len(list.Items) == opts.Limit {
+				if getResp.More || kv != getResp.Kvs[len(getResp.Kvs)-1] {
+					list.Continue = resource.Name
+				}
+				return list, nil
+			}
+		}
+
+		if !getResp.More {
+			break
+		}
+		last := string(getResp.Kvs[len(getResp.Kvs)-1].Key)
+		if opts.Descending {
+			end = last
+		} else {
+			start = last + "\x00"
+		}
+	}
+	return list, nil
+}
+
+// listIndexed lists the resources with one of the values of an `in` requirement, which are read from the label index.
+func (m *ResourceModel) listIndexed(ctx context.Context, resourceType string, requirement types.LabelRequirement, opts ResourceListOptions) (*types.ResourceList, error) {
+	list := &types.ResourceList{Items: []types.Resource{}}
+
+	var names []string
+	for _, value := range requirement.Values {
+		prefix := labelIndexPrefix(resourceType, requirement.Key, value)
+		getOpts := []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithKeysOnly()}
+		if list.Revision != 0 {
+			// Read the index and the resources at the same revision
+			getOpts = append(getOpts, clientv3.WithRev(list.Revision))
+		}
+		getResp, err := m.Client.Get(ctx, prefix, getOpts...)
+		if err != nil {
+			return nil, err
+		}
+		list.Revision = getResp.Header.Revision
+		for _, kv := range getResp.Kvs {
+			names = append(names, strings.TrimPrefix(string(kv.Key), prefix))
+		}
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+	if opts.Descending {
+		slices.Reverse(names)
+	}
+
+	for i, name := range names {
+		if opts.After != "" && (!opts.Descending && name <= opts.After || opts.Descending && name >= opts.After) {
+			continue
+		}
+		getResp, err := m.Client.Get(ctx, m.key(name, resourceType), clientv3.WithRev(list.Revision))
+		if err != nil {
+			return nil, err
+		}
+		if len(getResp.Kvs) == 0 {
+			continue
+		}
+		resource, err := decodeResource(getResp.Kvs[0].Value, getResp.Kvs[0].ModRevision)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal resource %s: %v", getResp.Kvs[0].Key, err)
+		}
+		if !opts.Filter.Matches(resource) {
+			continue
+		}
+		list.Items = append(list.Items, resource)
+		if len(list.Items) == opts.Limit {
+			if i < len(names)-1 {
+				list.Continue = resource.Name
+			}
+			break
+		}
+	}
+	return list, nil
+}
+
+/*
+Watch streams the changes of the resources of a type, or of a single resource when name is set, until ctx is cancelled.
+The changes after revision are streamed, or the changes from now on when revision is 0.
+Only the resources selected by selector are watched. A resource whose labels change to match the selector
+is streamed as added, and one whose labels no longer match it as deleted.
+When the watch cannot go on, e.g. because revision was compacted, a WatchError event is sent and the channel is closed.
+*/
+func (m *ResourceModel) Watch(ctx context.Context, resourceType string, name string, revision int64, selector types.LabelSelector) <-chan types.WatchEvent {
+	prefix := fmt.Sprintf("/resources/%s/", resourceType)
+	key := prefix
+	opts := []clientv3.OpOption{clientv3.WithPrevKV()}
+	if name == "" {
+		opts = append(opts, clientv3.WithPrefix())
+	} else {
+		key = m.key(name, resourceType)
+	}
+	if revision > 0 {
+		opts = append(opts, clientv3.WithRev(revision+1))
+	}
+
+	events := make(chan types.WatchEvent)
+	go func() {
+		defer close(events)
+		send := func(event types.WatchEvent) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for resp := range m.Client.Watch(clientv3.WithRequireLeader(ctx), key, opts...) {
+			if err := resp.Err(); err != nil {
+				send(types.WatchEvent{Type: types.WatchError, Error: err.Error()})
+				return
+			}
+
+			for _, ev := range resp.Events {
+				resourceName := strings.TrimPrefix(string(ev.Kv.Key), prefix)
+				if strings.Contains(resourceName, "/") {
+					// A version of a resource
+					continue
+				}
+
+				event := types.WatchEvent{Revision: ev.Kv.ModRevision}
+				current, previous, selected, wasSelected := types.Resource{}, types.Resource{}, false, false
+				var err error
+				if ev.Type != clientv3.EventTypeDelete {
+					if current, err = decodeResource(ev.Kv.Value, ev.Kv.ModRevision); err == nil {
+						selected = selector.Matches(current.Labels)
+					}
+				}
+				if ev.PrevKv != nil {
+					previous, err = decodeResource(ev.PrevKv.Value, ev.PrevKv.ModRevision)
+				}
+				if ev.PrevKv != nil && err == nil {
+					wasSelected = selector.Matches(previous.Labels)
+				} else if !ev.IsCreate() {
+					// The previous state was compacted, assume the resource was watched
+					previous, wasSelected = types.Resource{Name: resourceName, Resource: resourceType}, true
+				}
+
+				switch {
+				case ev.Type == clientv3.EventTypeDelete && wasSelected:
+					event.Type, event.Resource = types.WatchDeleted, previous
+				case ev.Type == clientv3.EventTypeDelete:
+					continue
+				case selected && (ev.IsCreate() || !wasSelected):
+					event.Type, event.Resource = types.WatchAdded, current
+				case selected:
+					event.Type, event.Resource = types.WatchModified, current
+				case wasSelected && !ev.IsCreate():
+					// The labels of the resource no longer match the selector
+					event.Type, event.Resource = types.WatchDeleted, current
+				default:
+					continue
+				}
+				if !send(event) {
+					return
+				}
+			}
+		}
+	}()
+	return events
+}
+
+/*
+Update modifies an existing resource's data and saves it as a new version. It returns the resource with its new resource version.
+When resource.ResourceVersion is set, the update only succeeds if the resource was not modified since that version.
+Either way the resource is written in an etcd transaction that compares its modification revision with the one that
+was read, so concurrent writers never overwrite each other's changes. Updates that lose the race fail with ErrResourceConflict.
+It returns an error wrapping ErrResourceNotFound if the resource does not exist.
+*/
 func (m *ResourceModel) Update(name string, resourceType string, resource types.Resource) (types.Resource, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -156,10 +703,20 @@ func (m *ResourceModel) Update(name string, resourceType string, resource types.
 	// Check existence
 	currentResource, err := m.FindOne(name, resourceType)
 	if err != nil {
-		return types.Resource{}, fmt.Errorf("resource with name %s and type %s not found: %v ", name, resourceType, err)
+		return types.Resource{}, fmt.Errorf("failed to find resource: %w", err)
+	}
+	if resource.ResourceVersion != "" && resource.ResourceVersion != currentResource.ResourceVersion {
+		return types.Resource{}, fmt.Errorf("resource with name %s and type %s is at version %s, not %s: %w", name, resourceType, currentResource.ResourceVersion, resource.ResourceVersion, ErrResourceConflict)
+	}
+	if currentResource.DeletionTimestamp != nil {
+		return types.Resource{}, fmt.Errorf("resource with name %s and type %s: %w", name, resourceType, ErrResourceDeleting)
 	}
 
 	resource.ID = currentResource.ID // Ensure the ID remains unchanged
+	// The status and the finalizers are only updated through their own methods
+	resource.Status = currentResource.Status
+	resource.Finalizers = currentResource.Finalizers
+	resource.DeletionTimestamp = nil
 	vesion, err := strconv.Atoi(currentResource.Metadata["version"])
 	if err != nil {
 		return types.Resource{}, fmt.Errorf("failed to parse version: %v", err)
@@ -169,46 +726,157 @@ func (m *ResourceModel) Update(name string, resourceType string, resource types.
 		resource.Metadata = make(map[string]string)
 	}
 	resource.Metadata["version"] = strconv.Itoa(vesion + 1) // Increment version
+	resource.Metadata[types.MetadataUpdatedAt] = time.Now().UTC().Format(time.RFC3339)
 
-	// Marshal the updated resource to JSON
+	// The resource version is derived from etcd, it is not stored
+	resource.ResourceVersion = ""
 	resourceData, err := json.Marshal(resource)
 	if err != nil {
 		return types.Resource{}, fmt.Errorf("failed to marshal resource: %v", err)
 	}
 
-	_, err = m.Client.Put(ctx, key, string(resourceData))
+	// Save the resource, its new version and its index entries at once, unless it was modified since it was read
+	ops := []clientv3.Op{
+		clientv3.OpPut(key, string(resourceData)),
+		clientv3.OpPut(fmt.Sprintf("%s/%s", key, resource.Metadata["version"]), string(resourceData)),
+	}
+	ops = append(ops, m.labelIndexOps(name, resourceType, currentResource.Labels, resource.Labels)...)
+	ops = append(ops, m.ownerIndexOps(name, resourceType, currentResource.OwnerReferences, resource.OwnerReferences)...)
+	txnResp, err := m.Client.Txn(ctx).
+		If(m.unmodifiedSince(key, currentResource.ResourceVersion)).
+		Then(ops...).
+		Commit()
 	if err != nil {
 		return types.Resource{}, fmt.Errorf("failed to update resource: %v", err)
 	}
+	if !txnResp.Succeeded {
+		return types.Resource{}, fmt.Errorf("resource with name %s and type %s: %w", name, resourceType, ErrResourceConflict)
+	}
 
-	// save versioned resource
-	versionedKey := fmt.Sprintf("%s/%s", key, resource.Metadata["version"])
-	_, err = m.Client.Put(ctx, versionedKey, string(resourceData))
+	resource.ResourceVersion = strconv.FormatInt(txnResp.Header.Revision, 10)
+	return resource, nil
+}
+
+// unmodifiedSince returns the comparison of a transaction that only succeeds while the key is at the resource version.
+func (m *ResourceModel) unmodifiedSince(key string, resourceVersion string) clientv3.Cmp {
+	modRevision, _ := strconv.ParseInt(resourceVersion, 10, 64)
+	return clientv3.Compare(clientv3.ModRevision(key), "=", modRevision)
+}
+
+// FindAll retrieves all current resources of a specific type, ordered by name.
+// It returns an empty slice when there are none.
+func (m *ResourceModel) FindAll(resourceType string) ([]types.Resource, error) {
+	resources := []types.Resource{}
+	opts := ResourceListOptions{Limit: 500}
+	for {
+		list, err := m.List(resourceType, opts)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, list.Items...)
+		if list.Continue == "" {
+			return resources, nil
+		}
+		opts.After = list.Continue
+	}
+}
+
+// PendingOwners returns the resources whose dependents the garbage collector has to visit, and the revision they
+// were read at. The resources may have been purged since.
+func (m *ResourceModel) PendingOwners() ([]types.OwnerReference, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	prefix := "/gc/"
+	getResp, err := m.Client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
 	if err != nil {
-		return types.Resource{}, fmt.Errorf("failed to save versioned resource: %v", err)
+		return nil, 0, err
 	}
-	return resource, err
+
+	owners := make([]types.OwnerReference, 0, len(getResp.Kvs))
+	for _, kv := range getResp.Kvs {
+		resourceType, name, ok := strings.Cut(strings.TrimPrefix(string(kv.Key), prefix), "/")
+		if !ok {
+			continue
+		}
+		owners = append(owners, types.OwnerReference{Resource: resourceType, Name: name})
+	}
+	return owners, getResp.Header.Revision, nil
 }
 
-// FindAll retrieves all resources of a specific type.
-// It returns a slice of resource names or an error if no resources are found.
-func (m *ResourceModel) FindAll(resourceType string) ([]string, error) {
+// ForgetOwner removes a resource from the pending owners, unless it was marked again after the revision.
+func (m *ResourceModel) ForgetOwner(resourceType string, name string, revision int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	getResp, err := m.Client.Get(ctx, fmt.Sprintf("/resources/%s/", resourceType), clientv3.WithPrefix())
+	key := pendingOwnerKey(resourceType, name)
+	_, err := m.Client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "<", revision+1)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	return err
+}
+
+// FindDependents retrieves the current resources that name a resource in their owner references, ordered by type and name.
+func (m *ResourceModel) FindDependents(resourceType string, name string) ([]types.Resource, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	prefix := ownerIndexPrefix(resourceType, name)
+	getResp, err := m.Client.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
 	if err != nil {
 		return nil, err
 	}
-	if len(getResp.Kvs) == 0 {
-		return nil, fmt.Errorf("no resources of type %s found", resourceType)
+
+	dependents := []types.Resource{}
+	for _, kv := range getResp.Kvs {
+		dependentType, dependentName, ok := strings.Cut(strings.TrimPrefix(string(kv.Key), prefix), "/")
+		if !ok {
+			continue
+		}
+		dependent, err := m.FindOne(dependentName, dependentType)
+		if errors.Is(err, ErrResourceNotFound) {
+			// Purged since the index was read
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		dependents = append(dependents, dependent)
+	}
+	return dependents, nil
+}
+
+// ListVersions retrieves every version of a resource, oldest first.
+// It returns an error wrapping ErrResourceNotFound if the resource does not exist.
+func (m *ResourceModel) ListVersions(name string, resourceType string) ([]types.Resource, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := m.FindOne(name, resourceType); err != nil {
+		return nil, err
+	}
+
+	prefix := m.key(name, resourceType) + "/"
+	getResp, err := m.Client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
 	}
 
-	var resources []string
+	versions := []types.Resource{}
 	for _, kv := range getResp.Kvs {
-		resources = append(resources, string(kv.Value))
+		version, err := decodeResource(kv.Value, kv.ModRevision)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal resource %s: %v", kv.Key, err)
+		}
+		versions = append(versions, version)
 	}
-	return resources, nil
+	// Keys sort as strings, versions as numbers
+	slices.SortFunc(versions, func(a, b types.Resource) int {
+		x, _ := strconv.Atoi(a.Metadata["version"])
+		y, _ := strconv.Atoi(b.Metadata["version"])
+		return x - y
+	})
+	return versions, nil
 }
 
 // FindByVersion retrieves a specific version of a resource by its name and type and version.
@@ -224,7 +892,7 @@ func (m *ResourceModel) FindByVersion(name string, resourceType string, version
 		return types.Resource{}, err
 	}
 	if len(getResp.Kvs) == 0 {
-		return types.Resource{}, fmt.Errorf("resource with name %s, type %s and version %s not found", name, resourceType, version)
+		return types.Resource{}, fmt.Errorf("resource with name %s, type %s and version %s: %w", name, resourceType, version, ErrResourceNotFound)
 	}
 
 	resource := types.Resource{}
@@ -236,42 +904,82 @@ func (m *ResourceModel) FindByVersion(name string, resourceType string, version
 	return resource, nil
 }
 
-/// A function that saves the driver result. This data is then stored in the metadata.driverresults.[driver] field of the resource and is arbitrary data types
+/*
+UpdateStatus replaces the status of a resource, leaving the rest of the resource and its version unchanged.
+Conditions whose status does not change keep their last transition time. When resourceVersion is set, the
+status is only updated if the resource was not modified since that version, and ErrResourceConflict is returned otherwise.
+*/
+func (m *ResourceModel) UpdateStatus(name string, resourceType string, status types.ResourceStatus, resourceVersion string) (types.Resource, error) {
+	return m.modifyStatus(name, resourceType, resourceVersion, func(current *types.ResourceStatus) {
+		conditions := status.Conditions
+		status.Conditions = nil
+		for _, condition := range conditions {
+			if previous := current.FindCondition(condition.Type); previous != nil {
+				status.Conditions = append(status.Conditions, *previous)
+			}
+			status.SetCondition(condition)
+		}
+		*current = status
+	})
+}
 
-func (m *ResourceModel) SaveDriverResult(name string, resourceType string, driver string, result interface{}) error {
+/*
+SaveDriverResult saves the result of a driver in the status of the resource, along with the version of the resource
+the driver reconciled. The resource is read again and the result saved again when the resource is modified concurrently,
+so neither change is lost.
+*/
+func (m *ResourceModel) SaveDriverResult(name string, resourceType string, driver string, result types.DriverResult, observedGeneration int64) error {
+	for attempt := 1; ; attempt++ {
+		_, err := m.modifyStatus(name, resourceType, "", func(status *types.ResourceStatus) {
+			if status.DriverResults == nil {
+				status.DriverResults = map[string]types.DriverResult{}
+			}
+			status.DriverResults[driver] = result
+			status.ObservedGeneration = max(status.ObservedGeneration, observedGeneration)
+		})
+		if !errors.Is(err, ErrResourceConflict) || attempt == maxDriverResultAttempts {
+			return err
+		}
+	}
+}
+
+// modifyStatus modifies the status of a resource, unless the resource is modified while doing so or was modified since resourceVersion when it is set.
+func (m *ResourceModel) modifyStatus(name string, resourceType string, resourceVersion string, modify func(*types.ResourceStatus)) (types.Resource, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	// Retrieve the current resource
 	resource, err := m.FindOne(name, resourceType)
 	if err != nil {
-		return fmt.Errorf("failed to find resource: %v", err)
+		return types.Resource{}, fmt.Errorf("failed to find resource: %w", err)
 	}
-
-	// Marshal the driver result to JSON
-	resultData, err := json.Marshal(result)
-	if err != nil {
-		return fmt.Errorf("failed to marshal driver result: %v", err)
+	if resourceVersion != "" && resourceVersion != resource.ResourceVersion {
+		return types.Resource{}, fmt.Errorf("resource with name %s and type %s is at version %s, not %s: %w", name, resourceType, resource.ResourceVersion, resourceVersion, ErrResourceConflict)
 	}
+	readVersion := resource.ResourceVersion
 
-	// Update the resource's metadata with the driver result
-	if resource.Metadata == nil {
-		resource.Metadata = make(map[string]string)
-	}
-	resource.Metadata["driverresults."+driver] = string(resultData)
+	modify(&resource.Status)
 
 	// Marshal the updated resource to JSON
+	resource.ResourceVersion = ""
 	resourceData, err := json.Marshal(resource)
 	if err != nil {
-		return fmt.Errorf("failed to marshal updated resource: %v", err)
+		return types.Resource{}, fmt.Errorf("failed to marshal updated resource: %v", err)
 	}
 
-	// Save the updated resource back to etcd
+	// Save the updated resource back to etcd, the status is not part of the versions of the resource
 	key := m.key(name, resourceType)
-	_, err = m.Client.Put(ctx, key, string(resourceData))
+	txnResp, err := m.Client.Txn(ctx).
+		If(m.unmodifiedSince(key, readVersion)).
+		Then(clientv3.OpPut(key, string(resourceData))).
+		Commit()
 	if err != nil {
-		return fmt.Errorf("failed to save updated resource: %v", err)
+		return types.Resource{}, fmt.Errorf("failed to save updated resource: %v", err)
+	}
+	if !txnResp.Succeeded {
+		return types.Resource{}, fmt.Errorf("failed to save updated resource: %w", ErrResourceConflict)
 	}
 
-	return nil
+	resource.ResourceVersion = strconv.FormatInt(txnResp.Header.Revision, 10)
+	return resource, nil
 }
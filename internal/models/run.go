@@ -0,0 +1,121 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/open-ug/conveyor/pkg/types"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ErrRunNotFound is returned when a run record does not exist.
+var ErrRunNotFound = errors.New("run not found")
+
+// DefaultRunRetention is how long the record of a finished run is kept.
+const DefaultRunRetention = 7 * 24 * time.Hour
+
+type RunModel struct {
+	Client *clientv3.Client
+	// Retention is how long the record of a run is kept once the run succeeded or failed,
+	// DefaultRunRetention if not set. The record is attached to an etcd lease, so etcd removes it once the lease expires.
+	Retention time.Duration
+}
+
+func NewRunModel(cli *clientv3.Client) *RunModel {
+	return &RunModel{
+		Client:    cli,
+		Retention: DefaultRunRetention,
+	}
+}
+
+// key generates the key of a run record.
+func (m *RunModel) key(id string) string {
+	return fmt.Sprintf("/runs/%s", id)
+}
+
+// FindOne retrieves a run record by its ID.
+// It returns ErrRunNotFound if the run does not exist.
+func (m *RunModel) FindOne(id string) (types.Run, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	getResp, err := m.Client.Get(ctx, m.key(id))
+	if err != nil {
+		return types.Run{}, err
+	}
+	if len(getResp.Kvs) == 0 {
+		return types.Run{}, ErrRunNotFound
+	}
+
+	var run types.Run
+	err = json.Unmarshal(getResp.Kvs[0].Value, &run)
+	if err != nil {
+		return types.Run{}, fmt.Errorf("failed to unmarshal run: %v", err)
+	}
+	return run, nil
+}
+
+/*
+Update applies fn to the run record with the given ID and saves it.
+A missing run record is created, so progress and results that arrive first still get recorded.
+Once the run succeeded or failed, the record is removed after Retention.
+The update is retried when the record is changed concurrently, so fn may be called more than once.
+*/
+func (m *RunModel) Update(id string, fn func(run *types.Run)) (types.Run, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	key := m.key(id)
+	for {
+		getResp, err := m.Client.Get(ctx, key)
+		if err != nil {
+			return types.Run{}, err
+		}
+
+		run := types.Run{ID: id, Status: types.RunPending, CreatedAt: time.Now()}
+		var revision int64
+		if len(getResp.Kvs) > 0 {
+			revision = getResp.Kvs[0].ModRevision
+			if err := json.Unmarshal(getResp.Kvs[0].Value, &run); err != nil {
+				return types.Run{}, fmt.Errorf("failed to unmarshal run: %v", err)
+			}
+		}
+
+		fn(&run)
+		run.UpdatedAt = time.Now()
+
+		runData, err := json.Marshal(run)
+		if err != nil {
+			return types.Run{}, fmt.Errorf("failed to marshal run: %v", err)
+		}
+
+		var opts []clientv3.OpOption
+		if run.Status == types.RunSucceeded || run.Status == types.RunFailed {
+			// Finished runs expire, so their records do not pile up
+			retention := m.Retention
+			if retention <= 0 {
+				retention = DefaultRunRetention
+			}
+			lease, err := m.Client.Grant(ctx, int64(max(retention, time.Second)/time.Second))
+			if err != nil {
+				return types.Run{}, fmt.Errorf("failed to grant run lease: %v", err)
+			}
+			opts = append(opts, clientv3.WithLease(lease.ID))
+		}
+
+		// Only write if nobody else changed the record since it was read
+		txnResp, err := m.Client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", revision)).
+			Then(clientv3.OpPut(key, string(runData), opts...)).
+			Commit()
+		if err != nil {
+			return types.Run{}, fmt.Errorf("failed to save run: %v", err)
+		}
+		if txnResp.Succeeded {
+			return run, nil
+		}
+	}
+}
@@ -0,0 +1,22 @@
+/*
+Copyright © 2024 - Present Conveyor CI Contributors
+*/
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/open-ug/conveyor/internal/handlers"
+	"github.com/open-ug/conveyor/internal/storage"
+)
+
+func CacheRoutes(app *fiber.App, cache *storage.Cache) {
+
+	// Initialize cache handler
+	cachePrefix := app.Group("/cache")
+	cacheHandler := handlers.NewCacheHandler(cache)
+
+	// Cache Routes
+	cachePrefix.Put("/:key", cacheHandler.PutCacheEntry)
+	cachePrefix.Get("/:key", cacheHandler.GetCacheEntry)
+	cachePrefix.Delete("/:key", cacheHandler.DeleteCacheEntry)
+}
@@ -13,6 +13,9 @@ func LogRoutes(app *fiber.App, logHandler *handlers.LogHandler, natsContext *uti
 
 	app.Post("/logs", logHandler.CreateLog)
 
+	// POST /logs/batch with newline delimited logs
+	app.Post("/logs/batch", logHandler.CreateLogBatch)
+
 	// GET /logs?pipeline=...&driver=...&runid=...
 	app.Get("/logs", logHandler.GetLogs)
 
@@ -18,5 +18,9 @@ func PipelineRoutes(app *fiber.App, cli *clientv3.Client, natsContext *utils.Nat
 	pipelineHandler := handlers.NewPipelineHandler(cli, natsContext.NatsCon, db)
 	// Define routes
 	pipelinePrefix.Post("/", pipelineHandler.CreatePipeline)
+	pipelinePrefix.Get("/", pipelineHandler.ListPipelines)
+	pipelinePrefix.Get("/:name", pipelineHandler.GetPipeline)
+	pipelinePrefix.Put("/:name", pipelineHandler.UpdatePipeline)
+	pipelinePrefix.Delete("/:name", pipelineHandler.DeletePipeline)
 
 }
@@ -7,6 +7,7 @@ import (
 	"github.com/dgraph-io/badger/v4"
 	"github.com/gofiber/fiber/v2"
 	"github.com/open-ug/conveyor/internal/handlers"
+	"github.com/open-ug/conveyor/internal/streaming"
 	utils "github.com/open-ug/conveyor/internal/utils"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
@@ -18,16 +19,23 @@ func ResourceRoutes(app *fiber.App, cli *clientv3.Client, natsContext *utils.Nat
 	resourceDefinitionPrefix := app.Group("/resource-definitions")
 	resourceHandler := handlers.NewResourceHandler(cli, natsContext, db)
 	resourceDefinitionHandler := handlers.NewResourceDefinitionHandler(cli, natsContext.NatsCon, db)
+	resourceWatcher := streaming.NewResourceWatcher(resourceHandler.ResourceModel)
 
 	// Resource Routes
 	resourcePrefix.Post("/", resourceHandler.CreateResource)
-	resourcePrefix.Get("/:type/:name", resourceHandler.GetResource)
+	resourcePrefix.Get("/:type", resourceWatcher.Watch, resourceHandler.ListResources)
+	resourcePrefix.Get("/:type/:name", resourceWatcher.Watch, resourceHandler.GetResource)
 	resourcePrefix.Delete("/:type/:name", resourceHandler.DeleteResource)
 	resourcePrefix.Put("/:type/:name", resourceHandler.UpdateResource)
+	resourcePrefix.Put("/:type/:name/status", resourceHandler.UpdateResourceStatus)
+	resourcePrefix.Put("/:type/:name/finalizers/+", resourceHandler.AddResourceFinalizer)
+	resourcePrefix.Delete("/:type/:name/finalizers/+", resourceHandler.RemoveResourceFinalizer)
+	// Registered before the versions of a resource, which would match them
+	resourcePrefix.Get("/:type/:name/versions", resourceHandler.ListResourceVersions)
+	resourcePrefix.Get("/:type/:name/diff", resourceHandler.DiffResourceVersions)
+	resourcePrefix.Post("/:type/:name/rollback", resourceHandler.RollbackResource)
 	resourcePrefix.Get("/:type/:name/:version", resourceHandler.GetResourceByVersion)
 
-	resourcePrefix.Get("/", resourceHandler.ListResources)
-
 	// Resource Definition Routes
 	resourceDefinitionPrefix.Post("/", resourceDefinitionHandler.CreateResourceDefinition)
 	resourceDefinitionPrefix.Post("/apply", resourceDefinitionHandler.CreateOrUpdateResourceDefinition)
@@ -0,0 +1,32 @@
+/*
+Copyright © 2024 - Present Conveyor CI Contributors
+*/
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/open-ug/conveyor/internal/handlers"
+	"github.com/open-ug/conveyor/internal/storage"
+	"github.com/open-ug/conveyor/internal/streaming"
+	utils "github.com/open-ug/conveyor/internal/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func RunRoutes(app *fiber.App, cli *clientv3.Client, natsContext *utils.NatsContext, store storage.Store) {
+
+	// Initialize run and artifact handlers
+	runPrefix := app.Group("/runs")
+	runHandler := handlers.NewRunHandler(cli, natsContext.NatsCon)
+	runStatusStreamer := streaming.NewRunStatusStreamer(natsContext.NatsCon, runHandler.Model)
+	artifactHandler := handlers.NewArtifactHandler(store)
+
+	// Run Routes
+	runPrefix.Get("/:runid", runHandler.GetRun)
+	runPrefix.Get("/:runid/status", runStatusStreamer.StreamRunStatus)
+	runPrefix.Post("/:runid/cancel", runHandler.CancelRun)
+
+	// Artifact Routes
+	runPrefix.Put("/:runid/artifacts/*", artifactHandler.UploadArtifact)
+	runPrefix.Get("/:runid/artifacts/*", artifactHandler.DownloadArtifact)
+	runPrefix.Delete("/:runid/artifacts/*", artifactHandler.DeleteArtifact)
+}
@@ -0,0 +1,21 @@
+/*
+Copyright © 2024 - Present Conveyor CI Contributors
+*/
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/open-ug/conveyor/internal/handlers"
+)
+
+func WebhookRoutes(app *fiber.App, natsCon *nats.Conn) {
+
+	// Initialize webhook handler
+	webhookPrefix := app.Group("/webhooks")
+	webhookHandler := handlers.NewWebhookHandler(natsCon)
+
+	// Callbacks of webhook drivers, authenticated by the unguessable callback ID and the webhook signature
+	webhookPrefix.Post("/callbacks/:id/result", webhookHandler.PostCallbackResult)
+	webhookPrefix.Post("/callbacks/:id/logs", webhookHandler.PostCallbackLogs)
+}
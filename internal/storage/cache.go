@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/open-ug/conveyor/internal/models"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+const (
+	// DefaultCacheMaxSize is the size the build cache grows to when no limit is configured.
+	DefaultCacheMaxSize int64 = 10 << 30
+	// DefaultCacheTTL is how long cache entries are kept when no TTL is configured or requested.
+	DefaultCacheTTL = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrCacheMiss is returned when a cache entry does not exist or has expired.
+	ErrCacheMiss = errors.New("cache miss")
+	// ErrCacheEntryTooLarge is returned when an entry is larger than the whole cache.
+	ErrCacheEntryTooLarge = errors.New("cache entry too large")
+)
+
+// validCacheKey matches the keys cache entries can be stored under.
+var validCacheKey = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,254}$`)
+
+/*
+Cache is the build cache drivers share across runs, e.g. for Go module or npm caches.
+Entries are stored in a Store and indexed in BadgerDB. Entries with the same content share one stored object.
+When the cache grows beyond MaxSize, the least recently used entries are evicted. Expired entries are never served.
+*/
+type Cache struct {
+	Store   Store
+	Index   *models.CacheModel
+	MaxSize int64
+	TTL     time.Duration
+
+	// mu serializes changes to the index, so objects are only deleted once no entry refers to them
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+// NewCache creates a cache storing entries in store, configured by the cache configuration of the server.
+func NewCache(store Store, index *models.CacheModel, config types.CacheConfig) *Cache {
+	cache := &Cache{
+		Store:   store,
+		Index:   index,
+		MaxSize: config.MaxSize,
+		TTL:     config.TTL,
+		now:     time.Now,
+	}
+	if cache.MaxSize <= 0 {
+		cache.MaxSize = DefaultCacheMaxSize
+	}
+	if cache.TTL <= 0 {
+		cache.TTL = DefaultCacheTTL
+	}
+	return cache
+}
+
+// validateCacheKey rejects keys that are empty, too long or contain characters other than letters, digits, `.`, `_` and `-`.
+func validateCacheKey(key string) error {
+	if !validCacheKey.MatchString(key) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+/*
+Put stores the contents of r under key for ttl, replacing any existing entry. A ttl of zero uses the default TTL.
+If checksum is set, the entry is rejected with ErrChecksumMismatch when the content does not match it.
+*/
+func (c *Cache) Put(ctx context.Context, key string, r io.Reader, checksum string, ttl time.Duration) (types.CacheEntry, error) {
+	if err := validateCacheKey(key); err != nil {
+		return types.CacheEntry{}, err
+	}
+	if ttl <= 0 {
+		ttl = c.TTL
+	}
+
+	objectKey := "cache/objects/" + uuid.New().String()
+	object, err := c.Store.Put(ctx, objectKey, r, checksum)
+	if err != nil {
+		return types.CacheEntry{}, err
+	}
+	if object.Size > c.MaxSize {
+		c.Store.Delete(ctx, objectKey)
+		return types.CacheEntry{}, fmt.Errorf("%w: %d bytes exceed the cache size of %d bytes", ErrCacheEntryTooLarge, object.Size, c.MaxSize)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	records, err := c.Index.FindAll()
+	if err != nil {
+		c.Store.Delete(ctx, objectKey)
+		return types.CacheEntry{}, err
+	}
+
+	// Share the object of an entry with the same content
+	for _, record := range records {
+		if record.SHA256 == object.SHA256 && record.Size == object.Size {
+			c.Store.Delete(ctx, objectKey)
+			objectKey = record.Object
+			break
+		}
+	}
+
+	now := c.now()
+	record := models.CacheRecord{
+		CacheEntry: types.CacheEntry{
+			Key:       key,
+			Size:      object.Size,
+			SHA256:    object.SHA256,
+			CreatedAt: now,
+			LastUsed:  now,
+			ExpiresAt: now.Add(ttl),
+		},
+		Object: objectKey,
+	}
+	if err := c.Index.Save(record); err != nil {
+		return types.CacheEntry{}, err
+	}
+
+	var previous *models.CacheRecord
+	others := []models.CacheRecord{}
+	for _, existing := range records {
+		if existing.Key == key {
+			previous = &existing
+			continue
+		}
+		others = append(others, existing)
+	}
+	others = append(others, record)
+	if previous != nil && previous.Object != objectKey {
+		c.releaseObject(ctx, previous.Object, others)
+	}
+
+	if err := c.evict(ctx, others); err != nil {
+		return types.CacheEntry{}, err
+	}
+	return record.CacheEntry, nil
+}
+
+/*
+Lookup returns the entry stored under key and marks it as used.
+It returns ErrCacheMiss if the entry does not exist or has expired.
+*/
+func (c *Cache) Lookup(ctx context.Context, key string) (models.CacheRecord, error) {
+	if err := validateCacheKey(key); err != nil {
+		return models.CacheRecord{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	record, err := c.Index.FindOne(key)
+	if errors.Is(err, models.ErrCacheEntryNotFound) {
+		return models.CacheRecord{}, ErrCacheMiss
+	}
+	if err != nil {
+		return models.CacheRecord{}, err
+	}
+	if !c.now().Before(record.ExpiresAt) {
+		return models.CacheRecord{}, ErrCacheMiss
+	}
+
+	record.LastUsed = c.now()
+	if err := c.Index.Save(record); err != nil {
+		return models.CacheRecord{}, err
+	}
+	return record, nil
+}
+
+// Open opens the content of an entry returned by Lookup. The caller must close the returned reader.
+func (c *Cache) Open(ctx context.Context, record models.CacheRecord) (io.ReadCloser, error) {
+	reader, _, err := c.Store.Get(ctx, record.Object)
+	if errors.Is(err, ErrNotFound) {
+		// The object is gone, e.g. removed from the bucket by hand, so the entry is dropped
+		c.Delete(ctx, record.Key)
+		return nil, ErrCacheMiss
+	}
+	return reader, err
+}
+
+// Delete removes the entry stored under key.
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	if err := validateCacheKey(key); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	records, err := c.Index.FindAll()
+	if err != nil {
+		return err
+	}
+	for i, record := range records {
+		if record.Key == key {
+			return c.remove(ctx, records, i)
+		}
+	}
+	return ErrCacheMiss
+}
+
+// Evict removes expired entries and, if the cache is larger than MaxSize, the least recently used entries.
+func (c *Cache) Evict(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	records, err := c.Index.FindAll()
+	if err != nil {
+		return err
+	}
+	return c.evict(ctx, records)
+}
+
+// evict removes expired and least recently used entries from records. It must be called with mu held.
+func (c *Cache) evict(ctx context.Context, records []models.CacheRecord) error {
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].LastUsed.Before(records[j].LastUsed)
+	})
+
+	now := c.now()
+	for i := 0; i < len(records); {
+		if !now.Before(records[i].ExpiresAt) {
+			if err := c.remove(ctx, records, i); err != nil {
+				return err
+			}
+			records = append(records[:i], records[i+1:]...)
+			continue
+		}
+		i++
+	}
+
+	for len(records) > 0 && cacheSize(records) > c.MaxSize {
+		if err := c.remove(ctx, records, 0); err != nil {
+			return err
+		}
+		records = records[1:]
+	}
+	return nil
+}
+
+// remove deletes the entry at index i of records, and its object if no other entry shares it. It must be called with mu held.
+func (c *Cache) remove(ctx context.Context, records []models.CacheRecord, i int) error {
+	if err := c.Index.Delete(records[i].Key); err != nil {
+		return err
+	}
+	others := append(append([]models.CacheRecord(nil), records[:i]...), records[i+1:]...)
+	c.releaseObject(ctx, records[i].Object, others)
+	return nil
+}
+
+// releaseObject deletes an object unless one of records still refers to it.
+func (c *Cache) releaseObject(ctx context.Context, objectKey string, records []models.CacheRecord) {
+	for _, record := range records {
+		if record.Object == objectKey {
+			return
+		}
+	}
+	if err := c.Store.Delete(ctx, objectKey); err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Failed to delete cache object %s: %v", objectKey, err)
+	}
+}
+
+// cacheSize returns the stored size of records, counting shared objects once.
+func cacheSize(records []models.CacheRecord) int64 {
+	var size int64
+	seen := map[string]bool{}
+	for _, record := range records {
+		if !seen[record.Object] {
+			seen[record.Object] = true
+			size += record.Size
+		}
+	}
+	return size
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/open-ug/conveyor/internal/models"
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCache creates a cache on a filesystem store and an in-memory index, with a clock that tests advance by hand.
+func newTestCache(t *testing.T, maxSize int64) (*Cache, *time.Time) {
+	store, err := NewFileSystemStore(t.TempDir())
+	require.NoError(t, err)
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewCache(store, models.NewCacheModel(db), types.CacheConfig{MaxSize: maxSize, TTL: time.Hour})
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+func readEntry(t *testing.T, cache *Cache, key string) (string, error) {
+	record, err := cache.Lookup(context.Background(), key)
+	if err != nil {
+		return "", err
+	}
+	reader, err := cache.Open(context.Background(), record)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data), nil
+}
+
+// objects returns the number of objects the cache keeps in its store.
+func objects(t *testing.T, cache *Cache) int {
+	records, err := cache.Index.FindAll()
+	require.NoError(t, err)
+	seen := map[string]bool{}
+	for _, record := range records {
+		_, err := cache.Store.Stat(context.Background(), record.Object)
+		require.NoError(t, err)
+		seen[record.Object] = true
+	}
+	return len(seen)
+}
+
+func TestCache(t *testing.T) {
+	cache, _ := newTestCache(t, 1024)
+	ctx := context.Background()
+
+	entry, err := cache.Put(ctx, "go-mod-abc", strings.NewReader("modules"), "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), entry.Size)
+	assert.Equal(t, entry.CreatedAt.Add(time.Hour), entry.ExpiresAt)
+
+	data, err := readEntry(t, cache, "go-mod-abc")
+	require.NoError(t, err)
+	assert.Equal(t, "modules", data)
+
+	// Entries with the same content share one object
+	_, err = cache.Put(ctx, "go-mod-def", strings.NewReader("modules"), "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, objects(t, cache))
+
+	// Replacing an entry keeps the object while another entry uses it
+	_, err = cache.Put(ctx, "go-mod-abc", strings.NewReader("other modules"), "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, objects(t, cache))
+	data, err = readEntry(t, cache, "go-mod-def")
+	require.NoError(t, err)
+	assert.Equal(t, "modules", data)
+
+	require.NoError(t, cache.Delete(ctx, "go-mod-def"))
+	_, err = readEntry(t, cache, "go-mod-def")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+	assert.ErrorIs(t, cache.Delete(ctx, "go-mod-def"), ErrCacheMiss)
+	assert.Equal(t, 1, objects(t, cache))
+
+	_, err = cache.Put(ctx, "go-mod-abc", strings.NewReader("x"), "0000", 0)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	_, err = cache.Put(ctx, "../escape", strings.NewReader("x"), "", 0)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	_, err = cache.Put(ctx, "huge", strings.NewReader(strings.Repeat("x", 2048)), "", 0)
+	assert.ErrorIs(t, err, ErrCacheEntryTooLarge)
+}
+
+func TestCache_Eviction(t *testing.T) {
+	cache, now := newTestCache(t, 30)
+	ctx := context.Background()
+	advance := func() { *now = now.Add(time.Minute) }
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := cache.Put(ctx, key, strings.NewReader(strings.Repeat(key, 10)), "", 0)
+		require.NoError(t, err)
+		advance()
+	}
+
+	// Reading "a" makes "b" the least recently used entry
+	_, err := readEntry(t, cache, "a")
+	require.NoError(t, err)
+	advance()
+
+	_, err = cache.Put(ctx, "d", strings.NewReader(strings.Repeat("d", 10)), "", 0)
+	require.NoError(t, err)
+	_, err = readEntry(t, cache, "b")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+	for _, key := range []string{"a", "c", "d"} {
+		_, err = readEntry(t, cache, key)
+		assert.NoError(t, err, key)
+	}
+	assert.Equal(t, 3, objects(t, cache))
+
+	// Expired entries are not served and are removed on eviction
+	_, err = cache.Put(ctx, "short", strings.NewReader("s"), "", time.Minute)
+	require.NoError(t, err)
+	*now = now.Add(2 * time.Minute)
+	_, err = readEntry(t, cache, "short")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+
+	*now = now.Add(2 * time.Hour)
+	require.NoError(t, cache.Evict(ctx))
+	assert.Equal(t, 0, objects(t, cache))
+	records, err := cache.Index.FindAll()
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+/*
+FileSystemStore stores objects as files under a root directory.
+The contents of an object live under `objects/<key>` and its description,
+including the checksum, under `meta/<key>.json`.
+*/
+type FileSystemStore struct {
+	Root string
+}
+
+// NewFileSystemStore creates a store rooted at the given directory, creating it if needed.
+func NewFileSystemStore(root string) (*FileSystemStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &FileSystemStore{Root: root}, nil
+}
+
+// paths returns the object and metadata file paths of a key.
+func (s *FileSystemStore) paths(key string) (string, string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(s.Root, "objects", filepath.FromSlash(key)),
+		filepath.Join(s.Root, "meta", filepath.FromSlash(key)+".json"), nil
+}
+
+func (s *FileSystemStore) Put(ctx context.Context, key string, r io.Reader, checksum string) (Object, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return Object{}, err
+	}
+	objectPath, metaPath, _ := s.paths(key)
+	if s.conflicts(objectPath) {
+		return Object{}, fmt.Errorf("%w: %q", ErrKeyConflict, key)
+	}
+	for _, dir := range []string{filepath.Dir(objectPath), filepath.Dir(metaPath)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return Object{}, fmt.Errorf("failed to create object directory: %w", err)
+		}
+	}
+
+	// Stream into a temporary file first so readers never see a partial object
+	tmp, err := os.CreateTemp(filepath.Dir(objectPath), ".upload-*")
+	if err != nil {
+		return Object{}, fmt.Errorf("failed to create object: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Object{}, fmt.Errorf("failed to write object: %w", err)
+	}
+
+	object := Object{
+		Key:     key,
+		Size:    size,
+		SHA256:  hex.EncodeToString(hash.Sum(nil)),
+		ModTime: time.Now(),
+	}
+	if err := verifyChecksum(checksum, object.SHA256); err != nil {
+		return Object{}, err
+	}
+
+	if err := os.Rename(tmp.Name(), objectPath); err != nil {
+		return Object{}, fmt.Errorf("failed to store object: %w", err)
+	}
+	if err := writeMeta(metaPath, object); err != nil {
+		return Object{}, err
+	}
+	return object, nil
+}
+
+func (s *FileSystemStore) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	object, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	objectPath, _, _ := s.paths(key)
+
+	file, err := os.Open(objectPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Object{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Object{}, fmt.Errorf("failed to open object: %w", err)
+	}
+	return file, object, nil
+}
+
+func (s *FileSystemStore) Stat(ctx context.Context, key string) (Object, error) {
+	_, metaPath, err := s.paths(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	data, err := os.ReadFile(metaPath)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		// A directory of the key is another object
+		return Object{}, ErrNotFound
+	}
+	if err != nil {
+		return Object{}, fmt.Errorf("failed to read object metadata: %w", err)
+	}
+
+	var object Object
+	if err := json.Unmarshal(data, &object); err != nil {
+		return Object{}, fmt.Errorf("failed to unmarshal object metadata: %w", err)
+	}
+	return object, nil
+}
+
+func (s *FileSystemStore) Delete(ctx context.Context, key string) error {
+	objectPath, metaPath, err := s.paths(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(metaPath)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete object metadata: %w", err)
+	}
+	if err := os.Remove(objectPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	// Directories left empty would conflict with objects stored at their key later
+	s.removeEmptyDirs(filepath.Dir(objectPath), filepath.Join(s.Root, "objects"))
+	s.removeEmptyDirs(filepath.Dir(metaPath), filepath.Join(s.Root, "meta"))
+	return nil
+}
+
+// conflicts reports whether the object path is the directory of other objects, or one of its directories is another
+// object. The first directory that exists decides, as the ones above it are directories as well.
+func (s *FileSystemStore) conflicts(objectPath string) bool {
+	if info, err := os.Stat(objectPath); err == nil && info.IsDir() {
+		return true
+	}
+	root := filepath.Join(s.Root, "objects")
+	for dir := filepath.Dir(objectPath); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if info, err := os.Stat(dir); err == nil {
+			return !info.IsDir()
+		}
+	}
+	return false
+}
+
+// removeEmptyDirs removes dir and its parents up to root while they are empty.
+func (s *FileSystemStore) removeEmptyDirs(dir string, root string) {
+	for ; dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			// Not empty, or already gone
+			return
+		}
+	}
+}
+
+// writeMeta atomically writes the description of an object.
+func writeMeta(metaPath string, object Object) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return fmt.Errorf("failed to marshal object metadata: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(metaPath), ".meta-*")
+	if err != nil {
+		return fmt.Errorf("failed to create object metadata: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write object metadata: %w", err)
+	}
+	return os.Rename(tmp.Name(), metaPath)
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// objectStoreBucket is the JetStream object store bucket objects are kept in.
+const objectStoreBucket = "storage"
+
+// ObjectStore stores objects in a JetStream object store bucket.
+type ObjectStore struct {
+	Bucket jetstream.ObjectStore
+}
+
+// NewObjectStore creates a store backed by the `storage` object store bucket, creating the bucket if needed.
+func NewObjectStore(js jetstream.JetStream) (*ObjectStore, error) {
+	bucket, err := js.CreateOrUpdateObjectStore(context.Background(), jetstream.ObjectStoreConfig{
+		Bucket:      objectStoreBucket,
+		Description: "Artifacts uploaded by drivers",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object store: %w", err)
+	}
+	return &ObjectStore{Bucket: bucket}, nil
+}
+
+func (s *ObjectStore) Put(ctx context.Context, key string, r io.Reader, checksum string) (Object, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	if checksum != "" {
+		// A failed read drops the uploaded chunks and keeps the existing object
+		r = &checksumReader{r: r, hash: sha256.New(), checksum: checksum}
+	}
+	info, err := s.Bucket.Put(ctx, jetstream.ObjectMeta{Name: key}, r)
+	if errors.Is(err, ErrChecksumMismatch) {
+		return Object{}, err
+	}
+	if err != nil {
+		return Object{}, fmt.Errorf("failed to store object: %w", err)
+	}
+	return objectFromInfo(info)
+}
+
+// checksumReader hashes the contents read through it, and fails at their end when they do not match checksum.
+type checksumReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	checksum string
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.hash.Write(p[:n])
+	if err == io.EOF {
+		if verr := verifyChecksum(c.checksum, hex.EncodeToString(c.hash.Sum(nil))); verr != nil {
+			return n, verr
+		}
+	}
+	return n, err
+}
+
+func (s *ObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+
+	result, err := s.Bucket.Get(ctx, key)
+	if errors.Is(err, jetstream.ErrObjectNotFound) {
+		return nil, Object{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Object{}, fmt.Errorf("failed to open object: %w", err)
+	}
+
+	info, err := result.Info()
+	if err != nil {
+		result.Close()
+		return nil, Object{}, fmt.Errorf("failed to read object info: %w", err)
+	}
+	object, err := objectFromInfo(info)
+	if err != nil {
+		result.Close()
+		return nil, Object{}, err
+	}
+	return result, object, nil
+}
+
+func (s *ObjectStore) Stat(ctx context.Context, key string) (Object, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	info, err := s.Bucket.GetInfo(ctx, key)
+	if errors.Is(err, jetstream.ErrObjectNotFound) {
+		return Object{}, ErrNotFound
+	}
+	if err != nil {
+		return Object{}, fmt.Errorf("failed to read object info: %w", err)
+	}
+	return objectFromInfo(info)
+}
+
+func (s *ObjectStore) Delete(ctx context.Context, key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	// Deleting an object leaves a tombstone behind, which deletes again without an error
+	if _, err := s.Stat(ctx, key); err != nil {
+		return err
+	}
+
+	err = s.Bucket.Delete(ctx, key)
+	if errors.Is(err, jetstream.ErrObjectNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	return nil
+}
+
+// objectFromInfo converts the info of a JetStream object, whose digest is a base64 encoded SHA-256 checksum.
+func objectFromInfo(info *jetstream.ObjectInfo) (Object, error) {
+	sum, err := jetstream.DecodeObjectDigest(info.Digest)
+	if err != nil {
+		return Object{}, fmt.Errorf("failed to decode object digest: %w", err)
+	}
+
+	return Object{
+		Key:     info.Name,
+		Size:    int64(info.Size),
+		SHA256:  hex.EncodeToString(sum),
+		ModTime: info.ModTime,
+	}, nil
+}
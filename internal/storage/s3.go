@@ -0,0 +1,546 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+const (
+	// defaultS3Region is used when no region is configured, which S3-compatible servers like MinIO accept.
+	defaultS3Region = "us-east-1"
+	// defaultPresignExpiry is how long presigned download URLs stay valid when not configured.
+	defaultPresignExpiry = 15 * time.Minute
+	// s3ChecksumHeader is the user metadata header the SHA-256 checksum of objects stored by earlier versions is kept in.
+	s3ChecksumHeader = "X-Amz-Meta-Sha256"
+	// defaultS3PartSize is the size of the parts uploads are sent in, S3 needs parts of at least 5 MiB.
+	defaultS3PartSize = 8 << 20
+	// s3MetaPrefix is the prefix the description of each object is stored under, see metaKey.
+	s3MetaPrefix = ".meta/"
+)
+
+/*
+S3Store stores objects in a bucket of an S3-compatible object storage, such as AWS S3 or MinIO.
+Requests are signed with AWS Signature Version 4.
+Uploads are streamed to the storage in parts of PartSize, so only one part of an upload is held in memory.
+Since the checksum of an object is only known once it is uploaded, the description of every object is
+stored next to it under s3MetaPrefix.
+*/
+type S3Store struct {
+	// Endpoint is the base URL of the storage, e.g. `https://s3.eu-west-1.amazonaws.com`.
+	Endpoint *url.URL
+	// PublicEndpoint is the base URL presigned download URLs point at. Defaults to Endpoint.
+	PublicEndpoint *url.URL
+	Bucket         string
+	Region         string
+	// PathStyle addresses the bucket in the path (`endpoint/bucket/key`) instead of the host (`bucket.endpoint/key`).
+	PathStyle bool
+	// PresignExpiry is how long presigned download URLs stay valid.
+	PresignExpiry time.Duration
+	// PartSize is the size of the parts uploads are sent in. Uploads that fit in one part are sent in a single request.
+	PartSize int
+	// HTTPClient sends the requests to the storage.
+	HTTPClient *http.Client
+
+	accessKey string
+	secretKey string
+	now       func() time.Time
+}
+
+// NewS3Store creates a store for the bucket described by the S3 configuration of the server.
+func NewS3Store(config types.S3Config) (*S3Store, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, errors.New("s3 storage needs an endpoint and a bucket")
+	}
+	endpoint, err := parseS3Endpoint(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	publicEndpoint := endpoint
+	if config.PublicEndpoint != "" {
+		if publicEndpoint, err = parseS3Endpoint(config.PublicEndpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	store := &S3Store{
+		Endpoint:       endpoint,
+		PublicEndpoint: publicEndpoint,
+		Bucket:         config.Bucket,
+		Region:         config.Region,
+		PathStyle:      config.PathStyle,
+		PresignExpiry:  config.PresignExpiry,
+		PartSize:       defaultS3PartSize,
+		HTTPClient:     http.DefaultClient,
+		accessKey:      config.AccessKey,
+		secretKey:      config.SecretKey,
+		now:            time.Now,
+	}
+	if store.Region == "" {
+		store.Region = defaultS3Region
+	}
+	if store.PresignExpiry <= 0 {
+		store.PresignExpiry = defaultPresignExpiry
+	}
+	return store, nil
+}
+
+// parseS3Endpoint parses the base URL of the storage.
+func parseS3Endpoint(endpoint string) (*url.URL, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q: scheme and host are required", endpoint)
+	}
+	return u, nil
+}
+
+// objectURL returns the URL of the object stored under an already cleaned key.
+func (s *S3Store) objectURL(key string) *url.URL {
+	return s.urlAt(s.Endpoint, key)
+}
+
+// urlAt returns the URL of the object stored under an already cleaned key, relative to a base URL of the storage.
+func (s *S3Store) urlAt(endpoint *url.URL, key string) *url.URL {
+	u := *endpoint
+	basePath := strings.TrimRight(u.Path, "/")
+	if s.PathStyle {
+		basePath += "/" + s.Bucket
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+	}
+	u.Path = basePath + "/" + key
+	u.RawPath = awsURIEncode(basePath, false) + "/" + awsURIEncode(key, false)
+	u.RawQuery = ""
+	return &u
+}
+
+/*
+Put streams r to the storage. Contents that fit in one part are sent in a single request, larger
+contents in a multipart upload that is only completed once the checksum of the contents is verified,
+so a rejected upload keeps any existing object. The description of the object is stored afterwards.
+*/
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, checksum string) (Object, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	hash := sha256.New()
+	part := make([]byte, s.PartSize)
+	var size int64
+	var upload *s3Upload
+	defer func() {
+		if upload != nil && !upload.completed {
+			// Uploads that are neither completed nor aborted keep their parts in the bucket
+			upload.abort(context.WithoutCancel(ctx))
+		}
+	}()
+
+	for {
+		n, err := io.ReadFull(r, part)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return Object{}, fmt.Errorf("failed to read object: %w", err)
+		}
+		last := err != nil
+		hash.Write(part[:n])
+		size += int64(n)
+
+		if last && upload == nil {
+			// The contents fit in one part and are sent once they are verified
+			part = part[:n]
+			break
+		}
+		if upload == nil {
+			if upload, err = s.createMultipartUpload(ctx, key); err != nil {
+				return Object{}, fmt.Errorf("failed to store object: %w", err)
+			}
+		}
+		if n > 0 {
+			if err := upload.uploadPart(ctx, part[:n]); err != nil {
+				return Object{}, fmt.Errorf("failed to store object: %w", err)
+			}
+		}
+		if last {
+			break
+		}
+	}
+
+	object := Object{Key: key, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil)), ModTime: s.now()}
+	if err := verifyChecksum(checksum, object.SHA256); err != nil {
+		return Object{}, err
+	}
+
+	if upload == nil {
+		resp, err := s.send(ctx, http.MethodPut, key, nil, part)
+		if err != nil {
+			return Object{}, fmt.Errorf("failed to store object: %w", err)
+		}
+		resp.Body.Close()
+	} else if err := upload.complete(ctx); err != nil {
+		return Object{}, fmt.Errorf("failed to store object: %w", err)
+	}
+
+	meta, err := json.Marshal(object)
+	if err != nil {
+		return Object{}, err
+	}
+	resp, err := s.send(ctx, http.MethodPut, metaKey(key), nil, meta)
+	if err != nil {
+		return Object{}, fmt.Errorf("failed to store object metadata: %w", err)
+	}
+	resp.Body.Close()
+	return object, nil
+}
+
+// metaKey returns the key the description of the object stored under an already cleaned key is kept in.
+func metaKey(key string) string {
+	return s3MetaPrefix + key + ".json"
+}
+
+// s3Upload is a multipart upload of an object.
+type s3Upload struct {
+	store     *S3Store
+	key       string
+	id        string
+	parts     []s3Part
+	completed bool
+}
+
+// s3Part is an uploaded part of a multipart upload, as listed when the upload is completed.
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// createMultipartUpload starts a multipart upload of the object stored under an already cleaned key.
+func (s *S3Store) createMultipartUpload(ctx context.Context, key string) (*s3Upload, error) {
+	resp, err := s.send(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.UploadID == "" {
+		return nil, fmt.Errorf("s3 did not return an upload id: %v", err)
+	}
+	return &s3Upload{store: s, key: key, id: result.UploadID}, nil
+}
+
+// uploadPart sends the next part of the upload.
+func (u *s3Upload) uploadPart(ctx context.Context, data []byte) error {
+	number := len(u.parts) + 1
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {u.id}}
+	resp, err := u.store.send(ctx, http.MethodPut, u.key, query, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	u.parts = append(u.parts, s3Part{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	return nil
+}
+
+// complete assembles the uploaded parts into the object, replacing any existing object.
+func (u *s3Upload) complete(ctx context.Context) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: u.parts})
+	if err != nil {
+		return err
+	}
+	resp, err := u.store.send(ctx, http.MethodPost, u.key, url.Values{"uploadId": {u.id}}, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The storage reports some failures in the body of a successful response
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err == nil && result.XMLName.Local == "Error" {
+		return fmt.Errorf("s3 failed to complete upload: %s", result.Code)
+	}
+	u.completed = true
+	return nil
+}
+
+// abort drops the uploaded parts.
+func (u *s3Upload) abort(ctx context.Context) {
+	resp, err := u.store.send(ctx, http.MethodDelete, u.key, url.Values{"uploadId": {u.id}}, nil)
+	if err != nil {
+		log.Printf("Failed to abort upload of %s: %v", u.key, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+
+	object, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	resp, err := s.send(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	return resp.Body, object, nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (Object, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return Object{}, err
+	}
+
+	resp, err := s.send(ctx, http.MethodGet, metaKey(key), nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		// Objects stored by earlier versions keep their checksum in their user metadata
+		if resp, err = s.send(ctx, http.MethodHead, key, nil, nil); err != nil {
+			return Object{}, err
+		}
+		resp.Body.Close()
+		return objectFromResponse(key, resp), nil
+	}
+	if err != nil {
+		return Object{}, err
+	}
+	defer resp.Body.Close()
+
+	var object Object
+	if err := json.NewDecoder(resp.Body).Decode(&object); err != nil {
+		return Object{}, fmt.Errorf("failed to read object metadata: %w", err)
+	}
+	return object, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	// S3 reports success when deleting missing objects
+	if _, err := s.Stat(ctx, key); err != nil {
+		return err
+	}
+	key, _ = cleanKey(key)
+
+	for _, k := range []string{key, metaKey(key)} {
+		resp, err := s.send(ctx, http.MethodDelete, k, nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+	return nil
+}
+
+/*
+PresignGet returns a URL the object stored under key can be downloaded from without credentials.
+The URL is valid for PresignExpiry and points at the PublicEndpoint of the storage, so downloads do not pass through the API server.
+*/
+func (s *S3Store) PresignGet(ctx context.Context, key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	u := s.urlAt(s.PublicEndpoint, key)
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := s.scope(now)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.accessKey+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(s.PresignExpiry.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	query.Set("X-Amz-Signature", s.signature(now, canonicalRequest))
+	u.RawQuery = canonicalQuery(query)
+	return u.String(), nil
+}
+
+// send sends a signed request for the object stored under an already cleaned key.
+func (s *S3Store) send(ctx context.Context, method string, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := s.objectURL(key)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	payloadHash := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(payloadHash[:]))
+	return s.do(req)
+}
+
+// do sends a request and converts error responses of the storage.
+func (s *S3Store) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("s3 %s %s returned %d: %s", req.Method, req.URL.Path, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// objectFromResponse describes an object from the headers of a GET or HEAD response.
+func objectFromResponse(key string, resp *http.Response) Object {
+	object := Object{
+		Key:    key,
+		Size:   resp.ContentLength,
+		SHA256: resp.Header.Get(s3ChecksumHeader),
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		object.ModTime = modTime
+	}
+	return object
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req, signing the host and all x-amz-* headers.
+func (s *S3Store) sign(req *http.Request, payloadHash string) {
+	now := s.now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, s.scope(now), signedHeaders, s.signature(now, canonicalRequest)))
+}
+
+// scope returns the credential scope of requests signed at t.
+func (s *S3Store) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.Region + "/s3/aws4_request"
+}
+
+// signature signs a canonical request created at t.
+func (s *S3Store) signature(t time.Time, canonicalRequest string) string {
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		t.Format("20060102T150405Z"),
+		s.scope(t),
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query parameters sorted by name, as Signature Version 4 expects.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var params []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, awsURIEncode(name, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// awsURIEncode percent-encodes every byte except unreserved characters, and slashes unless encodeSlash is set.
+func awsURIEncode(s string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			encoded.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			encoded.WriteByte(c)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
@@ -0,0 +1,269 @@
+/*
+Package s3test provides an in-memory, MinIO-style stand-in for an S3-compatible object storage.
+It serves path-style PUT, GET, HEAD and DELETE object requests and multipart uploads for a single
+bucket and rejects requests that are not signed with the configured access key.
+*/
+package s3test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	// AccessKey is the access key requests to the server must be signed with.
+	AccessKey = "conveyor"
+	// SecretKey is the secret key matching AccessKey.
+	SecretKey = "conveyor-secret"
+)
+
+type object struct {
+	data     []byte
+	metadata http.Header
+	modTime  time.Time
+}
+
+// Server is a fake S3-compatible object storage.
+type Server struct {
+	// URL is the endpoint of the server. The bucket is addressed in the path.
+	URL string
+	// Bucket is the only bucket the server serves.
+	Bucket string
+
+	mu        sync.Mutex
+	objects   map[string]object
+	uploads   map[string]*upload
+	started   int
+	presigned int
+}
+
+// upload is a multipart upload that is neither completed nor aborted.
+type upload struct {
+	key   string
+	parts map[int][]byte
+}
+
+// NewServer starts a fake storage serving the given bucket. It is stopped when the test finishes.
+func NewServer(t testing.TB, bucket string) *Server {
+	s := &Server{Bucket: bucket, objects: map[string]object{}, uploads: map[string]*upload{}}
+	server := httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(server.Close)
+	s.URL = server.URL
+	return s
+}
+
+// Uploads returns how many multipart uploads are neither completed nor aborted.
+func (s *Server) Uploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+// PresignedRequests returns how many requests were authenticated with a presigned URL.
+func (s *Server) PresignedRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.presigned
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+s.Bucket+"/")
+	if !ok || key == "" {
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if !s.authorized(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.createUpload(w, key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		s.uploadPart(w, r, query.Get("uploadId"), query.Get("partNumber"))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.completeUpload(w, r, key, query.Get("uploadId"))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		s.mu.Lock()
+		delete(s.uploads, query.Get("uploadId"))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		s.putObject(w, r, key)
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		s.getObject(w, r, key)
+	case r.Method == http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// authorized checks that a request carries credentials of AccessKey, in its headers or a presigned URL.
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	credential := "Credential=" + AccessKey + "/"
+	if strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 "+credential) {
+		return true
+	}
+
+	query := r.URL.Query()
+	if r.Method == http.MethodGet && strings.HasPrefix("Credential="+query.Get("X-Amz-Credential"), credential) && query.Get("X-Amz-Signature") != "" {
+		signed, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+		expires, _ := time.ParseDuration(query.Get("X-Amz-Expires") + "s")
+		if err != nil || time.Now().After(signed.Add(expires)) {
+			writeError(w, http.StatusForbidden, "AccessDenied")
+			return false
+		}
+		s.mu.Lock()
+		s.presigned++
+		s.mu.Unlock()
+		return true
+	}
+
+	writeError(w, http.StatusForbidden, "AccessDenied")
+	return false
+}
+
+// readBody reads the body of a request and checks it against its signed payload hash.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody")
+		return nil, false
+	}
+	sum := sha256.Sum256(data)
+	if payloadHash := r.Header.Get("X-Amz-Content-Sha256"); payloadHash != "UNSIGNED-PAYLOAD" && payloadHash != hex.EncodeToString(sum[:]) {
+		writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+		return nil, false
+	}
+	return data, true
+}
+
+func (s *Server) createUpload(w http.ResponseWriter, key string) {
+	s.mu.Lock()
+	s.started++
+	id := fmt.Sprintf("upload-%d", s.started)
+	s.uploads[id] = &upload{key: key, parts: map[int][]byte{}}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, "<InitiateMultipartUploadResult><Key>"+key+"</Key><UploadId>"+id+"</UploadId></InitiateMultipartUploadResult>")
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, id string, partNumber string) {
+	data, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	var number int
+	if _, err := fmt.Sscan(partNumber, &number); err != nil || number < 1 {
+		writeError(w, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	u.parts[number] = data
+	sum := sha256.Sum256(data)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+}
+
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, key string, id string) {
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	var request struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &request); err != nil || len(request.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[id]
+	if !ok || u.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	var data []byte
+	for _, part := range request.Parts {
+		partData, ok := u.parts[part.PartNumber]
+		sum := sha256.Sum256(partData)
+		if !ok || part.ETag != `"`+hex.EncodeToString(sum[:16])+`"` {
+			writeError(w, http.StatusBadRequest, "InvalidPart")
+			return
+		}
+		data = append(data, partData...)
+	}
+	delete(s.uploads, id)
+	s.objects[key] = object{data: data, metadata: http.Header{}, modTime: time.Now()}
+
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, "<CompleteMultipartUploadResult><Key>"+key+"</Key></CompleteMultipartUploadResult>")
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, key string) {
+	data, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+
+	metadata := http.Header{}
+	for name, values := range r.Header {
+		if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") {
+			metadata[name] = values
+		}
+	}
+
+	s.mu.Lock()
+	s.objects[key] = object{data: data, metadata: metadata, modTime: time.Now()}
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	s.mu.Lock()
+	obj, ok := s.objects[key]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	for name, values := range obj.metadata {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+	http.ServeContent(w, r, "", obj.modTime, strings.NewReader(string(obj.data)))
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, "<Error><Code>"+code+"</Code></Error>")
+}
@@ -0,0 +1,93 @@
+/*
+Package storage stores the files drivers hand to each other, such as build artifacts.
+Files are streamed into and out of a Store and checksummed with SHA-256 on the way in.
+*/
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/open-ug/conveyor/internal/utils"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+var (
+	// ErrNotFound is returned when an object does not exist.
+	ErrNotFound = errors.New("object not found")
+	// ErrInvalidKey is returned for keys that are empty or escape the store, e.g. `../secrets`.
+	ErrInvalidKey = errors.New("invalid object key")
+	// ErrChecksumMismatch is returned when uploaded content does not match the expected checksum.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrKeyConflict is returned when an object cannot be stored because its key is the directory of other keys,
+	// or a directory of it is the key of another object, e.g. `a` and `a/b`.
+	ErrKeyConflict = errors.New("object key conflicts with another key")
+)
+
+// Object describes a stored file.
+type Object struct {
+	// Key is the slash separated key the object is stored under.
+	Key string `json:"key"`
+	// Size is the size of the object in bytes.
+	Size int64 `json:"size"`
+	// SHA256 is the hex encoded SHA-256 checksum of the object.
+	SHA256 string `json:"sha256"`
+	// ModTime is the time the object was stored.
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Store is a backend objects are streamed to and from.
+type Store interface {
+	// Put stores the contents of r under key, replacing any existing object. If checksum is set, the contents are
+	// rejected with ErrChecksumMismatch when their hex encoded SHA-256 checksum does not match it, and any existing
+	// object is kept.
+	Put(ctx context.Context, key string, r io.Reader, checksum string) (Object, error)
+	// Get opens the object stored under key. The caller must close the returned reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	// Stat returns the description of the object stored under key.
+	Stat(ctx context.Context, key string) (Object, error)
+	// Delete removes the object stored under key.
+	Delete(ctx context.Context, key string) error
+}
+
+// Presigner is implemented by stores that can hand out URLs clients download objects from directly.
+type Presigner interface {
+	// PresignGet returns a URL the object stored under key can be downloaded from without credentials.
+	PresignGet(ctx context.Context, key string) (string, error)
+}
+
+// New creates the store selected by the storage configuration of the server.
+func New(config *types.ServerConfig, natsContext *utils.NatsContext) (Store, error) {
+	switch config.Storage.Backend {
+	case "", "filesystem":
+		return NewFileSystemStore(path.Join(config.API.Data, "storage"))
+	case "jetstream":
+		return NewObjectStore(natsContext.JetStream)
+	case "s3":
+		return NewS3Store(config.Storage.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", config.Storage.Backend)
+	}
+}
+
+// verifyChecksum returns ErrChecksumMismatch when checksum is set and differs from the checksum of the stored contents.
+func verifyChecksum(checksum string, sum string) error {
+	if checksum != "" && !strings.EqualFold(checksum, sum) {
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, checksum, sum)
+	}
+	return nil
+}
+
+// cleanKey normalizes a key and rejects keys that are empty or point outside the store.
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || strings.Contains(key, "\\") || strings.Contains("/"+key+"/", "/../") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return cleaned, nil
+}
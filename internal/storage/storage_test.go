@@ -0,0 +1,138 @@
+package storage_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/open-ug/conveyor/internal/storage"
+	"github.com/open-ug/conveyor/internal/storage/s3test"
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newJetStream(t *testing.T) jetstream.JetStream {
+	natsServer, err := server.NewServer(&server.Options{Port: -1, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true})
+	require.NoError(t, err)
+	go natsServer.Start()
+	require.True(t, natsServer.ReadyForConnections(10*time.Second))
+	t.Cleanup(natsServer.Shutdown)
+
+	nc, err := nats.Connect(natsServer.ClientURL())
+	require.NoError(t, err)
+	t.Cleanup(nc.Close)
+
+	js, err := jetstream.New(nc)
+	require.NoError(t, err)
+	return js
+}
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) storage.Store{
+		"filesystem": func(t *testing.T) storage.Store {
+			store, err := storage.NewFileSystemStore(t.TempDir())
+			require.NoError(t, err)
+			return store
+		},
+		"jetstream": func(t *testing.T) storage.Store {
+			store, err := storage.NewObjectStore(newJetStream(t))
+			require.NoError(t, err)
+			return store
+		},
+		"s3": func(t *testing.T) storage.Store {
+			server := s3test.NewServer(t, "conveyor")
+			store, err := storage.NewS3Store(types.S3Config{
+				Endpoint:  server.URL,
+				Bucket:    server.Bucket,
+				AccessKey: s3test.AccessKey,
+				SecretKey: s3test.SecretKey,
+				PathStyle: true,
+			})
+			require.NoError(t, err)
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			content := strings.Repeat("conveyor artifact\n", 100000)
+			sum := sha256.Sum256([]byte(content))
+
+			object, err := store.Put(ctx, "artifacts/run-1/bin/app", strings.NewReader(content), "")
+			require.NoError(t, err)
+			assert.Equal(t, "artifacts/run-1/bin/app", object.Key)
+			assert.Equal(t, int64(len(content)), object.Size)
+			assert.Equal(t, hex.EncodeToString(sum[:]), object.SHA256)
+
+			stat, err := store.Stat(ctx, "artifacts/run-1/bin/app")
+			require.NoError(t, err)
+			assert.Equal(t, object.SHA256, stat.SHA256)
+
+			reader, got, err := store.Get(ctx, "/artifacts/run-1/bin//app")
+			require.NoError(t, err)
+			data, err := io.ReadAll(reader)
+			reader.Close()
+			require.NoError(t, err)
+			assert.Equal(t, content, string(data))
+			assert.Equal(t, object.Size, got.Size)
+
+			// Replacing an object updates its checksum
+			object, err = store.Put(ctx, "artifacts/run-1/bin/app", strings.NewReader("v2"), "")
+			require.NoError(t, err)
+			assert.Equal(t, int64(2), object.Size)
+
+			// Contents that do not match the checksum keep the existing object
+			_, err = store.Put(ctx, "artifacts/run-1/bin/app", strings.NewReader("v3"), object.SHA256)
+			assert.ErrorIs(t, err, storage.ErrChecksumMismatch)
+			stat, err = store.Stat(ctx, "artifacts/run-1/bin/app")
+			require.NoError(t, err)
+			assert.Equal(t, object.SHA256, stat.SHA256)
+
+			require.NoError(t, store.Delete(ctx, "artifacts/run-1/bin/app"))
+			_, _, err = store.Get(ctx, "artifacts/run-1/bin/app")
+			assert.ErrorIs(t, err, storage.ErrNotFound)
+			assert.ErrorIs(t, store.Delete(ctx, "artifacts/run-1/bin/app"), storage.ErrNotFound)
+
+			_, err = store.Put(ctx, "artifacts/../../etc/passwd", strings.NewReader("x"), "")
+			assert.ErrorIs(t, err, storage.ErrInvalidKey)
+			_, err = store.Stat(ctx, "")
+			assert.ErrorIs(t, err, storage.ErrInvalidKey)
+		})
+	}
+}
+
+func TestFileSystemStore_KeyConflicts(t *testing.T) {
+	store, err := storage.NewFileSystemStore(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = store.Put(ctx, "artifacts/run-1/bin", strings.NewReader("file"), "")
+	require.NoError(t, err)
+	_, err = store.Put(ctx, "artifacts/run-2/bin/app", strings.NewReader("file"), "")
+	require.NoError(t, err)
+
+	// A key cannot be both a file and the directory of other keys
+	_, err = store.Put(ctx, "artifacts/run-1/bin/app", strings.NewReader("nested"), "")
+	assert.ErrorIs(t, err, storage.ErrKeyConflict)
+	_, err = store.Put(ctx, "artifacts/run-2/bin", strings.NewReader("parent"), "")
+	assert.ErrorIs(t, err, storage.ErrKeyConflict)
+	_, err = store.Stat(ctx, "artifacts/run-1/bin/app")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	assert.ErrorIs(t, store.Delete(ctx, "artifacts/run-1/bin/app"), storage.ErrNotFound)
+
+	// Deleting the last key of a directory frees its name
+	require.NoError(t, store.Delete(ctx, "artifacts/run-2/bin/app"))
+	_, err = store.Put(ctx, "artifacts/run-2/bin", strings.NewReader("parent"), "")
+	assert.NoError(t, err)
+}
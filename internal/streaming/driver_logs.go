@@ -2,6 +2,7 @@ package streaming
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -33,8 +34,11 @@ func NewDriverLogsStreamer(NatsCon *nats.Conn, LogModel *models.LogModel) *Drive
 // @Produce json
 // @Param drivername path string true "Driver Name"
 // @Param runid path string true "Run ID"
+// @Param step query string false "Step ID"
+// @Param level query string false "Minimum log level: debug, info, warn or error"
+// @Param labels query string false "Comma separated key=value labels the logs must have"
 // @Success 200 {string} string "Stream of log entries"
-// @Failure 400 {object} map[string]string "Bad request - Invalid driver name or run ID"
+// @Failure 400 {object} map[string]string "Bad request - Invalid driver name, run ID, level or labels"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /logs/streams/{drivername}/{runid} [get]
 func (s *DriverLogsStreamer) StreamDriverLogsByRunID(c *fiber.Ctx) error {
@@ -47,8 +51,13 @@ func (s *DriverLogsStreamer) StreamDriverLogsByRunID(c *fiber.Ctx) error {
 	driverName := c.Params("drivername")
 	runID := c.Params("runid")
 
+	filter, err := models.NewLogFilter("", driverName, runID, c.Query("step"), c.Query("level"), c.Query("labels"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
 	// Get the logs from the database
-	logs, err := s.LogModel.Query("", driverName, runID)
+	logs, err := s.LogModel.Find(filter)
 	if err != nil {
 		fmt.Println("Error getting logs:", err)
 		return c.Status(fiber.StatusInternalServerError).SendString("Error getting logs")
@@ -108,7 +117,21 @@ func (s *DriverLogsStreamer) StreamDriverLogsByRunID(c *fiber.Ctx) error {
 					}
 
 				case msg := <-msgCh:
-					fmt.Fprintf(w, "data: %s\n\n", msg.Data)
+					// A message holds one log, or a batch of newline delimited logs
+					entries, err := models.DecodeLogs(bytes.NewReader(msg.Data))
+					if err != nil {
+						continue
+					}
+					for _, logEntry := range entries {
+						if !filter.Matches(logEntry) {
+							continue
+						}
+						jsonData, err := json.Marshal(logEntry)
+						if err != nil {
+							continue
+						}
+						fmt.Fprintf(w, "data: %s\n\n", jsonData)
+					}
 					if err := w.Flush(); err != nil {
 						return
 					}
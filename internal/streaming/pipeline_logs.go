@@ -2,6 +2,7 @@ package streaming
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -33,8 +34,11 @@ func NewPipelineLogsStreamer(natsContext *utils.NatsContext, logModel *models.Lo
 // @Accept json
 // @Produce json
 // @Param runid path string true "Run ID"
+// @Param step query string false "Step ID"
+// @Param level query string false "Minimum log level: debug, info, warn or error"
+// @Param labels query string false "Comma separated key=value labels the logs must have"
 // @Success 200 {string} string "Stream of log entries"
-// @Failure 400 {object} map[string]string "Bad request - Invalid run ID"
+// @Failure 400 {object} map[string]string "Bad request - Invalid run ID, level or labels"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /logs/pipeline/{runid} [get]
 func (s *PipelineLogsStreamer) StreamLogsByRunID(c *fiber.Ctx) error {
@@ -46,7 +50,13 @@ func (s *PipelineLogsStreamer) StreamLogsByRunID(c *fiber.Ctx) error {
 
 	runID := c.Params("runid")
 
-	logs, err := s.LogModal.Query("", "", runID)
+	filter, err := models.NewLogFilter("", "", runID, c.Query("step"), c.Query("level"), c.Query("labels"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+
+	// Get the logs from the database
+	logs, err := s.LogModal.Find(filter)
 	if err != nil {
 		fmt.Println("Error getting logs:", err)
 		return c.Status(fiber.StatusInternalServerError).SendString("Error getting logs")
@@ -104,7 +114,21 @@ func (s *PipelineLogsStreamer) StreamLogsByRunID(c *fiber.Ctx) error {
 					}
 
 				case msg := <-msgCh:
-					fmt.Fprintf(w, "data: %s\n\n", msg.Data)
+					// A message holds one log, or a batch of newline delimited logs
+					entries, err := models.DecodeLogs(bytes.NewReader(msg.Data))
+					if err != nil {
+						continue
+					}
+					for _, logEntry := range entries {
+						if !filter.Matches(logEntry) {
+							continue
+						}
+						jsonData, err := json.Marshal(logEntry)
+						if err != nil {
+							continue
+						}
+						fmt.Fprintf(w, "data: %s\n\n", jsonData)
+					}
 					if err := w.Flush(); err != nil {
 						return
 					}
@@ -0,0 +1,121 @@
+package streaming
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/open-ug/conveyor/internal/models"
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/valyala/fasthttp"
+)
+
+// ndjsonContentType is the content type of watches streamed as newline delimited JSON.
+const ndjsonContentType = "application/x-ndjson"
+
+type ResourceWatcher struct {
+	ResourceModel *models.ResourceModel
+}
+
+func NewResourceWatcher(resourceModel *models.ResourceModel) *ResourceWatcher {
+
+	return &ResourceWatcher{
+		ResourceModel: resourceModel,
+	}
+}
+
+/*
+Watch streams the changes of the resources of a type, or of the resource in the `name` path parameter,
+when the request has the `watch=true` query parameter. Other requests are passed to the next handler.
+
+Changes are streamed as Server-Sent Events, or as newline delimited JSON when the request accepts
+application/x-ndjson. Each change is a types.WatchEvent. The `revision` query parameter, or the
+Last-Event-ID header sent by reconnecting EventSources, resumes a watch after the given revision.
+The `labels` query parameter restricts the watch to the resources matching a label selector.
+*/
+func (s *ResourceWatcher) Watch(c *fiber.Ctx) error {
+	if !c.QueryBool("watch") {
+		return c.Next()
+	}
+
+	revision, err := strconv.ParseInt(c.Query("revision", c.Get("Last-Event-ID", "0")), 10, 64)
+	if err != nil || revision < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Revision must be a non-negative number",
+		})
+	}
+	selector, err := types.ParseLabelSelector(c.Query("labels"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	ndjson := c.Accepts("text/event-stream", ndjsonContentType) == ndjsonContentType
+
+	// Set headers for streaming
+	if ndjson {
+		c.Set("Content-Type", ndjsonContentType)
+	} else {
+		c.Set("Content-Type", "text/event-stream")
+	}
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("Transfer-Encoding", "chunked")
+
+	// The watch is started before the response, so no change is missed
+	ctx, cancel := context.WithCancel(context.Background())
+	events := s.ResourceModel.Watch(ctx, c.Params("type"), c.Params("name"), revision, selector)
+
+	c.Status(fiber.StatusOK).Context().SetBodyStreamWriter(
+		fasthttp.StreamWriter(func(w *bufio.Writer) {
+			// Writes fail once the client is gone, which stops the watch
+			defer cancel()
+
+			//Heartbeat ticker
+			heartbeat := time.NewTicker(15 * time.Second)
+			defer heartbeat.Stop()
+
+			for {
+				select {
+				case <-heartbeat.C:
+					if ndjson {
+						fmt.Fprint(w, "\n")
+					} else {
+						fmt.Fprintf(w, ": heartbeat\n\n")
+					}
+					if err := w.Flush(); err != nil {
+						return
+					}
+
+				case event, ok := <-events:
+					if !ok {
+						return
+					}
+					jsonData, err := json.Marshal(event)
+					if err != nil {
+						fmt.Println("Error: failed to marshal json")
+						continue
+					}
+					switch {
+					case ndjson:
+						fmt.Fprintf(w, "%s\n", jsonData)
+					case event.Type == types.WatchError:
+						fmt.Fprintf(w, "data: %s\n\n", jsonData)
+					default:
+						// The ID is sent back in Last-Event-ID when an EventSource reconnects
+						fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.Revision, jsonData)
+					}
+					if err := w.Flush(); err != nil {
+						return
+					}
+				}
+			}
+		}),
+	)
+
+	return nil
+}
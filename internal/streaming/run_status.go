@@ -0,0 +1,117 @@
+package streaming
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/open-ug/conveyor/internal/models"
+	"github.com/valyala/fasthttp"
+)
+
+type RunStatusStreamer struct {
+	NatsCon  *nats.Conn
+	RunModel *models.RunModel
+}
+
+func NewRunStatusStreamer(natsCon *nats.Conn, runModel *models.RunModel) *RunStatusStreamer {
+
+	return &RunStatusStreamer{
+		NatsCon:  natsCon,
+		RunModel: runModel,
+	}
+}
+
+// StreamRunStatus streams the status of a run using Server-Sent Events (SSE)
+// @Summary Stream the status of a run
+// @Description Streams the run record, including the step states and driver progress, every time it changes using Server-Sent Events (SSE)
+// @Tags runs
+// @Accept json
+// @Produce json
+// @Param runid path string true "Run ID"
+// @Success 200 {string} string "Stream of run records"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /runs/{runid}/status [get]
+func (s *RunStatusStreamer) StreamRunStatus(c *fiber.Ctx) error {
+	// Set headers for SSE
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("Transfer-Encoding", "chunked")
+
+	runID := c.Params("runid")
+
+	// The run record may not exist yet when the client connects right after triggering the run
+	run, err := s.RunModel.FindOne(runID)
+	if err != nil && !errors.Is(err, models.ErrRunNotFound) {
+		fmt.Println("Error getting run:", err)
+		return c.Status(fiber.StatusInternalServerError).SendString("Error getting run")
+	}
+	found := err == nil
+
+	c.Status(fiber.StatusOK).Context().SetBodyStreamWriter(
+		fasthttp.StreamWriter(func(w *bufio.Writer) {
+
+			// Channel for incoming NATS messages
+			msgCh := make(chan *nats.Msg, 256)
+
+			// Subscribe before sending the current state so no update is missed in between
+			sub, err := s.NatsCon.Subscribe(
+				"live.runs."+runID,
+				func(msg *nats.Msg) {
+					select {
+					case msgCh <- msg:
+					default:
+						// Drop message if client is slow, the next update carries the full state
+					}
+				},
+			)
+			if err != nil {
+				return
+			}
+			defer sub.Unsubscribe()
+
+			// Send the current state first
+			if found {
+				jsonData, err := json.Marshal(run)
+				if err != nil {
+					fmt.Println("Error: failed to marshal json")
+					return
+				}
+				fmt.Fprintf(w, "data: %s\n\n", jsonData)
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+
+			//Heartbeat ticker
+			heartbeat := time.NewTicker(15 * time.Second)
+			defer heartbeat.Stop()
+
+			// Streaming loop
+			for {
+				select {
+				case <-heartbeat.C:
+					// SSE heartbeat (comment line)
+					fmt.Fprintf(w, ": heartbeat\n\n")
+					if err := w.Flush(); err != nil {
+						return
+					}
+
+				case msg := <-msgCh:
+					fmt.Fprintf(w, "data: %s\n\n", msg.Data)
+					if err := w.Flush(); err != nil {
+						return
+					}
+
+				}
+			}
+		}),
+	)
+
+	return nil
+}
@@ -156,6 +156,29 @@ func (n *NatsContext) InitiateStreams() error {
 		return err
 	}
 
+	// Create a stream for driver progress reports
+	_, err = n.JetStream.CreateOrUpdateStream(context.Background(),
+		jetstream.StreamConfig{
+			Name:      "runs-engine",
+			Subjects:  []string{"runs.progress.>"},
+			Retention: jetstream.WorkQueuePolicy,
+		})
+	if err != nil {
+		return err
+	}
+
+	// Create a key-value bucket where running driver managers register themselves
+	_, err = n.JetStream.CreateOrUpdateKeyValue(context.Background(),
+		jetstream.KeyValueConfig{
+			Bucket:      "drivers",
+			Description: "Registry of running driver manager instances",
+			// Instances renew their entry while they run, entries of crashed instances expire
+			TTL: types.DriverRegistrationTTL,
+		})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -0,0 +1,116 @@
+package driverruntime
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+// checksumHeader carries the hex encoded SHA-256 checksum of an artifact.
+const checksumHeader = "X-Checksum-Sha256"
+
+// artifactURL returns the URL of an artifact, escaping every segment of its path.
+func (c *Client) artifactURL(runID string, artifactPath string) string {
+	segments := strings.Split(strings.Trim(artifactPath, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return fmt.Sprintf("%s/runs/%s/artifacts/%s", strings.TrimRight(c.HTTPClient.BaseURL, "/"), url.PathEscape(runID), strings.Join(segments, "/"))
+}
+
+// responseChecksum returns the checksum the API sent, which is on the redirect response when the download was redirected to object storage.
+func responseChecksum(resp *http.Response) string {
+	for resp != nil {
+		if checksum := resp.Header.Get(checksumHeader); checksum != "" {
+			return checksum
+		}
+		if resp.Request == nil {
+			break
+		}
+		resp = resp.Request.Response
+	}
+	return ""
+}
+
+/*
+Uploads an artifact of a run to the Conveyor API.
+The body is streamed to the API server, so large files are not held in memory.
+Artifacts let drivers hand files, such as built binaries, to drivers of later steps that may run on other hosts.
+Uploading to an existing path replaces the artifact.
+*/
+func (c *Client) UploadArtifact(ctx context.Context, runID string, artifactPath string, body io.Reader) (*types.Artifact, error) {
+	req, err := c.newRequest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("UploadArtifact: %w", err)
+	}
+
+	resp, err := req.
+		SetHeader("Content-Type", "application/octet-stream").
+		SetBody(body).
+		Put(c.artifactURL(runID, artifactPath))
+	if err != nil {
+		return nil, fmt.Errorf("UploadArtifact: failed to upload artifact, %w", err)
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("UploadArtifact: %w", newAPIError(resp.StatusCode(), resp.Body()))
+	}
+
+	var artifact types.Artifact
+	if err := json.Unmarshal(resp.Body(), &artifact); err != nil {
+		return nil, fmt.Errorf("UploadArtifact: failed to unmarshal response body: %w", err)
+	}
+	return &artifact, nil
+}
+
+/*
+Downloads an artifact of a run from the Conveyor API and writes it to w.
+The artifact is streamed into w and its SHA-256 checksum is verified against the one the server stored.
+When the server stores artifacts in object storage, the download is redirected to the storage directly.
+An error is returned if the checksum does not match, in which case w has received corrupt data.
+*/
+func (c *Client) DownloadArtifact(ctx context.Context, runID string, artifactPath string, w io.Writer) (*types.Artifact, error) {
+	req, err := c.newRequest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("DownloadArtifact: %w", err)
+	}
+
+	resp, err := req.
+		SetDoNotParseResponse(true).
+		Get(c.artifactURL(runID, artifactPath))
+	if err != nil {
+		return nil, fmt.Errorf("DownloadArtifact: failed to download artifact, %w", err)
+	}
+	body := resp.RawBody()
+	defer body.Close()
+
+	if resp.IsError() {
+		message, _ := io.ReadAll(body)
+		return nil, fmt.Errorf("DownloadArtifact: %w", newAPIError(resp.StatusCode(), message))
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, hash), body)
+	if err != nil {
+		return nil, fmt.Errorf("DownloadArtifact: failed to read artifact, %w", err)
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if expected := responseChecksum(resp.RawResponse); expected != "" && !strings.EqualFold(expected, checksum) {
+		return nil, fmt.Errorf("DownloadArtifact: checksum mismatch, expected %s, got %s", expected, checksum)
+	}
+
+	return &types.Artifact{
+		RunID:  runID,
+		Path:   strings.Trim(artifactPath, "/"),
+		Size:   size,
+		SHA256: checksum,
+	}, nil
+}
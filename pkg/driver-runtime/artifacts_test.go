@@ -0,0 +1,97 @@
+package driverruntime_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/open-ug/conveyor/internal/handlers"
+	"github.com/open-ug/conveyor/internal/storage"
+	"github.com/open-ug/conveyor/internal/storage/s3test"
+	driverruntime "github.com/open-ug/conveyor/pkg/driver-runtime"
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startArtifactServer serves the artifact routes backed by store.
+func startArtifactServer(t *testing.T, store storage.Store) string {
+	artifactHandler := handlers.NewArtifactHandler(store)
+
+	app := fiber.New(fiber.Config{StreamRequestBody: true, DisableStartupMessage: true})
+	app.Put("/runs/:runid/artifacts/*", artifactHandler.UploadArtifact)
+	app.Get("/runs/:runid/artifacts/*", artifactHandler.DownloadArtifact)
+	app.Delete("/runs/:runid/artifacts/*", artifactHandler.DeleteArtifact)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(listener)
+	t.Cleanup(func() { app.Shutdown() })
+
+	return "http://" + listener.Addr().String()
+}
+
+func TestClient_Artifacts(t *testing.T) {
+	store, err := storage.NewFileSystemStore(t.TempDir())
+	require.NoError(t, err)
+	client, err := driverruntime.NewClient(startArtifactServer(t, store), "", driverruntime.ConfigOptions{})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Larger than the default request body limit, so the upload is streamed
+	content := strings.Repeat("0123456789abcdef", 512*1024)
+	sum := sha256.Sum256([]byte(content))
+
+	uploaded, err := client.UploadArtifact(ctx, "run-1", "bin/my app", strings.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, "run-1", uploaded.RunID)
+	assert.Equal(t, "bin/my app", uploaded.Path)
+	assert.Equal(t, int64(len(content)), uploaded.Size)
+	assert.Equal(t, hex.EncodeToString(sum[:]), uploaded.SHA256)
+
+	var downloaded bytes.Buffer
+	artifact, err := client.DownloadArtifact(ctx, "run-1", "bin/my app", &downloaded)
+	require.NoError(t, err)
+	assert.Equal(t, content, downloaded.String())
+	assert.Equal(t, uploaded.SHA256, artifact.SHA256)
+
+	_, err = client.DownloadArtifact(ctx, "run-2", "bin/my app", &downloaded)
+	assert.ErrorContains(t, err, "404")
+
+	_, err = client.UploadArtifact(ctx, "run-1", "../../escape", strings.NewReader("x"))
+	assert.ErrorContains(t, err, "400")
+}
+
+func TestClient_ArtifactsPresigned(t *testing.T) {
+	s3 := s3test.NewServer(t, "conveyor")
+	store, err := storage.NewS3Store(types.S3Config{
+		Endpoint:  s3.URL,
+		Bucket:    s3.Bucket,
+		AccessKey: s3test.AccessKey,
+		SecretKey: s3test.SecretKey,
+		PathStyle: true,
+	})
+	require.NoError(t, err)
+	client, err := driverruntime.NewClient(startArtifactServer(t, store), "", driverruntime.ConfigOptions{})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	uploaded, err := client.UploadArtifact(ctx, "run-1", "dist/app.tar.gz", strings.NewReader("release"))
+	require.NoError(t, err)
+
+	// The download is redirected to the storage and verified with the checksum sent on the redirect
+	var downloaded bytes.Buffer
+	artifact, err := client.DownloadArtifact(ctx, "run-1", "dist/app.tar.gz", &downloaded)
+	require.NoError(t, err)
+	assert.Equal(t, "release", downloaded.String())
+	assert.Equal(t, uploaded.SHA256, artifact.SHA256)
+	assert.Equal(t, 1, s3.PresignedRequests())
+
+	_, err = client.DownloadArtifact(ctx, "run-1", "dist/missing", &downloaded)
+	assert.ErrorContains(t, err, "404")
+}
@@ -0,0 +1,145 @@
+package driverruntime
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+// ErrCacheMiss is returned by CacheGet when no entry is stored under the key or the entry has expired.
+var ErrCacheMiss = errors.New("cache miss")
+
+/*
+CacheKey derives a cache key from the contents of files, prefixed with prefix.
+The key changes whenever one of the files changes, e.g.
+
+	key, err := driverruntime.CacheKey("go-mod", "go.sum")
+*/
+func CacheKey(prefix string, files ...string) (string, error) {
+	hash := sha256.New()
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return "", fmt.Errorf("CacheKey: %w", err)
+		}
+		_, err = io.Copy(hash, f)
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("CacheKey: failed to read %s, %w", file, err)
+		}
+	}
+	return prefix + "-" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (c *Client) cacheURL(key string) string {
+	return fmt.Sprintf("%s/cache/%s", strings.TrimRight(c.HTTPClient.BaseURL, "/"), url.PathEscape(key))
+}
+
+/*
+Stores the contents of r in the build cache shared by all drivers under key, replacing any existing entry.
+The entry is kept for ttl, or the TTL configured on the server when ttl is zero, unless it is evicted earlier to keep the cache within its size limit.
+The body is streamed to the API server, so large caches are not held in memory.
+*/
+func (c *Client) CachePut(ctx context.Context, key string, r io.Reader, ttl time.Duration) (*types.CacheEntry, error) {
+	req, err := c.newRequest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("CachePut: %w", err)
+	}
+	if ttl > 0 {
+		req.SetQueryParam("ttl", ttl.String())
+	}
+
+	resp, err := req.
+		SetHeader("Content-Type", "application/octet-stream").
+		SetBody(r).
+		Put(c.cacheURL(key))
+	if err != nil {
+		return nil, fmt.Errorf("CachePut: failed to store cache entry, %w", err)
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("CachePut: %w", newAPIError(resp.StatusCode(), resp.Body()))
+	}
+
+	var entry types.CacheEntry
+	if err := json.Unmarshal(resp.Body(), &entry); err != nil {
+		return nil, fmt.Errorf("CachePut: failed to unmarshal response body: %w", err)
+	}
+	return &entry, nil
+}
+
+/*
+Writes the build cache entry stored under key to w.
+ErrCacheMiss is returned when no entry is stored under the key, in which case the driver should build the cache and store it with CachePut.
+The checksum of the entry is verified, so an error is returned if w has received corrupt data.
+*/
+func (c *Client) CacheGet(ctx context.Context, key string, w io.Writer) (*types.CacheEntry, error) {
+	req, err := c.newRequest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("CacheGet: %w", err)
+	}
+
+	resp, err := req.
+		SetDoNotParseResponse(true).
+		Get(c.cacheURL(key))
+	if err != nil {
+		return nil, fmt.Errorf("CacheGet: failed to get cache entry, %w", err)
+	}
+	body := resp.RawBody()
+	defer body.Close()
+
+	if resp.StatusCode() == http.StatusNotFound {
+		return nil, ErrCacheMiss
+	}
+	if resp.IsError() {
+		message, _ := io.ReadAll(body)
+		return nil, fmt.Errorf("CacheGet: %w", newAPIError(resp.StatusCode(), message))
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, hash), body)
+	if err != nil {
+		return nil, fmt.Errorf("CacheGet: failed to read cache entry, %w", err)
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if expected := responseChecksum(resp.RawResponse); expected != "" && !strings.EqualFold(expected, checksum) {
+		return nil, fmt.Errorf("CacheGet: checksum mismatch, expected %s, got %s", expected, checksum)
+	}
+
+	return &types.CacheEntry{
+		Key:    key,
+		Size:   size,
+		SHA256: checksum,
+	}, nil
+}
+
+// Removes the build cache entry stored under key.
+func (c *Client) CacheDelete(ctx context.Context, key string) error {
+	req, err := c.newRequest(ctx)
+	if err != nil {
+		return fmt.Errorf("CacheDelete: %w", err)
+	}
+
+	resp, err := req.Delete(c.cacheURL(key))
+	if err != nil {
+		return fmt.Errorf("CacheDelete: failed to delete cache entry, %w", err)
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		return ErrCacheMiss
+	}
+	if resp.IsError() {
+		return fmt.Errorf("CacheDelete: %w", newAPIError(resp.StatusCode(), resp.Body()))
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package driverruntime_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/gofiber/fiber/v2"
+	"github.com/open-ug/conveyor/internal/models"
+	"github.com/open-ug/conveyor/internal/routes"
+	"github.com/open-ug/conveyor/internal/storage"
+	driverruntime "github.com/open-ug/conveyor/pkg/driver-runtime"
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startCacheServer serves the cache routes backed by a filesystem store.
+func startCacheServer(t *testing.T) string {
+	store, err := storage.NewFileSystemStore(t.TempDir())
+	require.NoError(t, err)
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	app := fiber.New(fiber.Config{StreamRequestBody: true, DisableStartupMessage: true})
+	routes.CacheRoutes(app, storage.NewCache(store, models.NewCacheModel(db), types.CacheConfig{}))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go app.Listener(listener)
+	t.Cleanup(func() { app.Shutdown() })
+
+	return "http://" + listener.Addr().String()
+}
+
+func TestClient_Cache(t *testing.T) {
+	client, err := driverruntime.NewClient(startCacheServer(t), "", driverruntime.ConfigOptions{})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	goSum := filepath.Join(t.TempDir(), "go.sum")
+	require.NoError(t, os.WriteFile(goSum, []byte("example.com/mod v1.0.0 h1:abc="), 0o644))
+	key, err := driverruntime.CacheKey("go-mod", goSum)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, "go-mod-"))
+
+	var cached strings.Builder
+	_, err = client.CacheGet(ctx, key, &cached)
+	assert.ErrorIs(t, err, driverruntime.ErrCacheMiss)
+
+	content := strings.Repeat("module cache\n", 100000)
+	stored, err := client.CachePut(ctx, key, strings.NewReader(content), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), stored.Size)
+	assert.WithinDuration(t, stored.CreatedAt.Add(time.Hour), stored.ExpiresAt, time.Second)
+
+	entry, err := client.CacheGet(ctx, key, &cached)
+	require.NoError(t, err)
+	assert.Equal(t, content, cached.String())
+	assert.Equal(t, stored.SHA256, entry.SHA256)
+
+	require.NoError(t, client.CacheDelete(ctx, key))
+	assert.ErrorIs(t, client.CacheDelete(ctx, key), driverruntime.ErrCacheMiss)
+
+	_, err = client.CachePut(ctx, "../escape", strings.NewReader("x"), 0)
+	assert.Error(t, err)
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/go-resty/resty/v2"
@@ -20,6 +21,8 @@ type Client struct {
 	certs      []*x509.Certificate
 	privateKey crypto.PrivateKey
 	Options    ConfigOptions
+
+	breaker *circuitBreaker
 }
 
 type ConfigOptions struct {
@@ -42,6 +45,11 @@ type ConfigOptions struct {
 	// TokenTTL is the duration for which short-lived JWTs are valid.
 	// If not set, defaults to 2 minutes.
 	TokenTTL time.Duration
+
+	// Retry configures how requests that failed with a transient error are retried.
+	Retry RetryOptions
+	// CircuitBreaker configures when the client stops sending requests to an API server that keeps failing.
+	CircuitBreaker CircuitBreakerOptions
 }
 
 // NewClient initializes the API client.
@@ -54,12 +62,21 @@ func NewClient(
 	client := resty.New()
 	client.SetBaseURL(ApiEndpoint)
 	client.SetHeader("Content-Type", "application/json")
+	// Redirects lead to presigned object storage URLs, which reject the API token
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		req.Header.Del("Authorization")
+		return nil
+	}))
 
 	c := &Client{
 		HTTPClient: client,
 		APIURL:     ApiEndpoint,
 		NatsURL:    NatsEndpoint,
 		Options:    options,
+		breaker:    &circuitBreaker{options: options.CircuitBreaker.withDefaults()},
 	}
 
 	// If auth is enabled, load cert + key
@@ -0,0 +1,240 @@
+package driverruntime_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	driverruntime "github.com/open-ug/conveyor/pkg/driver-runtime"
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient creates a client of an API server served by mux.
+func newTestClient(t *testing.T, mux *http.ServeMux) *driverruntime.Client {
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client, err := driverruntime.NewClient(server.URL, "", driverruntime.ConfigOptions{})
+	require.NoError(t, err)
+	return client
+}
+
+func TestClient_API(t *testing.T) {
+	ctx := context.Background()
+	mux := http.NewServeMux()
+	client := newTestClient(t, mux)
+
+	mux.HandleFunc("GET /resources/deployment", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("sort") {
+			json.NewEncoder(w).Encode(types.ResourceList{Items: []types.Resource{{Name: r.URL.RawQuery}}})
+			return
+		}
+		if r.URL.Query().Get("continue") == "" {
+			json.NewEncoder(w).Encode(types.ResourceList{Items: []types.Resource{{Name: "api"}}, Continue: "api"})
+			return
+		}
+		json.NewEncoder(w).Encode(types.ResourceList{Items: []types.Resource{{Name: r.URL.Query().Get("limit")}}})
+	})
+	mux.HandleFunc("GET /resources/deployment/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "resource not found"})
+	})
+	mux.HandleFunc("GET /logs", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]types.Log{{Message: r.URL.RawQuery}})
+	})
+	mux.HandleFunc("POST /runs/{runid}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("runid") != "run-1" {
+			http.Error(w, "run not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Run run-1 is being cancelled"})
+	})
+	mux.HandleFunc("DELETE /pipelines/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	t.Run("list resources", func(t *testing.T) {
+		list, err := client.ListResources(ctx, "deployment", &driverruntime.ListOptions{Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, "api", list.Continue)
+
+		list, err = client.ListResources(ctx, "deployment", &driverruntime.ListOptions{Limit: 1, Continue: list.Continue})
+		require.NoError(t, err)
+		assert.Equal(t, "1", list.Items[0].Name)
+		assert.Empty(t, list.Continue)
+
+		list, err = client.ListResources(ctx, "deployment", &driverruntime.ListOptions{Descending: true, Pipeline: "build", Metadata: map[string]string{"version": "2", "team": "web"}})
+		require.NoError(t, err)
+		assert.Equal(t, "metadata=team%3Dweb%2Cversion%3D2&pipeline=build&sort=-name", list.Items[0].Name)
+	})
+
+	t.Run("typed errors", func(t *testing.T) {
+		_, err := client.GetResource(ctx, "missing", "deployment")
+		assert.True(t, driverruntime.IsNotFound(err))
+		assert.False(t, driverruntime.IsConflict(err))
+
+		var apiErr *driverruntime.APIError
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+		assert.Equal(t, "resource not found", apiErr.Message)
+
+		// Errors that are not JSON keep the response body
+		err = client.CancelRun(ctx, "run-2")
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, "run not found", apiErr.Message)
+	})
+
+	t.Run("query logs", func(t *testing.T) {
+		logs, err := client.QueryLogs(ctx, driverruntime.LogQuery{RunID: "run-1", Level: types.LogLevelWarn, Labels: map[string]string{"stream": "stderr", "event": "create"}})
+		require.NoError(t, err)
+		assert.Equal(t, "labels=event%3Dcreate%2Cstream%3Dstderr&level=warn&runid=run-1", logs[0].Message)
+	})
+
+	t.Run("responses without body", func(t *testing.T) {
+		assert.NoError(t, client.CancelRun(ctx, "run-1"))
+		assert.NoError(t, client.DeletePipeline(ctx, "build"))
+	})
+}
+
+func TestClient_StreamRunLogs(t *testing.T) {
+	mux := http.NewServeMux()
+	client := newTestClient(t, mux)
+
+	mux.HandleFunc("GET /logs/pipeline/{runid}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("runid") != "run-1" {
+			http.Error(w, "unknown run", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i, level := range []string{types.LogLevelInfo, r.URL.Query().Get("level")} {
+			entry, _ := json.Marshal(types.Log{RunID: "run-1", Level: level, Message: fmt.Sprintf("line %d", i)})
+			fmt.Fprintf(w, "data: %s\n\n: heartbeat\n\n", entry)
+		}
+		w.(http.Flusher).Flush()
+		// The stream stays open until the client goes away
+		<-r.Context().Done()
+	})
+
+	var messages []string
+	for entry, err := range client.StreamRunLogs(context.Background(), "run-1", driverruntime.LogQuery{Level: types.LogLevelWarn}) {
+		require.NoError(t, err)
+		messages = append(messages, entry.Message+" "+entry.Level)
+		if len(messages) == 2 {
+			break
+		}
+	}
+	assert.Equal(t, []string{"line 0 info", "line 1 warn"}, messages)
+
+	var errs []error
+	for _, err := range client.StreamRunLogs(context.Background(), "run-2", driverruntime.LogQuery{}) {
+		errs = append(errs, err)
+	}
+	if assert.Len(t, errs, 1) {
+		assert.True(t, driverruntime.IsNotFound(errs[0]))
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	ctx := context.Background()
+	var failures, requests atomic.Int32
+	mux := http.NewServeMux()
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failures.Add(-1) >= 0 {
+			if r.PathValue("runid") == "throttled" {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			http.Error(w, "restarting", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(types.Run{ID: r.PathValue("runid")})
+	}
+	mux.HandleFunc("GET /runs/{runid}", handler)
+	mux.HandleFunc("POST /runs/{runid}/cancel", handler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	newClient := func(options driverruntime.ConfigOptions) *driverruntime.Client {
+		client, err := driverruntime.NewClient(server.URL, "", options)
+		require.NoError(t, err)
+		return client
+	}
+	reset := func(n int32) {
+		failures.Store(n)
+		requests.Store(0)
+	}
+
+	t.Run("idempotent requests", func(t *testing.T) {
+		client := newClient(driverruntime.ConfigOptions{Retry: driverruntime.RetryOptions{InitialBackoff: time.Millisecond}})
+
+		reset(2)
+		run, err := client.GetRun(ctx, "run-1")
+		require.NoError(t, err)
+		assert.Equal(t, "run-1", run.ID)
+		assert.EqualValues(t, 3, requests.Load())
+
+		// Requests give up after MaxAttempts
+		reset(10)
+		_, err = client.GetRun(ctx, "run-1")
+		assert.ErrorContains(t, err, "503: restarting")
+		assert.EqualValues(t, 4, requests.Load())
+
+		// Requests that are not idempotent are attempted once
+		reset(1)
+		err = client.CancelRun(ctx, "run-1")
+		assert.ErrorContains(t, err, "503")
+		assert.EqualValues(t, 1, requests.Load())
+	})
+
+	t.Run("retry after", func(t *testing.T) {
+		client := newClient(driverruntime.ConfigOptions{Retry: driverruntime.RetryOptions{InitialBackoff: time.Millisecond}})
+
+		reset(1)
+		start := time.Now()
+		_, err := client.GetRun(ctx, "throttled")
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+
+	t.Run("circuit breaker", func(t *testing.T) {
+		client := newClient(driverruntime.ConfigOptions{
+			Retry:          driverruntime.RetryOptions{MaxAttempts: 1},
+			CircuitBreaker: driverruntime.CircuitBreakerOptions{FailureThreshold: 2, OpenTimeout: 100 * time.Millisecond},
+		})
+
+		reset(3)
+		for range 2 {
+			_, err := client.GetRun(ctx, "run-1")
+			assert.ErrorContains(t, err, "503")
+		}
+		// The open circuit fails fast
+		_, err := client.GetRun(ctx, "run-1")
+		assert.ErrorIs(t, err, driverruntime.ErrCircuitOpen)
+		assert.EqualValues(t, 2, requests.Load())
+
+		// The trial request fails and opens the circuit again
+		time.Sleep(150 * time.Millisecond)
+		_, err = client.GetRun(ctx, "run-1")
+		assert.ErrorContains(t, err, "503")
+		_, err = client.GetRun(ctx, "run-1")
+		assert.ErrorIs(t, err, driverruntime.ErrCircuitOpen)
+
+		// The API server is back
+		time.Sleep(150 * time.Millisecond)
+		_, err = client.GetRun(ctx, "run-1")
+		require.NoError(t, err)
+		_, err = client.GetRun(ctx, "run-1")
+		require.NoError(t, err)
+		assert.EqualValues(t, 5, requests.Load())
+	})
+}
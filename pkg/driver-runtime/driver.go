@@ -2,23 +2,81 @@ package driverruntime
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/open-ug/conveyor/pkg/driver-runtime/log"
 	"github.com/open-ug/conveyor/pkg/types"
 )
 
+// ReconcileFunc is the signature of the functions that reconcile resource events.
+type ReconcileFunc func(message string, event string, runID string, logger *log.DriverLogger) types.DriverResult
+
 type Driver struct {
 	// The driver is responsible for managing the driver
-	Reconcile func(message string, event string, runID string, logger *log.DriverLogger) types.DriverResult
+	Reconcile ReconcileFunc
 
 	Name string
 
 	Resources []string
+
+	// ResyncInterval opts the driver into periodic resyncs: every resource of its Resources is
+	// delivered again in a `resync` event about once per interval, so the driver can re-converge
+	// resources that were changed out-of-band. Resyncs are spread over time and rate limited by
+	// the server, and intervals below a minute are raised to a minute. Zero disables resyncs.
+	ResyncInterval time.Duration
+
+	// Finalizer opts the driver into graceful deletion, e.g. `example.com/cleanup`. The finalizer is added to every
+	// resource the driver reconciles, so a deleted resource is kept until the driver reconciled its deletion. Once the
+	// reconcile of a deleted resource succeeds, the finalizer is removed, and the resource is purged when no other
+	// finalizers are left. Deleted resources have their DeletionTimestamp set, and are always reconciled by the delete
+	// handler, see OnDelete, so a driver with a finalizer must handle delete events.
+	Finalizer string
+
+	// handlers are reconcile functions registered for specific events
+	handlers map[string]ReconcileFunc
+}
+
+// On registers a reconcile function for a specific event. It takes precedence over
+// Reconcile for that event. It returns the driver so that registrations can be chained.
+func (d *Driver) On(event string, reconcile ReconcileFunc) *Driver {
+	if d.handlers == nil {
+		d.handlers = make(map[string]ReconcileFunc)
+	}
+	d.handlers[event] = reconcile
+	return d
+}
+
+// OnCreate registers a reconcile function for resource creation events.
+func (d *Driver) OnCreate(reconcile ReconcileFunc) *Driver {
+	return d.On(types.EventCreate, reconcile)
+}
+
+// OnUpdate registers a reconcile function for resource update events.
+func (d *Driver) OnUpdate(reconcile ReconcileFunc) *Driver {
+	return d.On(types.EventUpdate, reconcile)
+}
+
+// OnDelete registers a reconcile function for resource deletion events.
+func (d *Driver) OnDelete(reconcile ReconcileFunc) *Driver {
+	return d.On(types.EventDelete, reconcile)
+}
+
+// OnResync registers a reconcile function for periodic resync events, see ResyncInterval.
+func (d *Driver) OnResync(reconcile ReconcileFunc) *Driver {
+	return d.On(types.EventResync, reconcile)
+}
+
+// handlerFor returns the reconcile function for an event, or nil if the driver does not handle it.
+func (d *Driver) handlerFor(event string) ReconcileFunc {
+	if reconcile, ok := d.handlers[event]; ok {
+		return reconcile
+	}
+	return d.Reconcile
 }
 
 // validate the driver
 func (d *Driver) Validate() error {
-	if d.Reconcile == nil {
+	if d.Reconcile == nil && len(d.handlers) == 0 {
 		return fmt.Errorf("driver reconcile function is not set")
 	}
 	if d.Name == "" {
@@ -29,5 +87,14 @@ func (d *Driver) Validate() error {
 		return fmt.Errorf("driver resources are not set")
 	}
 
+	if d.Finalizer != "" {
+		if err := types.ValidateFinalizers([]string{d.Finalizer}); err != nil {
+			return fmt.Errorf("driver %w", err)
+		}
+		if d.handlerFor(types.EventDelete) == nil {
+			return fmt.Errorf("driver finalizer %s is set but the driver does not handle delete events", d.Finalizer)
+		}
+	}
+
 	return nil
 }
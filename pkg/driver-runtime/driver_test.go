@@ -75,3 +75,29 @@ func TestDriver_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestDriver_On(t *testing.T) {
+	deleted := func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+		return types.DriverResult{Success: true, Message: "deleted"}
+	}
+
+	driver := &driverruntime.Driver{
+		Name:      "cleanup-driver",
+		Resources: []string{"environment"},
+	}
+	driver.OnDelete(deleted)
+
+	// A driver with only event handlers does not need a Reconcile function
+	assert.NoError(t, driver.Validate())
+
+	// Deleted resources keep the finalizer until the delete handler reconciled them
+	finalizing := &driverruntime.Driver{
+		Name:      "finalizing-driver",
+		Resources: []string{"environment"},
+		Finalizer: "example.com/cleanup",
+	}
+	finalizing.OnCreate(deleted)
+	assert.EqualError(t, finalizing.Validate(), "driver finalizer example.com/cleanup is set but the driver does not handle delete events")
+	finalizing.OnDelete(deleted)
+	assert.NoError(t, finalizing.Validate())
+}
@@ -0,0 +1,450 @@
+package drivertest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+// FakeAPI is an in-memory stand-in for the resource, resource definition, artifact and cache
+// endpoints of the Conveyor API. Drivers under test reach it through the harness client.
+type FakeAPI struct {
+	// URL is the base URL of the fake API.
+	URL string
+
+	server      *httptest.Server
+	mu          sync.Mutex
+	resources   map[string]types.Resource
+	definitions map[string]types.ResourceDefinition
+	artifacts   map[string][]byte
+	cache       map[string][]byte
+	latency     time.Duration
+	failures    int
+	failStatus  int
+}
+
+// NewFakeAPI starts a fake API server. Close must be called to stop it.
+func NewFakeAPI() *FakeAPI {
+	f := &FakeAPI{
+		resources:   map[string]types.Resource{},
+		definitions: map[string]types.ResourceDefinition{},
+		artifacts:   map[string][]byte{},
+		cache:       map[string][]byte{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /resources/{$}", f.createResource)
+	mux.HandleFunc("GET /resources/{type}/{name}", f.getResource)
+	mux.HandleFunc("PUT /resources/{type}/{name}", f.updateResource)
+	mux.HandleFunc("PUT /resources/{type}/{name}/status", f.updateResourceStatus)
+	mux.HandleFunc("DELETE /resources/{type}/{name}", f.deleteResource)
+	mux.HandleFunc("PUT /resources/{type}/{name}/finalizers/{finalizer...}", f.addFinalizer)
+	mux.HandleFunc("DELETE /resources/{type}/{name}/finalizers/{finalizer...}", f.removeFinalizer)
+	mux.HandleFunc("POST /resource-definitions/{$}", f.createResourceDefinition)
+	mux.HandleFunc("POST /resource-definitions/apply", f.applyResourceDefinition)
+	mux.HandleFunc("GET /resource-definitions/{name}", f.getResourceDefinition)
+	mux.HandleFunc("PUT /resource-definitions/{name}", f.applyResourceDefinition)
+	mux.HandleFunc("DELETE /resource-definitions/{name}", f.deleteResourceDefinition)
+	mux.HandleFunc("PUT /runs/{runid}/artifacts/{path...}", f.uploadArtifact)
+	mux.HandleFunc("GET /runs/{runid}/artifacts/{path...}", f.downloadArtifact)
+	mux.HandleFunc("DELETE /runs/{runid}/artifacts/{path...}", f.deleteArtifact)
+	mux.HandleFunc("PUT /cache/{key}", f.putCacheEntry)
+	mux.HandleFunc("GET /cache/{key}", f.getCacheEntry)
+	mux.HandleFunc("DELETE /cache/{key}", f.deleteCacheEntry)
+
+	f.server = httptest.NewServer(f.inject(mux))
+	f.URL = f.server.URL
+	return f
+}
+
+// Close stops the fake API server.
+func (f *FakeAPI) Close() {
+	f.server.Close()
+}
+
+// SetLatency delays every response of the fake API by d.
+func (f *FakeAPI) SetLatency(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latency = d
+}
+
+// FailNext makes the next n requests fail with the given HTTP status code.
+func (f *FakeAPI) FailNext(n int, status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = n
+	f.failStatus = status
+}
+
+// PutResource stores a resource, replacing any resource with the same type and name.
+func (f *FakeAPI) PutResource(resource types.Resource) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resources[resourceKey(resource.Resource, resource.Name)] = resource
+}
+
+// Resource returns the stored resource of the given type and name.
+func (f *FakeAPI) Resource(resourceType string, name string) (types.Resource, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resource, ok := f.resources[resourceKey(resourceType, name)]
+	return resource, ok
+}
+
+// PutResourceDefinition stores a resource definition, replacing any definition with the same name.
+func (f *FakeAPI) PutResourceDefinition(definition types.ResourceDefinition) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.definitions[definition.Name] = definition
+}
+
+// Artifact returns the contents of an artifact uploaded for a run.
+func (f *FakeAPI) Artifact(runID string, artifactPath string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.artifacts[runID+"/"+artifactPath]
+	return data, ok
+}
+
+// PutArtifact stores an artifact for a run, e.g. one a previous step would have uploaded.
+func (f *FakeAPI) PutArtifact(runID string, artifactPath string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.artifacts[runID+"/"+artifactPath] = data
+}
+
+// CacheEntry returns the contents of a build cache entry. Entries never expire in the fake API.
+func (f *FakeAPI) CacheEntry(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.cache[key]
+	return data, ok
+}
+
+// PutCacheEntry stores a build cache entry, e.g. to test a driver against a warm cache.
+func (f *FakeAPI) PutCacheEntry(key string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cache[key] = data
+}
+
+// inject applies the configured latency and failures before handing the request to next.
+func (f *FakeAPI) inject(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		latency := f.latency
+		fail := f.failures > 0
+		status := f.failStatus
+		if fail {
+			f.failures--
+		}
+		f.mu.Unlock()
+
+		if latency > 0 {
+			time.Sleep(latency)
+		}
+		if fail {
+			writeError(w, status, "injected failure")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *FakeAPI) createResource(w http.ResponseWriter, r *http.Request) {
+	var resource types.Resource
+	if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	f.PutResource(resource)
+
+	writeJSON(w, http.StatusCreated, types.APIResponse{Name: resource.Name, RunID: uuid.New().String()})
+}
+
+func (f *FakeAPI) getResource(w http.ResponseWriter, r *http.Request) {
+	resource, ok := f.Resource(r.PathValue("type"), r.PathValue("name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Resource %s not found", r.PathValue("name")))
+		return
+	}
+	writeJSON(w, http.StatusOK, resource)
+}
+
+func (f *FakeAPI) updateResource(w http.ResponseWriter, r *http.Request) {
+	var resource types.Resource
+	if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	current, ok := f.Resource(r.PathValue("type"), r.PathValue("name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Resource %s not found", r.PathValue("name")))
+		return
+	}
+	resource.Resource = r.PathValue("type")
+	resource.Name = r.PathValue("name")
+	resource.Status = current.Status
+	resource.Finalizers = current.Finalizers
+	resource.DeletionTimestamp = current.DeletionTimestamp
+	f.PutResource(resource)
+
+	writeJSON(w, http.StatusOK, resource)
+}
+
+func (f *FakeAPI) updateResourceStatus(w http.ResponseWriter, r *http.Request) {
+	var update types.Resource
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := types.ValidateStatus(update.Status); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	resource, ok := f.Resource(r.PathValue("type"), r.PathValue("name"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Resource %s not found", r.PathValue("name")))
+		return
+	}
+
+	status := update.Status
+	status.Conditions = nil
+	for _, condition := range update.Status.Conditions {
+		if previous := resource.Status.FindCondition(condition.Type); previous != nil {
+			status.Conditions = append(status.Conditions, *previous)
+		}
+		status.SetCondition(condition)
+	}
+	resource.Status = status
+	f.PutResource(resource)
+
+	writeJSON(w, http.StatusOK, resource)
+}
+
+func (f *FakeAPI) deleteResource(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := resourceKey(r.PathValue("type"), r.PathValue("name"))
+	resource, ok := f.resources[key]
+	if !ok || len(resource.Finalizers) == 0 {
+		delete(f.resources, key)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if resource.DeletionTimestamp == nil {
+		now := time.Now().UTC()
+		resource.DeletionTimestamp = &now
+		f.resources[key] = resource
+	}
+	writeJSON(w, http.StatusAccepted, resource)
+}
+
+func (f *FakeAPI) addFinalizer(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := resourceKey(r.PathValue("type"), r.PathValue("name"))
+	resource, ok := f.resources[key]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Resource %s not found", r.PathValue("name")))
+		return
+	}
+	finalizer := r.PathValue("finalizer")
+	if !slices.Contains(resource.Finalizers, finalizer) {
+		if resource.DeletionTimestamp != nil {
+			writeError(w, http.StatusConflict, fmt.Sprintf("Resource %s is being deleted", r.PathValue("name")))
+			return
+		}
+		resource.Finalizers = append(resource.Finalizers, finalizer)
+		f.resources[key] = resource
+	}
+	writeJSON(w, http.StatusOK, resource)
+}
+
+func (f *FakeAPI) removeFinalizer(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := resourceKey(r.PathValue("type"), r.PathValue("name"))
+	resource, ok := f.resources[key]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Resource %s not found", r.PathValue("name")))
+		return
+	}
+	finalizer := r.PathValue("finalizer")
+	resource.Finalizers = slices.DeleteFunc(slices.Clone(resource.Finalizers), func(f string) bool { return f == finalizer })
+	if resource.DeletionTimestamp != nil && len(resource.Finalizers) == 0 {
+		delete(f.resources, key)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	f.resources[key] = resource
+	writeJSON(w, http.StatusOK, resource)
+}
+
+func (f *FakeAPI) createResourceDefinition(w http.ResponseWriter, r *http.Request) {
+	var definition types.ResourceDefinition
+	if err := json.NewDecoder(r.Body).Decode(&definition); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	f.PutResourceDefinition(definition)
+
+	writeJSON(w, http.StatusCreated, definition)
+}
+
+func (f *FakeAPI) applyResourceDefinition(w http.ResponseWriter, r *http.Request) {
+	var definition types.ResourceDefinition
+	if err := json.NewDecoder(r.Body).Decode(&definition); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if name := r.PathValue("name"); name != "" {
+		definition.Name = name
+	}
+	f.PutResourceDefinition(definition)
+
+	writeJSON(w, http.StatusOK, definition)
+}
+
+func (f *FakeAPI) getResourceDefinition(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	definition, ok := f.definitions[r.PathValue("name")]
+	f.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Resource definition %s not found", r.PathValue("name")))
+		return
+	}
+	writeJSON(w, http.StatusOK, definition)
+}
+
+func (f *FakeAPI) deleteResourceDefinition(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	delete(f.definitions, r.PathValue("name"))
+	f.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *FakeAPI) uploadArtifact(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Failed to read artifact")
+		return
+	}
+	f.PutArtifact(r.PathValue("runid"), r.PathValue("path"), data)
+
+	sum := sha256.Sum256(data)
+	writeJSON(w, http.StatusCreated, types.Artifact{
+		RunID:     r.PathValue("runid"),
+		Path:      r.PathValue("path"),
+		Size:      int64(len(data)),
+		SHA256:    hex.EncodeToString(sum[:]),
+		CreatedAt: time.Now(),
+	})
+}
+
+func (f *FakeAPI) downloadArtifact(w http.ResponseWriter, r *http.Request) {
+	data, ok := f.Artifact(r.PathValue("runid"), r.PathValue("path"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Artifact %s not found", r.PathValue("path")))
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Checksum-Sha256", hex.EncodeToString(sum[:]))
+	w.Write(data)
+}
+
+func (f *FakeAPI) deleteArtifact(w http.ResponseWriter, r *http.Request) {
+	if _, ok := f.Artifact(r.PathValue("runid"), r.PathValue("path")); !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Artifact %s not found", r.PathValue("path")))
+		return
+	}
+	f.mu.Lock()
+	delete(f.artifacts, r.PathValue("runid")+"/"+r.PathValue("path"))
+	f.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (f *FakeAPI) putCacheEntry(w http.ResponseWriter, r *http.Request) {
+	ttl, err := time.ParseDuration(r.URL.Query().Get("ttl"))
+	if r.URL.Query().Has("ttl") && err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid ttl")
+		return
+	}
+	if ttl <= 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Failed to read cache entry")
+		return
+	}
+	f.PutCacheEntry(r.PathValue("key"), data)
+
+	now := time.Now()
+	sum := sha256.Sum256(data)
+	writeJSON(w, http.StatusCreated, types.CacheEntry{
+		Key:       r.PathValue("key"),
+		Size:      int64(len(data)),
+		SHA256:    hex.EncodeToString(sum[:]),
+		CreatedAt: now,
+		LastUsed:  now,
+		ExpiresAt: now.Add(ttl),
+	})
+}
+
+func (f *FakeAPI) getCacheEntry(w http.ResponseWriter, r *http.Request) {
+	data, ok := f.CacheEntry(r.PathValue("key"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Cache entry %s not found", r.PathValue("key")))
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Checksum-Sha256", hex.EncodeToString(sum[:]))
+	w.Write(data)
+}
+
+func (f *FakeAPI) deleteCacheEntry(w http.ResponseWriter, r *http.Request) {
+	if _, ok := f.CacheEntry(r.PathValue("key")); !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Cache entry %s not found", r.PathValue("key")))
+		return
+	}
+	f.mu.Lock()
+	delete(f.cache, r.PathValue("key"))
+	f.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func resourceKey(resourceType string, name string) string {
+	return resourceType + "/" + name
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
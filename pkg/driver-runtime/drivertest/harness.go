@@ -0,0 +1,388 @@
+/*
+Package drivertest runs Conveyor drivers in-process for tests.
+
+A Harness starts an embedded NATS JetStream server and a fake Conveyor API,
+delivers resource events to a driver through a real DriverManager and captures
+the DriverResult and the logs and progress the driver reported:
+
+	h := drivertest.New(t)
+	result := h.Deliver(driver, types.EventCreate, resource)
+	assert.True(t, result.DriverResult.Success)
+
+Failures can be injected per delivery with WithRedeliveries, WithDelay and
+WithCancelAfter, or on the API with FakeAPI.SetLatency and FakeAPI.FailNext.
+*/
+package drivertest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/open-ug/conveyor/internal/engine"
+	"github.com/open-ug/conveyor/internal/models"
+	"github.com/open-ug/conveyor/internal/utils"
+	driverruntime "github.com/open-ug/conveyor/pkg/driver-runtime"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Harness runs drivers against an embedded NATS JetStream server and a fake Conveyor API.
+type Harness struct {
+	// Client is connected to the embedded NATS server and the fake API.
+	// It is the client driver managers of the harness are created with.
+	Client *driverruntime.Client
+	// API is the fake Conveyor API behind Client.
+	API *FakeAPI
+
+	t  testing.TB
+	nc *nats.Conn
+	js jetstream.JetStream
+}
+
+// Result is the outcome of delivering an event to a driver.
+type Result struct {
+	// RunID is the run the event was delivered for.
+	RunID string
+	// DriverResult is the result of the last delivery.
+	DriverResult types.DriverResult
+	// Deliveries holds the result of every delivery, in order, including requeued and retried ones.
+	Deliveries []types.DriverResult
+	// Logs are the logs the driver wrote across all deliveries.
+	Logs []types.Log
+	// Progress holds the progress the driver reported across all deliveries.
+	Progress []types.Progress
+	// Skipped reports that the driver manager acknowledged the event without reconciling it.
+	Skipped bool
+}
+
+// LogMessages returns the messages of the captured logs.
+func (r *Result) LogMessages() []string {
+	messages := make([]string, 0, len(r.Logs))
+	for _, entry := range r.Logs {
+		messages = append(messages, entry.Message)
+	}
+	return messages
+}
+
+type deliverOptions struct {
+	runID        string
+	step         string
+	events       []string
+	redeliveries int
+	delay        time.Duration
+	cancelAfter  time.Duration
+	timeout      time.Duration
+	maxRetries   int
+}
+
+// Option configures a single Deliver call.
+type Option func(*deliverOptions)
+
+// WithRunID delivers the event for the given run instead of a random one.
+func WithRunID(runID string) Option {
+	return func(o *deliverOptions) { o.runID = runID }
+}
+
+// WithStep delivers the event as the step with the given ID of a pipeline.
+func WithStep(step string) Option {
+	return func(o *deliverOptions) { o.step = step }
+}
+
+// WithEvents sets the event patterns of the driver manager. Defaults to all events.
+func WithEvents(patterns ...string) Option {
+	return func(o *deliverOptions) { o.events = patterns }
+}
+
+// WithRedeliveries delivers the same message n more times after the first delivery
+// completes, as JetStream does when an acknowledgement is lost.
+func WithRedeliveries(n int) Option {
+	return func(o *deliverOptions) { o.redeliveries = n }
+}
+
+// WithDelay waits d before each delivery of the message.
+func WithDelay(d time.Duration) Option {
+	return func(o *deliverOptions) { o.delay = d }
+}
+
+// WithCancelAfter cancels the run d after each delivery of the message,
+// cancelling the context the driver sees through DriverLogger.Context.
+func WithCancelAfter(d time.Duration) Option {
+	return func(o *deliverOptions) { o.cancelAfter = d }
+}
+
+// WithMaxRetries sets the MaxRetries of the driver manager, bounding how often retryable failures are retried.
+func WithMaxRetries(n int) Option {
+	return func(o *deliverOptions) { o.maxRetries = n }
+}
+
+// WithTimeout bounds how long each delivery may take before the test fails. Defaults to 30 seconds.
+func WithTimeout(d time.Duration) Option {
+	return func(o *deliverOptions) { o.timeout = d }
+}
+
+// New starts a harness whose servers are stopped when the test finishes.
+func New(t testing.TB) *Harness {
+	t.Helper()
+
+	natsServer, err := server.NewServer(&server.Options{
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatalf("drivertest: failed to create NATS server: %v", err)
+	}
+	go natsServer.Start()
+	if !natsServer.ReadyForConnections(10 * time.Second) {
+		t.Fatal("drivertest: NATS server failed to start within timeout")
+	}
+	t.Cleanup(natsServer.Shutdown)
+
+	nc, err := nats.Connect(natsServer.ClientURL())
+	if err != nil {
+		t.Fatalf("drivertest: failed to connect to NATS: %v", err)
+	}
+	t.Cleanup(nc.Close)
+
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatalf("drivertest: failed to create JetStream context: %v", err)
+	}
+	natsContext := utils.NatsContext{NatsCon: nc, JetStream: js}
+	if err := natsContext.InitiateStreams(); err != nil {
+		t.Fatalf("drivertest: failed to create streams: %v", err)
+	}
+
+	api := NewFakeAPI()
+	t.Cleanup(api.Close)
+
+	// Requests are retried like in production, without making tests wait
+	client, err := driverruntime.NewClient(api.URL, natsServer.ClientURL(), driverruntime.ConfigOptions{
+		Retry: driverruntime.RetryOptions{InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("drivertest: failed to create client: %v", err)
+	}
+
+	return &Harness{
+		Client: client,
+		API:    api,
+		t:      t,
+		nc:     nc,
+		js:     js,
+	}
+}
+
+/*
+Deliver sends a resource event to the driver and waits for it to be handled.
+A DriverManager is started for the driver for the duration of the call and stopped afterwards.
+The resource is stored in the fake API first, so the driver can read it back.
+The test fails if a delivery does not complete within the timeout.
+*/
+func (h *Harness) Deliver(driver *driverruntime.Driver, event string, resource types.Resource, opts ...Option) *Result {
+	h.t.Helper()
+
+	options := deliverOptions{
+		runID:   uuid.New().String(),
+		events:  []string{"*"},
+		timeout: defaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if _, ok := h.API.Resource(resource.Resource, resource.Name); !ok {
+		h.API.PutResource(resource)
+	}
+
+	manager, err := h.Client.NewDriverManager(driver, options.events)
+	if err != nil {
+		h.t.Fatalf("drivertest: failed to create driver manager: %v", err)
+	}
+	manager.ShutdownTimeout = options.timeout
+	manager.MaxRetries = options.maxRetries
+
+	// Results, logs and progress share one channel so they are seen in the order the driver published them
+	received := make(chan *nats.Msg, 1024)
+	for _, subject := range []string{
+		"pipelines.driver.result",
+		"live.logs." + options.runID + ".*",
+		"runs.progress." + options.runID + ".*",
+	} {
+		sub, err := h.nc.ChanSubscribe(subject, received)
+		if err != nil {
+			h.t.Fatalf("drivertest: failed to subscribe to %s: %v", subject, err)
+		}
+		defer sub.Unsubscribe()
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- manager.Run(ctx) }()
+	defer func() {
+		stop()
+		if err := <-runErr; err != nil {
+			h.t.Errorf("drivertest: driver manager stopped with error: %v", err)
+		}
+	}()
+	h.waitForManager(manager, options.timeout)
+
+	message, err := json.Marshal(resource)
+	if err != nil {
+		h.t.Fatalf("drivertest: failed to marshal resource: %v", err)
+	}
+	driverMessage, err := json.Marshal(types.DriverMessage{
+		Event:   event,
+		Payload: string(message),
+		ID:      uuid.New().String(),
+		RunID:   options.runID,
+		Step:    options.step,
+	})
+	if err != nil {
+		h.t.Fatalf("drivertest: failed to marshal driver message: %v", err)
+	}
+
+	result := &Result{RunID: options.runID}
+	subject := "drivers." + driver.Name + ".resources." + resource.Resource
+	for range options.redeliveries + 1 {
+		if options.delay > 0 {
+			time.Sleep(options.delay)
+		}
+		if _, err := h.js.Publish(context.Background(), subject, driverMessage); err != nil {
+			h.t.Fatalf("drivertest: failed to publish driver message: %v", err)
+		}
+
+		var cancelRun *time.Timer
+		if options.cancelAfter > 0 {
+			cancelRun = time.AfterFunc(options.cancelAfter, func() {
+				h.nc.Publish("runs.cancel."+options.runID, nil)
+			})
+		}
+		driverResult, handled := h.await(driver.Name, received, result, options.timeout)
+		if cancelRun != nil {
+			cancelRun.Stop()
+		}
+
+		if !handled {
+			result.Skipped = true
+			break
+		}
+		result.Deliveries = append(result.Deliveries, driverResult)
+		result.DriverResult = driverResult
+	}
+
+	return result
+}
+
+// waitForManager waits until the driver manager registered itself, at which point it consumes messages.
+func (h *Harness) waitForManager(manager *driverruntime.DriverManager, timeout time.Duration) {
+	h.t.Helper()
+
+	registry, err := h.js.KeyValue(context.Background(), "drivers")
+	if err != nil {
+		h.t.Fatalf("drivertest: failed to open driver registry: %v", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := registry.Get(context.Background(), manager.Driver.Name+"."+manager.InstanceID)
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, jetstream.ErrKeyNotFound) {
+			h.t.Fatalf("drivertest: failed to read driver registry: %v", err)
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatalf("drivertest: driver manager for %s did not start within %s", manager.Driver.Name, timeout)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+/*
+await collects logs and progress until the driver publishes the result of the current delivery.
+It reports false when the driver manager acknowledged the message without a result.
+*/
+func (h *Harness) await(driverName string, received chan *nats.Msg, result *Result, timeout time.Duration) (types.DriverResult, bool) {
+	h.t.Helper()
+
+	consumer, err := h.js.Consumer(context.Background(), "messages", driverName)
+	if err != nil {
+		h.t.Fatalf("drivertest: failed to look up consumer: %v", err)
+	}
+
+	deadline := time.After(timeout)
+	poll := time.NewTicker(50 * time.Millisecond)
+	defer poll.Stop()
+	var drained <-chan time.Time
+
+	for {
+		select {
+		case msg := <-received:
+			switch {
+			case strings.HasPrefix(msg.Subject, "live.logs."):
+				// A message holds one log, or a batch of newline delimited logs
+				entries, err := models.DecodeLogs(bytes.NewReader(msg.Data))
+				if err != nil {
+					h.t.Fatalf("drivertest: failed to unmarshal log: %v", err)
+				}
+				result.Logs = append(result.Logs, entries...)
+			case strings.HasPrefix(msg.Subject, "runs.progress."):
+				var progress types.Progress
+				if err := json.Unmarshal(msg.Data, &progress); err != nil {
+					h.t.Fatalf("drivertest: failed to unmarshal progress: %v", err)
+				}
+				result.Progress = append(result.Progress, progress)
+			default:
+				var event engine.PipelineEvent
+				if err := json.Unmarshal(msg.Data, &event); err != nil {
+					h.t.Fatalf("drivertest: failed to unmarshal driver result: %v", err)
+				}
+				if event.RunID != result.RunID || event.DriverResultEvent.Driver != driverName {
+					continue
+				}
+				if event.DriverResultEvent.Skipped {
+					// The driver manager ended the pipeline step without reconciling it
+					return types.DriverResult{}, false
+				}
+				driverResult := types.DriverResult{
+					Success:      event.DriverResultEvent.Success,
+					Message:      event.DriverResultEvent.Message,
+					Data:         event.DriverResultEvent.Data,
+					RequeueAfter: event.DriverResultEvent.RequeueAfter,
+				}
+				if event.DriverResultEvent.Requeued() {
+					// The message is redelivered after the delay, wait for the result that ends the step
+					result.Deliveries = append(result.Deliveries, driverResult)
+					continue
+				}
+				return driverResult, true
+			}
+		case <-poll.C:
+			if drained != nil {
+				continue
+			}
+			info, err := consumer.Info(context.Background())
+			if err == nil && info.NumPending == 0 && info.NumAckPending == 0 {
+				// Give a result that was published right before the acknowledgement time to arrive
+				drained = time.After(200 * time.Millisecond)
+			}
+		case <-drained:
+			return types.DriverResult{}, false
+		case <-deadline:
+			h.t.Fatalf("drivertest: driver %s did not handle the event within %s", driverName, timeout)
+		}
+	}
+}
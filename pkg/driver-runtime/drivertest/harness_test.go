@@ -0,0 +1,318 @@
+package drivertest_test
+
+import (
+	"context"
+	"encoding/json"
+	stdlog "log"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	driverruntime "github.com/open-ug/conveyor/pkg/driver-runtime"
+	"github.com/open-ug/conveyor/pkg/driver-runtime/drivertest"
+	"github.com/open-ug/conveyor/pkg/driver-runtime/log"
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarness_Deliver(t *testing.T) {
+	h := drivertest.New(t)
+	resource := types.Resource{Name: "sample", Resource: "pipe", Spec: map[string]interface{}{"image": "alpine"}}
+
+	t.Run("captures result and logs", func(t *testing.T) {
+		driver := &driverruntime.Driver{
+			Name:      "echo-driver",
+			Resources: []string{"pipe"},
+			Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+				var r types.Resource
+				json.Unmarshal([]byte(message), &r)
+				logger.Log(nil, "reconciling "+r.Name)
+				logger.ReportProgress("building", 50, "halfway there")
+				log.ReportProgress(logger.Context(), "testing", 80, "running tests")
+				logger.Warn(map[string]string{"stage": "build"}, "done")
+				return types.DriverResult{Success: true, Message: event}
+			},
+		}
+
+		result := h.Deliver(driver, types.EventCreate, resource, drivertest.WithRunID("run-1"))
+
+		assert.Equal(t, "run-1", result.RunID)
+		assert.False(t, result.Skipped)
+		assert.Equal(t, types.DriverResult{Success: true, Message: types.EventCreate}, result.DriverResult)
+		assert.Equal(t, []string{"reconciling sample", "done"}, result.LogMessages())
+		assert.Equal(t, "echo-driver", result.Logs[0].Driver)
+		assert.Equal(t, types.LogLevelInfo, result.Logs[0].Level)
+		assert.Equal(t, types.LogLevelWarn, result.Logs[1].Level)
+		assert.Equal(t, map[string]string{"event": types.EventCreate, "id": result.Logs[1].Labels["id"], "stage": "build"}, result.Logs[1].Labels)
+		_, err := result.Logs[1].Time()
+		assert.NoError(t, err)
+		if assert.Len(t, result.Progress, 2) {
+			assert.Equal(t, "building", result.Progress[0].Phase)
+			assert.Equal(t, 50, result.Progress[0].Percent)
+			assert.Equal(t, "halfway there", result.Progress[0].Message)
+			assert.Equal(t, "run-1", result.Progress[0].RunID)
+			assert.Equal(t, "testing", result.Progress[1].Phase)
+			assert.Equal(t, "echo-driver", result.Progress[1].Driver)
+		}
+		assert.Error(t, log.ReportProgress(context.Background(), "testing", 80, "no reconcile"))
+	})
+
+	t.Run("slog", func(t *testing.T) {
+		driver := &driverruntime.Driver{
+			Name:      "slog-driver",
+			Resources: []string{"pipe"},
+			Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+				restore := logger.SetDefault(nil)
+				defer restore()
+
+				slog.With("image", "alpine").WithGroup("http").Warn("pull slow", "status", 429, "run_id", "other")
+				slog.Debug("not written")
+				stdlog.Printf("from the log package")
+				return types.DriverResult{Success: true}
+			},
+		}
+
+		result := h.Deliver(driver, types.EventCreate, resource, drivertest.WithRunID("run-slog"))
+
+		assert.Equal(t, []string{"pull slow", "from the log package"}, result.LogMessages())
+		assert.Equal(t, types.LogLevelWarn, result.Logs[0].Level)
+		assert.Equal(t, "run-slog", result.Logs[0].RunID)
+		assert.Equal(t, "alpine", result.Logs[0].Labels["image"])
+		assert.Equal(t, "429", result.Logs[0].Labels["http.status"])
+		assert.Equal(t, "other", result.Logs[0].Labels["http.run_id"])
+		assert.Equal(t, types.LogLevelInfo, result.Logs[1].Level)
+
+		// The previous loggers are restored once the reconcile is done
+		_, ok := slog.Default().Handler().(*log.Handler)
+		assert.False(t, ok)
+	})
+
+	t.Run("reads resources from the fake API", func(t *testing.T) {
+		driver := &driverruntime.Driver{
+			Name:      "reader-driver",
+			Resources: []string{"pipe"},
+			Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+				r, err := h.Client.GetResource(logger.Context(), "sample", "pipe")
+				if err != nil {
+					return types.DriverResult{Success: false, Message: err.Error()}
+				}
+				return types.DriverResult{Success: true, Message: r.Spec.(map[string]interface{})["image"].(string)}
+			},
+		}
+
+		result := h.Deliver(driver, types.EventUpdate, resource)
+		assert.Equal(t, types.DriverResult{Success: true, Message: "alpine"}, result.DriverResult)
+
+		// Transient failures are retried by the client
+		h.API.FailNext(1, http.StatusServiceUnavailable)
+		result = h.Deliver(driver, types.EventUpdate, resource)
+		assert.True(t, result.DriverResult.Success)
+
+		h.API.FailNext(4, http.StatusServiceUnavailable)
+		result = h.Deliver(driver, types.EventUpdate, resource)
+		assert.False(t, result.DriverResult.Success)
+		assert.Contains(t, result.DriverResult.Message, "503")
+	})
+
+	t.Run("redeliveries", func(t *testing.T) {
+		deliveries := 0
+		driver := &driverruntime.Driver{
+			Name:      "counting-driver",
+			Resources: []string{"pipe"},
+			Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+				deliveries++
+				return types.DriverResult{Success: deliveries > 1}
+			},
+		}
+
+		result := h.Deliver(driver, types.EventCreate, resource, drivertest.WithRedeliveries(2), drivertest.WithDelay(10*time.Millisecond))
+
+		assert.Equal(t, 3, deliveries)
+		assert.Equal(t, []types.DriverResult{{Success: false}, {Success: true}, {Success: true}}, result.Deliveries)
+		assert.True(t, result.DriverResult.Success)
+	})
+
+	t.Run("requeue", func(t *testing.T) {
+		polls := 0
+		driver := &driverruntime.Driver{
+			Name:      "polling-driver",
+			Resources: []string{"pipe"},
+			Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+				polls++
+				if polls < 3 {
+					return types.DriverResult{Message: "rollout in progress", RequeueAfter: 50 * time.Millisecond}
+				}
+				return types.DriverResult{Success: true, Message: "rolled out"}
+			},
+		}
+
+		result := h.Deliver(driver, types.EventCreate, resource)
+
+		assert.Equal(t, 3, polls)
+		assert.Equal(t, []types.DriverResult{
+			{Message: "rollout in progress", RequeueAfter: 50 * time.Millisecond},
+			{Message: "rollout in progress", RequeueAfter: 50 * time.Millisecond},
+			{Success: true, Message: "rolled out"},
+		}, result.Deliveries)
+		assert.Equal(t, types.DriverResult{Success: true, Message: "rolled out"}, result.DriverResult)
+	})
+
+	t.Run("retryable failures", func(t *testing.T) {
+		attempts := 0
+		driver := &driverruntime.Driver{
+			Name:      "flaky-driver",
+			Resources: []string{"pipe"},
+			Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+				attempts++
+				return types.DriverResult{Success: false, Message: "registry unreachable", Retryable: true}
+			},
+		}
+
+		result := h.Deliver(driver, types.EventCreate, resource, drivertest.WithMaxRetries(1))
+
+		// The first failure is retried after a second, the second one ends the step
+		assert.Equal(t, 2, attempts)
+		if assert.Len(t, result.Deliveries, 2) {
+			assert.Equal(t, time.Second, result.Deliveries[0].RequeueAfter)
+		}
+		assert.Equal(t, types.DriverResult{Success: false, Message: "registry unreachable"}, result.DriverResult)
+
+		terminal := &driverruntime.Driver{
+			Name:      "failing-driver",
+			Resources: []string{"pipe"},
+			Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+				return types.DriverResult{Success: false, Message: "invalid manifest"}
+			},
+		}
+		result = h.Deliver(terminal, types.EventCreate, resource)
+		assert.Len(t, result.Deliveries, 1)
+	})
+
+	t.Run("cancellation", func(t *testing.T) {
+		driver := &driverruntime.Driver{
+			Name:      "slow-driver",
+			Resources: []string{"pipe"},
+			Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+				select {
+				case <-logger.Context().Done():
+					return types.DriverResult{Success: false, Message: "cancelled"}
+				case <-time.After(10 * time.Second):
+					return types.DriverResult{Success: true}
+				}
+			},
+		}
+
+		result := h.Deliver(driver, types.EventCreate, resource, drivertest.WithCancelAfter(100*time.Millisecond))
+		assert.Equal(t, types.DriverResult{Success: false, Message: "cancelled"}, result.DriverResult)
+	})
+
+	t.Run("skipped events", func(t *testing.T) {
+		driver := &driverruntime.Driver{Name: "cleanup-driver", Resources: []string{"pipe"}}
+		driver.OnDelete(func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+			return types.DriverResult{Success: true}
+		})
+
+		result := h.Deliver(driver, types.EventCreate, resource)
+		assert.True(t, result.Skipped)
+		assert.Empty(t, result.Deliveries)
+	})
+
+	t.Run("finalizers", func(t *testing.T) {
+		cleanedUp := false
+		driver := &driverruntime.Driver{Name: "finalizing-driver", Resources: []string{"pipe"}, Finalizer: "example.com/cleanup"}
+		driver.OnCreate(func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+			return types.DriverResult{Success: true}
+		})
+		driver.OnDelete(func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+			cleanedUp = true
+			return types.DriverResult{Success: true}
+		})
+		finalized := types.Resource{Name: "finalized", Resource: "pipe"}
+
+		result := h.Deliver(driver, types.EventCreate, finalized)
+		assert.True(t, result.DriverResult.Success)
+		stored, ok := h.API.Resource("pipe", "finalized")
+		require.True(t, ok)
+		assert.Equal(t, []string{"example.com/cleanup"}, stored.Finalizers)
+
+		// The resource is kept until the driver reconciled its deletion
+		deleted, err := h.Client.DeleteResource(context.Background(), "finalized", "pipe")
+		require.NoError(t, err)
+		assert.NotNil(t, deleted)
+		stored, ok = h.API.Resource("pipe", "finalized")
+		require.True(t, ok)
+		require.NotNil(t, stored.DeletionTimestamp)
+
+		result = h.Deliver(driver, types.EventDelete, stored)
+		assert.True(t, result.DriverResult.Success)
+		assert.True(t, cleanedUp)
+		_, ok = h.API.Resource("pipe", "finalized")
+		assert.False(t, ok)
+
+		// Later pipeline steps receive process events, which the delete handler reconciles for deleted resources
+		var handled []string
+		cleanup := &driverruntime.Driver{Name: "cleanup-driver", Resources: []string{"pipe"}, Finalizer: "example.com/cleanup"}
+		cleanup.OnDelete(func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+			handled = append(handled, event)
+			return types.DriverResult{Success: true}
+		})
+		now := time.Now()
+		step := types.Resource{Name: "step", Resource: "pipe", Finalizers: []string{"example.com/cleanup"}, DeletionTimestamp: &now}
+		h.API.PutResource(step)
+
+		result = h.Deliver(cleanup, types.EventProcess, step, drivertest.WithEvents(types.EventCreate, types.EventUpdate, types.EventProcess))
+		assert.False(t, result.Skipped)
+		assert.True(t, result.DriverResult.Success)
+		assert.Equal(t, []string{types.EventDelete}, handled)
+		_, ok = h.API.Resource("pipe", "step")
+		assert.False(t, ok)
+	})
+}
+
+func TestFakeAPI(t *testing.T) {
+	api := drivertest.NewFakeAPI()
+	defer api.Close()
+
+	client, err := driverruntime.NewClient(api.URL, "", driverruntime.ConfigOptions{})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	resource := &types.Resource{Name: "sample", Resource: "pipe", Spec: map[string]interface{}{"image": "alpine"}}
+	created, err := client.CreateResource(ctx, resource)
+	require.NoError(t, err)
+	assert.Equal(t, "sample", created.Name)
+	assert.NotEmpty(t, created.RunID)
+
+	resource.Spec = map[string]interface{}{"image": "busybox"}
+	_, err = client.UpdateResource(ctx, resource)
+	require.NoError(t, err)
+
+	stored, ok := api.Resource("pipe", "sample")
+	require.True(t, ok)
+	assert.Equal(t, "busybox", stored.Spec.(map[string]interface{})["image"])
+
+	_, err = client.GetResource(ctx, "missing", "pipe")
+	assert.ErrorContains(t, err, "404")
+
+	_, err = client.UploadArtifact(ctx, "run-1", "bin/app", strings.NewReader("binary"))
+	require.NoError(t, err)
+	data, ok := api.Artifact("run-1", "bin/app")
+	require.True(t, ok)
+	assert.Equal(t, "binary", string(data))
+
+	var downloaded strings.Builder
+	_, err = client.DownloadArtifact(ctx, "run-1", "bin/app", &downloaded)
+	require.NoError(t, err)
+	assert.Equal(t, "binary", downloaded.String())
+
+	_, err = client.CacheGet(ctx, "go-mod-1", &downloaded)
+	assert.ErrorIs(t, err, driverruntime.ErrCacheMiss)
+	api.PutCacheEntry("go-mod-1", []byte("modules"))
+	var cached strings.Builder
+	_, err = client.CacheGet(ctx, "go-mod-1", &cached)
+	require.NoError(t, err)
+	assert.Equal(t, "modules", cached.String())
+}
@@ -0,0 +1,60 @@
+package driverruntime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+/*
+APIError is returned by Client methods when the API server answers with an error status.
+Use errors.As to inspect it, or the IsNotFound and IsConflict helpers:
+
+	if _, err := client.GetResource(ctx, "app", "deployment"); driverruntime.IsNotFound(err) {
+		// create the resource
+	}
+*/
+type APIError struct {
+	// StatusCode is the HTTP status the server answered with.
+	StatusCode int
+	// Message is the error the server sent, or the response body when it sent no JSON error.
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// newAPIError creates the error of a response with status code and body, extracting the message of JSON errors.
+func newAPIError(statusCode int, body []byte) *APIError {
+	var payload struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	message := strings.TrimSpace(string(body))
+	if err := json.Unmarshal(body, &payload); err == nil {
+		if payload.Error != "" {
+			message = payload.Error
+		} else if payload.Message != "" {
+			message = payload.Message
+		}
+	}
+	return &APIError{StatusCode: statusCode, Message: message}
+}
+
+// IsNotFound reports whether err is an APIError with status 404 Not Found.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict reports whether err is an APIError with status 409 Conflict.
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+func hasStatus(err error, statusCode int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
@@ -0,0 +1,268 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+const (
+	defaultBatchSize     = 500
+	defaultBatchBytes    = 512 << 10
+	defaultFlushInterval = 250 * time.Millisecond
+	defaultBufferSize    = 10000
+)
+
+// ErrLoggerClosed is returned when logs are pushed to a BatchLogger after it was closed.
+var ErrLoggerClosed = errors.New("logger closed")
+
+// BatchOptions configure a BatchLogger. Zero values use the defaults.
+type BatchOptions struct {
+	// MaxBatchSize is the number of logs that are published together. Defaults to 500.
+	MaxBatchSize int
+	// MaxBatchBytes bounds the size of a published batch. It must stay below the maximum
+	// payload of the NATS server. Defaults to 512KiB.
+	MaxBatchBytes int
+	// FlushInterval is how long logs wait for a batch to fill up. Defaults to 250ms.
+	FlushInterval time.Duration
+	// BufferSize is the number of logs queued for publishing. Defaults to 10000.
+	BufferSize int
+	// DropWhenFull drops logs while the buffer is full instead of blocking the driver until
+	// there is room. Dropped logs are counted by Dropped.
+	DropWhenFull bool
+}
+
+/*
+BatchLogger persists logs asynchronously. Logs are queued and published in batches, one
+JetStream message per batch, so drivers writing many lines are not slowed down by a round trip
+per line. A batch is published once it is full or FlushInterval has passed. Batches are streamed
+to clients watching the logs as well, so DriverLogger does not publish them one by one.
+Call Close to publish the queued logs before the process exits.
+*/
+type BatchLogger struct {
+	NatsCon *nats.Conn
+	js      jetstream.JetStream
+	options BatchOptions
+
+	queue   chan types.Log
+	flushes chan chan error
+	done    chan struct{}
+	closed  chan struct{}
+
+	closeOnce sync.Once
+	// mu guards queue against being used while Close stops the publisher
+	mu      sync.RWMutex
+	dropped atomic.Int64
+}
+
+// NewBatchLogger creates a batch logger and starts publishing its logs.
+func NewBatchLogger(natsCon *nats.Conn, options BatchOptions) *BatchLogger {
+	js, err := jetstream.New(natsCon)
+	if err != nil {
+		color.Red("Error Occured while creating JetStream context: %v", err)
+		return nil
+	}
+
+	if options.MaxBatchSize <= 0 {
+		options.MaxBatchSize = defaultBatchSize
+	}
+	if options.MaxBatchBytes <= 0 {
+		options.MaxBatchBytes = defaultBatchBytes
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = defaultFlushInterval
+	}
+	if options.BufferSize <= 0 {
+		options.BufferSize = defaultBufferSize
+	}
+
+	b := &BatchLogger{
+		NatsCon: natsCon,
+		js:      js,
+		options: options,
+		queue:   make(chan types.Log, options.BufferSize),
+		flushes: make(chan chan error),
+		done:    make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+/*
+PushLog queues a log for publishing. While the buffer is full, it blocks until there is room,
+or drops the log if DropWhenFull is set.
+*/
+func (b *BatchLogger) PushLog(logEntry types.Log) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	select {
+	case <-b.closed:
+		return ErrLoggerClosed
+	default:
+	}
+
+	if b.options.DropWhenFull {
+		select {
+		case b.queue <- logEntry:
+		default:
+			b.dropped.Add(1)
+		}
+		return nil
+	}
+
+	select {
+	case b.queue <- logEntry:
+		return nil
+	case <-b.closed:
+		return ErrLoggerClosed
+	}
+}
+
+// Dropped returns the number of logs dropped because the buffer was full.
+func (b *BatchLogger) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+// Flush publishes the queued logs and waits until they are persisted.
+func (b *BatchLogger) Flush(ctx context.Context) error {
+	result := make(chan error, 1)
+	select {
+	case b.flushes <- result:
+	case <-b.done:
+		return ErrLoggerClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close publishes the queued logs and stops the logger. Logs pushed afterwards are rejected with ErrLoggerClosed.
+func (b *BatchLogger) Close(ctx context.Context) error {
+	b.closeOnce.Do(func() {
+		close(b.closed)
+	})
+
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run publishes the queued logs until the logger is closed.
+func (b *BatchLogger) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.options.FlushInterval)
+	defer ticker.Stop()
+
+	batch := &logBatch{}
+	for {
+		select {
+		case logEntry := <-b.queue:
+			b.add(batch, logEntry)
+		case <-ticker.C:
+			b.publish(batch)
+		case result := <-b.flushes:
+			b.drain(batch)
+			result <- b.publish(batch)
+		case <-b.closed:
+			// Wait for pushes that are already past the closed check, then publish everything queued
+			b.mu.Lock()
+			b.drain(batch)
+			b.publish(batch)
+			b.mu.Unlock()
+			return
+		}
+	}
+}
+
+// drain adds the queued logs to the batch.
+func (b *BatchLogger) drain(batch *logBatch) {
+	for {
+		select {
+		case logEntry := <-b.queue:
+			b.add(batch, logEntry)
+		default:
+			return
+		}
+	}
+}
+
+// add appends a log to the batch, publishing the batch first when the log does not fit.
+func (b *BatchLogger) add(batch *logBatch, logEntry types.Log) {
+	line, err := json.Marshal(logEntry)
+	if err != nil {
+		color.Red("Error Occured while marshalling log: %v", err)
+		return
+	}
+
+	// A batch belongs to one driver of one run, as the subjects carry them
+	if batch.count > 0 && (batch.runID != logEntry.RunID || batch.driver != logEntry.Driver || batch.data.Len()+len(line)+1 > b.options.MaxBatchBytes) {
+		b.publish(batch)
+	}
+	batch.runID = logEntry.RunID
+	batch.driver = logEntry.Driver
+	batch.data.Write(line)
+	batch.data.WriteByte('\n')
+	batch.count++
+
+	if batch.count >= b.options.MaxBatchSize {
+		b.publish(batch)
+	}
+}
+
+// publish persists the batch as one message of newline delimited logs, streams it to clients and resets it.
+func (b *BatchLogger) publish(batch *logBatch) error {
+	if batch.count == 0 {
+		return nil
+	}
+	defer batch.reset()
+
+	_, err := b.js.Publish(context.Background(), "logs."+batch.runID, batch.data.Bytes())
+	if err != nil {
+		color.Red("Error Occured while publishing %d logs of run %s: %v", batch.count, batch.runID, err)
+		return err
+	}
+	if err := b.NatsCon.Publish("live.logs."+batch.runID+"."+batch.driver, batch.data.Bytes()); err != nil {
+		// The logs are persisted, clients get them when they read the logs again
+		color.Red("Error Occured while streaming %d logs of run %s: %v", batch.count, batch.runID, err)
+	}
+	return nil
+}
+
+// streamsLive marks BatchLogger as streaming the logs it publishes.
+func (b *BatchLogger) streamsLive() {}
+
+// logBatch collects the logs of a driver in a run that are published together.
+type logBatch struct {
+	runID  string
+	driver string
+	data   bytes.Buffer
+	count  int
+}
+
+func (l *logBatch) reset() {
+	l.runID = ""
+	l.driver = ""
+	l.data.Reset()
+	l.count = 0
+}
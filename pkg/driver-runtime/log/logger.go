@@ -1,9 +1,13 @@
 package log
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"strconv"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/fatih/color"
@@ -26,6 +30,31 @@ type DriverLogger struct {
 
 	// NatsCon is the nats client for the driver logger
 	NatsCon *nats.Conn
+
+	// js is the JetStream context progress is published with
+	js jetstream.JetStream
+
+	// ctx is the context of the reconcile the logger belongs to
+	ctx context.Context
+
+	// partial holds the last line passed to Write until its newline arrives
+	partial *partialLine
+}
+
+// partialLine is the incomplete last line passed to Write.
+type partialLine struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+// flusher is implemented by loggers that persist logs asynchronously, such as BatchLogger.
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// liveStreamer is implemented by loggers that stream the logs they persist to clients, such as BatchLogger.
+type liveStreamer interface {
+	streamsLive()
 }
 
 type Logger interface {
@@ -33,49 +62,143 @@ type Logger interface {
 }
 
 func NewDriverLogger(driverName string, labels map[string]string, natsCon *nats.Conn) *DriverLogger {
+	js, err := jetstream.New(natsCon)
+	if err != nil {
+		color.Red("Error Occured while creating JetStream context: %v", err)
+	}
 
 	return &DriverLogger{
 		DriverName: driverName,
 		Logger:     NewDefaultLogger(natsCon),
 		Labels:     labels,
 		NatsCon:    natsCon,
+		js:         js,
+		partial:    &partialLine{},
 	}
 }
 
+// loggerKey is the key the driver logger of a reconcile is stored under in its context.
+type loggerKey struct{}
+
+// WithContext returns a shallow copy of the driver logger bound to ctx.
+// The driver manager uses it to hand the reconcile context to drivers. The context returned
+// by Context carries the copy, see FromContext.
+func (d *DriverLogger) WithContext(ctx context.Context) *DriverLogger {
+	logger := *d
+	logger.ctx = context.WithValue(ctx, loggerKey{}, &logger)
+	return &logger
+}
+
+// FromContext returns the driver logger of the reconcile ctx was derived from, or nil if
+// ctx does not belong to a reconcile.
+func FromContext(ctx context.Context) *DriverLogger {
+	logger, _ := ctx.Value(loggerKey{}).(*DriverLogger)
+	return logger
+}
+
+// WithLabels returns a copy of the driver logger whose logs carry labels on top of the labels of the logger, e.g.
+// a `level` label for everything written to it. The copy holds back its own partial line in Write, so copies can
+// be written to at once, like the Stdout and Stderr of a command.
+func (d *DriverLogger) WithLabels(labels map[string]string) *DriverLogger {
+	logger := *d
+	logger.Labels = make(map[string]string, len(d.Labels)+len(labels))
+	maps.Copy(logger.Labels, d.Labels)
+	maps.Copy(logger.Labels, labels)
+	logger.partial = &partialLine{}
+	return &logger
+}
+
+// Context returns the context of the current reconcile. It is cancelled when the run is
+// cancelled or when the driver manager is shutting down and can no longer wait for the reconcile.
+func (d *DriverLogger) Context() context.Context {
+	if d.ctx != nil {
+		return d.ctx
+	}
+	return context.Background()
+}
+
+// reservedLabels are labels that fill fields of the log entry instead of its labels.
+var reservedLabels = map[string]bool{"driver": true, "run_id": true, "pipeline": true, "step": true, "level": true}
+
+/*
+Log writes an info log of the current reconcile. The labels are merged over the labels of the
+logger and persisted with the log, so logs can be filtered by them. A `level` label sets the
+level of the log instead, see Debug, Info, Warn and Error.
+*/
 func (d *DriverLogger) Log(labels map[string]string, message string) error {
-	// Send the log to Loki
-	initialLabels := map[string]string{
+	return d.log(types.LogLevelInfo, labels, message)
+}
+
+// Debug writes a debug log of the current reconcile.
+func (d *DriverLogger) Debug(labels map[string]string, message string) error {
+	return d.log(types.LogLevelDebug, labels, message)
+}
+
+// Info writes an info log of the current reconcile.
+func (d *DriverLogger) Info(labels map[string]string, message string) error {
+	return d.log(types.LogLevelInfo, labels, message)
+}
+
+// Warn writes a warning log of the current reconcile.
+func (d *DriverLogger) Warn(labels map[string]string, message string) error {
+	return d.log(types.LogLevelWarn, labels, message)
+}
+
+// Error writes an error log of the current reconcile.
+func (d *DriverLogger) Error(labels map[string]string, message string) error {
+	return d.log(types.LogLevelError, labels, message)
+}
+
+func (d *DriverLogger) log(level string, labels map[string]string, message string) error {
+	mergedLabels := map[string]string{
 		"driver": d.DriverName,
+		"level":  level,
 	}
-	// Add the labels to the initial labels
+	// Add the labels of the logger
 	for k, v := range d.Labels {
-		initialLabels[k] = v
+		mergedLabels[k] = v
 	}
-	// Merge the labels with the initial labels
+	// Merge the labels of the log over them
 	for k, v := range labels {
-		initialLabels[k] = v
+		mergedLabels[k] = v
 	}
 	runId := d.Labels["run_id"]
 
 	logEntry := types.Log{
-		RunID:     initialLabels["run_id"],
-		Driver:    initialLabels["driver"],
+		RunID:     mergedLabels["run_id"],
+		Driver:    mergedLabels["driver"],
+		Pipeline:  mergedLabels["pipeline"],
+		Step:      mergedLabels["step"],
+		Level:     mergedLabels["level"],
 		Message:   message,
-		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+		Timestamp: types.FormatLogTimestamp(time.Now()),
+	}
+	for k, v := range mergedLabels {
+		if reservedLabels[k] {
+			continue
+		}
+		if logEntry.Labels == nil {
+			logEntry.Labels = map[string]string{}
+		}
+		logEntry.Labels[k] = v
 	}
 
-	// Send the log to Loki
+	// Persist the log
 	err := d.Logger.PushLog(logEntry)
 	if err != nil {
 		return err
 	}
+	if _, ok := d.Logger.(liveStreamer); ok {
+		// Streamed along with its batch
+		return nil
+	}
 	// Marshal the message to JSON
 	messageBytes, err := json.Marshal(logEntry)
 	if err != nil {
 		return err
 	}
 
-	// Send the log to Nats
+	// Send the log to clients streaming it
 	err = d.NatsCon.Publish("live.logs."+runId+"."+d.DriverName, messageBytes)
 
 	if err != nil {
@@ -85,15 +208,113 @@ func (d *DriverLogger) Log(labels map[string]string, message string) error {
 	return nil
 }
 
-func (d *DriverLogger) Write(p []byte) (n int, err error) {
-	// Send the log to Loki
-	err = d.Log(nil, string(p))
+/*
+ReportProgress reports the phase and completion percentage of the current reconcile.
+The progress is stored in the step state of the run and streamed to clients
+watching the run status, so long running steps do not look stuck.
+Percent is clamped between 0 and 100. The progress is published within the context of the reconcile, see Context.
+*/
+func (d *DriverLogger) ReportProgress(phase string, percent int, message string) error {
+	return d.reportProgress(d.Context(), phase, percent, message)
+}
+
+/*
+ReportProgress reports the progress of the reconcile ctx was derived from, like DriverLogger.ReportProgress.
+It lets code that is handed the reconcile context, but not the logger, report progress.
+*/
+func ReportProgress(ctx context.Context, phase string, percent int, message string) error {
+	logger := FromContext(ctx)
+	if logger == nil {
+		return fmt.Errorf("context does not belong to a reconcile")
+	}
+	return logger.reportProgress(ctx, phase, percent, message)
+}
+
+// reportProgress publishes the progress of the reconcile within ctx.
+func (d *DriverLogger) reportProgress(ctx context.Context, phase string, percent int, message string) error {
+	progress := types.Progress{
+		RunID:     d.Labels["run_id"],
+		Driver:    d.DriverName,
+		Phase:     phase,
+		Percent:   min(max(percent, 0), 100),
+		Message:   message,
+		Timestamp: time.Now(),
+	}
+
+	progressBytes, err := json.Marshal(progress)
 	if err != nil {
+		return err
+	}
+
+	if d.js == nil {
+		return fmt.Errorf("driver logger has no JetStream context")
+	}
+	_, err = d.js.Publish(ctx, "runs.progress."+progress.RunID+"."+d.DriverName, progressBytes)
+	return err
+}
+
+/*
+Write logs p line by line, so the output of commands can be streamed to the run logs, e.g.
+by setting the logger as the Stdout of an exec.Cmd. A trailing line without a newline is held
+back until the rest of it is written, or until Flush.
+*/
+func (d *DriverLogger) Write(p []byte) (n int, err error) {
+	var data []byte
+	if d.partial != nil {
+		d.partial.mu.Lock()
+		data = append(d.partial.data, p...)
+		end := bytes.LastIndexByte(data, '\n') + 1
+		d.partial.data = append([]byte(nil), data[end:]...)
+		data = data[:end]
+		d.partial.mu.Unlock()
+	} else {
+		data = p
+	}
+
+	if err := d.writeLines(data); err != nil {
 		return 0, err
 	}
 	return len(p), nil
 }
 
+// writeLines logs every line of data.
+func (d *DriverLogger) writeLines(data []byte) error {
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" && len(data) == 0 {
+			continue
+		}
+		if err := d.Log(nil, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Flush logs the line held back by Write and waits until the logs of the reconcile are persisted.
+The driver manager flushes the logger after every reconcile.
+*/
+func (d *DriverLogger) Flush() error {
+	if d.partial != nil {
+		d.partial.mu.Lock()
+		data := d.partial.data
+		d.partial.data = nil
+		d.partial.mu.Unlock()
+
+		if len(data) > 0 {
+			if err := d.writeLines(data); err != nil {
+				return err
+			}
+		}
+	}
+
+	if f, ok := d.Logger.(flusher); ok {
+		return f.Flush(context.Background())
+	}
+	return nil
+}
+
 type DefaultLogger struct {
 	NatsCon *nats.Conn
 	js      jetstream.JetStream
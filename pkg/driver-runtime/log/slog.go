@@ -0,0 +1,189 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	stdlog "log"
+	"log/slog"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+/*
+Handler is a slog.Handler that writes records to the logs of a reconcile through a DriverLogger,
+so libraries logging with slog show up in the run logs. Attributes become labels of the log.
+Attributes of groups are prefixed with the group name, e.g. `http.status`. Attributes named
+like the reserved labels `driver`, `run_id`, `pipeline`, `step` and `level` are dropped.
+*/
+type Handler struct {
+	logger *DriverLogger
+	opts   slog.HandlerOptions
+	// labels are the attributes added with WithAttrs
+	labels map[string]string
+	// groups are the groups opened with WithGroup
+	groups []string
+}
+
+// NewHandler creates a slog handler writing to logger. If opts is nil, records of info level and above are written.
+func NewHandler(logger *DriverLogger, opts *slog.HandlerOptions) *Handler {
+	handler := &Handler{
+		logger: logger,
+		labels: map[string]string{},
+	}
+	if opts != nil {
+		handler.opts = *opts
+	}
+	return handler
+}
+
+// Enabled reports whether records of level are written.
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+	return level >= minLevel
+}
+
+// Handle writes the record as a log of the reconcile.
+func (h *Handler) Handle(_ context.Context, record slog.Record) error {
+	labels := make(map[string]string, len(h.labels)+record.NumAttrs())
+	for k, v := range h.labels {
+		labels[k] = v
+	}
+	if h.opts.AddSource && record.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+		h.addAttr(labels, nil, slog.String(slog.SourceKey, fmt.Sprintf("%s:%d", frame.File, frame.Line)))
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		h.addAttr(labels, h.groups, attr)
+		return true
+	})
+
+	return h.logger.log(slogLevel(record.Level), labels, record.Message)
+}
+
+// WithAttrs returns a handler adding attrs to every record.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	handler := h.clone()
+	for _, attr := range attrs {
+		handler.addAttr(handler.labels, handler.groups, attr)
+	}
+	return handler
+}
+
+// WithGroup returns a handler prefixing the attributes added after it with name.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	handler := h.clone()
+	handler.groups = append(handler.groups, name)
+	return handler
+}
+
+func (h *Handler) clone() *Handler {
+	handler := *h
+	handler.labels = make(map[string]string, len(h.labels))
+	for k, v := range h.labels {
+		handler.labels[k] = v
+	}
+	handler.groups = slices.Clip(h.groups)
+	return &handler
+}
+
+// addAttr flattens attr into labels, prefixing its key with groups.
+func (h *Handler) addAttr(labels map[string]string, groups []string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Value.Kind() != slog.KindGroup && h.opts.ReplaceAttr != nil {
+		attr = h.opts.ReplaceAttr(groups, attr)
+		attr.Value = attr.Value.Resolve()
+	}
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		// Attributes of a group without a key belong to the enclosing group
+		if attr.Key != "" {
+			groups = append(slices.Clip(groups), attr.Key)
+		}
+		for _, member := range attr.Value.Group() {
+			h.addAttr(labels, groups, member)
+		}
+		return
+	}
+	if attr.Key == "" {
+		return
+	}
+
+	key := attr.Key
+	for i := len(groups) - 1; i >= 0; i-- {
+		key = groups[i] + "." + key
+	}
+	if reservedLabels[key] {
+		return
+	}
+	labels[key] = attr.Value.String()
+}
+
+// slogLevel converts a slog level to the level of a log.
+func slogLevel(level slog.Level) string {
+	switch {
+	case level < slog.LevelInfo:
+		return types.LogLevelDebug
+	case level < slog.LevelWarn:
+		return types.LogLevelInfo
+	case level < slog.LevelError:
+		return types.LogLevelWarn
+	default:
+		return types.LogLevelError
+	}
+}
+
+// Slog returns a slog logger writing to the logs of the current reconcile.
+func (d *DriverLogger) Slog() *slog.Logger {
+	return slog.New(NewHandler(d, nil))
+}
+
+// defaultMu serializes changes to the default loggers made by SetDefault.
+var defaultMu sync.Mutex
+
+/*
+SetDefault makes a slog logger writing to the logs of the current reconcile the default slog
+logger, which also receives the output of the standard `log` package. Third-party libraries
+logging with either of them then log to the run. It returns a function restoring the previous
+loggers, which must be called before Reconcile returns:
+
+	restore := logger.SetDefault(nil)
+	defer restore()
+
+The default loggers are global, so output of goroutines that outlive the reconcile, or of
+another driver running in the same process, is written to the run as well.
+*/
+func (d *DriverLogger) SetDefault(opts *slog.HandlerOptions) (restore func()) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	previous := slog.Default()
+	writer := stdlog.Writer()
+	flags := stdlog.Flags()
+
+	slog.SetDefault(slog.New(NewHandler(d, opts)))
+
+	return func() {
+		defaultMu.Lock()
+		defer defaultMu.Unlock()
+
+		// slog.SetDefault does not hand the log package back to its previous output, so restore it explicitly
+		slog.SetDefault(previous)
+		stdlog.SetOutput(writer)
+		stdlog.SetFlags(flags)
+	}
+}
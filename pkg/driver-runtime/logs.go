@@ -0,0 +1,112 @@
+package driverruntime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+// LogQuery selects logs. Empty fields match all logs.
+type LogQuery struct {
+	// Pipeline is the name of the pipeline the logs were written in.
+	Pipeline string
+	// Driver is the name of the driver that wrote the logs.
+	Driver string
+	// RunID is the run the logs were written in.
+	RunID string
+	// Step is the ID of the pipeline step the logs were written in.
+	Step string
+	// Level is the minimum level of the logs, one of `debug`, `info`, `warn` or `error`.
+	Level string
+	// Labels are labels the logs must have.
+	Labels map[string]string
+}
+
+// values returns the query parameters of the query.
+func (q LogQuery) values() url.Values {
+	values := url.Values{}
+	set := func(key string, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	set("pipeline", q.Pipeline)
+	set("driver", q.Driver)
+	set("runid", q.RunID)
+	set("step", q.Step)
+	set("level", q.Level)
+
+	set("labels", joinPairs(q.Labels))
+	return values
+}
+
+// joinPairs formats a map as the sorted, comma separated `key=value` pairs query parameters expect.
+func joinPairs(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for key, value := range m {
+		pairs = append(pairs, key+"="+value)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
+
+/*
+Queries the stored logs from the Conveyor API, e.g. the warnings of a run:
+
+	logs, err := client.QueryLogs(ctx, driverruntime.LogQuery{RunID: runID, Level: "warn"})
+*/
+func (c *Client) QueryLogs(ctx context.Context, query LogQuery) ([]types.Log, error) {
+	path := "/logs"
+	if values := query.values(); len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+
+	var resp []types.Log
+	if err := c.doRequest(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, fmt.Errorf("QueryLogs: failed to query logs, %w", err)
+	}
+
+	return resp, nil
+}
+
+/*
+Streams the logs of a run from the Conveyor API. The logs written so far are yielded first, followed
+by the logs of all drivers of the run as they are written. The Step, Level and Labels of query filter
+the logs, its other fields are ignored.
+
+The stream does not end when the run completes, stop it by breaking out of the loop or by cancelling ctx:
+
+	for entry, err := range client.StreamRunLogs(ctx, runID, driverruntime.LogQuery{}) {
+		if err != nil {
+			return err
+		}
+		fmt.Println(entry.Message)
+	}
+*/
+func (c *Client) StreamRunLogs(ctx context.Context, runID string, query LogQuery) iter.Seq2[types.Log, error] {
+	values := LogQuery{Step: query.Step, Level: query.Level, Labels: query.Labels}.values()
+	path := "/logs/pipeline/" + url.PathEscape(runID)
+	if len(values) > 0 {
+		path += "?" + values.Encode()
+	}
+
+	return func(yield func(types.Log, error) bool) {
+		err := c.stream(ctx, path, func(data []byte) bool {
+			var entry types.Log
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return yield(types.Log{}, fmt.Errorf("StreamRunLogs: invalid log, %w", err))
+			}
+			return yield(entry, nil)
+		})
+		if err != nil && ctx.Err() == nil {
+			yield(types.Log{}, fmt.Errorf("StreamRunLogs: %w", err))
+		}
+	}
+}
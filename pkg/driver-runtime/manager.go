@@ -10,9 +10,16 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/fatih/color"
+	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/jetstream"
 	"github.com/open-ug/conveyor/internal/engine"
@@ -20,17 +27,94 @@ import (
 	types "github.com/open-ug/conveyor/pkg/types"
 )
 
+const (
+	// defaultShutdownTimeout is how long Run waits for in-flight reconciles once its context is cancelled.
+	defaultShutdownTimeout = 30 * time.Second
+
+	// ackWait is how long JetStream waits for an ack before redelivering a message.
+	// In-flight reconciles keep their message alive by sending progress acks.
+	ackWait = 30 * time.Second
+
+	// fetchWait bounds a single pull request.
+	fetchWait = 5 * time.Second
+
+	// defaultMaxRetries is how often a retryable failure is retried when MaxRetries is not set.
+	defaultMaxRetries = 5
+
+	// retryBackoff is the delay before the first retry of a retryable failure, doubling with every
+	// further retry up to maxRetryBackoff.
+	retryBackoff    = time.Second
+	maxRetryBackoff = 5 * time.Minute
+)
+
+// ErrManagerShutdown is returned by Run when the driver manager was already shut down. A driver manager cannot be
+// run again once Shutdown was called, create a new one instead.
+var ErrManagerShutdown = errors.New("driver manager was shut down")
+
 type DriverManager struct {
 	// The driver manager is responsible for managing the drivers
 	// and the driver lifecycle.
 	Driver *Driver
 
 	// an array of events that the driver manager will listen to
-	// and reconcile
+	// and reconcile. Entries are glob patterns such as `*` or `up*`,
+	// an empty array reconciles every event.
 	Events []string
 
 	// The API client to interact with the Conveyor API
 	Client *Client
+
+	// InstanceID identifies this driver manager in the driver registry.
+	// A random ID is generated when the driver manager is created.
+	InstanceID string
+
+	// ShutdownTimeout is how long Run waits for in-flight reconciles after its
+	// context is cancelled. If not set, defaults to 30 seconds.
+	ShutdownTimeout time.Duration
+
+	// MaxRetries bounds the retries of retryable failures: once an event was delivered more than
+	// MaxRetries times, a retryable failure ends the step. Every delivery counts, including
+	// requeues. If not set, defaults to 5.
+	MaxRetries int
+
+	// Labels describe the host the driver manager runs on, such as `arch=arm64` or `gpu=true`.
+	// Besides the steps any instance may run, the driver manager receives the steps whose
+	// selector matches its labels. Instances with the same labels share that work.
+	Labels map[string]string
+
+	// LogOptions configure how the logs of reconciles are batched before they are persisted.
+	LogOptions log.BatchOptions
+
+	nc       *nats.Conn
+	logs     *log.BatchLogger
+	js       jetstream.JetStream
+	registry jetstream.KeyValue
+	cancels  *nats.Subscription
+
+	// stopHeartbeat stops renewing the registry entry, heartbeatDone is closed once it stopped
+	stopHeartbeat context.CancelFunc
+	heartbeatDone chan struct{}
+
+	// stopFetching stops the fetch loop, reconcileCtx is cancelled to abort in-flight reconciles
+	stopFetching  context.CancelFunc
+	reconcileCtx  context.Context
+	stopReconcile context.CancelFunc
+	fetchDone     chan struct{}
+
+	initOnce     sync.Once
+	mu           sync.Mutex
+	inflight     map[jetstream.Msg]*inflightReconcile
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// inflightReconcile tracks a message that is currently being reconciled.
+type inflightReconcile struct {
+	runID  string
+	cancel context.CancelFunc
+	// abandoned is set when shutdown gave up on the reconcile and nak'd its message
+	abandoned bool
 }
 
 // NewDriverManager creates a new driver manager instance. It validates the driver and returns an error if the driver is invalid. The driver manager will listen to the specified events and reconcile the driver when those events are received.
@@ -45,16 +129,52 @@ func (c *Client) NewDriverManager(
 		return nil, err
 	}
 
+	for _, pattern := range events {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid event pattern %q: %w", pattern, err)
+		}
+	}
+
 	return &DriverManager{
-		Driver: driver,
-		Events: events,
-		Client: c,
+		Driver:     driver,
+		Events:     events,
+		Client:     c,
+		InstanceID: uuid.New().String(),
 	}, nil
 }
 
-func (d *DriverManager) Run() error {
-	// Setup NATS JetStream
+// init prepares the internal state of the driver manager. It allows a DriverManager
+// to be declared as a struct literal instead of through NewDriverManager.
+func (d *DriverManager) init() {
+	d.initOnce.Do(func() {
+		if d.InstanceID == "" {
+			d.InstanceID = uuid.New().String()
+		}
+		d.inflight = make(map[jetstream.Msg]*inflightReconcile)
+		d.shutdown = make(chan struct{})
+	})
+}
 
+// Handles reports whether the driver manager reconciles an event. An event is handled when it
+// matches one of the Events patterns and the driver has a reconcile function for it.
+// Resync events are handled whenever the driver has a resync interval.
+func (d *DriverManager) Handles(event string) bool {
+	if d.Driver.handlerFor(event) == nil {
+		return false
+	}
+	if len(d.Events) == 0 || (event == types.EventResync && d.Driver.ResyncInterval > 0) {
+		return true
+	}
+	for _, pattern := range d.Events {
+		if matched, _ := path.Match(pattern, event); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// connect opens the NATS connection and JetStream context used by the driver manager.
+func (d *DriverManager) connect() error {
 	connectOptions := []nats.Option{
 		nats.Name("Conveyor Driver Manager - " + d.Driver.Name),
 		nats.MaxReconnects(-1), // infinite reconnects
@@ -101,10 +221,39 @@ func (d *DriverManager) Run() error {
 	}
 	js, err := jetstream.New(nc)
 	if err != nil {
+		nc.Close()
 		color.Red("Error Occured while creating JetStream context: %v", err)
 		return err
 	}
 
+	d.nc = nc
+	d.js = js
+	d.logs = log.NewBatchLogger(nc, d.LogOptions)
+	return nil
+}
+
+/*
+Run connects the driver manager to NATS, registers it in the driver registry and reconciles
+incoming events until ctx is cancelled or Shutdown is called.
+
+When ctx is cancelled, Run shuts the driver manager down gracefully, waiting up to
+ShutdownTimeout for in-flight reconciles to finish. Use SignalContext to stop on SIGINT/SIGTERM.
+It returns ErrManagerShutdown if Shutdown was called before.
+*/
+func (d *DriverManager) Run(ctx context.Context) error {
+	d.init()
+
+	select {
+	case <-d.shutdown:
+		// Nothing would stop the connection and the registration made from now on
+		return ErrManagerShutdown
+	default:
+	}
+
+	if err := d.connect(); err != nil {
+		return err
+	}
+
 	// Resources
 	var filterSubjects []string
 	for _, resource := range d.Driver.Resources {
@@ -112,62 +261,467 @@ func (d *DriverManager) Run() error {
 		filterSubjects = append(filterSubjects, "drivers."+d.Driver.Name+".resources."+resource)
 	}
 
-	consumer, err := js.CreateOrUpdateConsumer(context.Background(), "messages", jetstream.ConsumerConfig{
+	consumer, err := d.js.CreateOrUpdateConsumer(ctx, "messages", jetstream.ConsumerConfig{
 		Name:           d.Driver.Name,
 		FilterSubjects: filterSubjects,
 		AckPolicy:      jetstream.AckExplicitPolicy,
-		MaxAckPending:  1,
+		AckWait:        ackWait,
 		// Deliver from last acknowledged message
 		DeliverPolicy: jetstream.DeliverAllPolicy,
 	})
 
 	if err != nil {
+		d.nc.Close()
 		color.Red("Error Occured while subscribing to NATS channel: %v", err)
 		return err
 	}
+	consumers := []jetstream.Consumer{consumer}
 
-	// CONSUMER
-	_, err = consumer.Consume(func(msg jetstream.Msg) {
-		msg.Ack()
-		data := msg.Data()
-		var message types.DriverMessage
-		err := json.Unmarshal([]byte(data), &message)
+	// Steps selecting instances by their labels are routed to the pool of instances with the same labels
+	if pool := types.DriverPool(d.Labels); pool != "" {
+		var poolSubjects []string
+		for _, resource := range d.Driver.Resources {
+			poolSubjects = append(poolSubjects, types.DriverPoolSubject(d.Driver.Name, pool, resource))
+		}
+
+		poolConsumer, err := d.js.CreateOrUpdateConsumer(ctx, "messages", jetstream.ConsumerConfig{
+			Name:           d.Driver.Name + "-" + pool,
+			FilterSubjects: poolSubjects,
+			AckPolicy:      jetstream.AckExplicitPolicy,
+			AckWait:        ackWait,
+			DeliverPolicy:  jetstream.DeliverAllPolicy,
+		})
 		if err != nil {
-			color.Red("Error Occured while unmarshalling message: %v", err)
-			return
+			d.nc.Close()
+			color.Red("Error Occured while subscribing to NATS channel: %v", err)
+			return err
 		}
+		// Work only this pool can do is fetched first
+		consumers = append([]jetstream.Consumer{poolConsumer}, consumers...)
+	}
 
-		logger := log.NewDriverLogger(d.Driver.Name, map[string]string{
-			"event":  message.Event,
-			"id":     message.ID,
-			"run_id": message.RunID,
-		}, nc)
+	// Cancel in-flight reconciles of runs that get cancelled
+	d.cancels, err = d.nc.Subscribe("runs.cancel.*", func(msg *nats.Msg) {
+		d.cancelRun(strings.TrimPrefix(msg.Subject, "runs.cancel."))
+	})
+	if err != nil {
+		color.Red("Error Occured while subscribing to run cancellations: %v", err)
+	}
+
+	d.register(ctx)
 
-		result := d.Driver.Reconcile(message.Payload, message.Event, message.RunID, logger)
+	fetchCtx, stopFetching := context.WithCancel(context.Background())
+	d.mu.Lock()
+	d.reconcileCtx, d.stopReconcile = context.WithCancel(context.Background())
+	d.stopFetching = stopFetching
+	d.fetchDone = make(chan struct{})
+	d.mu.Unlock()
 
-		driverevent := engine.DriverResultEvent{
-			Success: result.Success,
-			Message: result.Message,
-			Driver:  d.Driver.Name,
-			Data:    result.Data,
+	go d.fetchLoop(fetchCtx, consumers)
+
+	fmt.Println("Driver Manager is running for driver: ", d.Driver.Name)
+
+	select {
+	case <-ctx.Done():
+		timeout := d.ShutdownTimeout
+		if timeout <= 0 {
+			timeout = defaultShutdownTimeout
 		}
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return d.Shutdown(shutdownCtx)
+	case <-d.shutdown:
+		return d.shutdownErr
+	}
+}
 
-		var resource types.Resource
-		err = json.Unmarshal([]byte(message.Payload), &resource)
-		if err != nil {
-			color.Red("Error Occured while unmarshalling resource: %v", err)
+// fetchLoop pulls messages one at a time so that a message is never held by an
+// instance that is not ready to reconcile it. With several consumers, it takes turns
+// between them, each pull waiting a share of fetchWait.
+func (d *DriverManager) fetchLoop(ctx context.Context, consumers []jetstream.Consumer) {
+	defer close(d.fetchDone)
+
+	wait := fetchWait / time.Duration(len(consumers))
+	for turn := 0; ctx.Err() == nil; turn++ {
+		consumer := consumers[turn%len(consumers)]
+		fetchCtx, cancel := context.WithTimeout(ctx, wait)
+		msg, err := consumer.Next(jetstream.FetchContext(fetchCtx))
+		cancel()
+
+		if ctx.Err() != nil {
+			if msg != nil {
+				// Shutdown started while the message was in flight, let another instance take it
+				msg.Nak()
+			}
 			return
 		}
 
-		driverevent.PublishEvent(message.RunID, resource, js)
+		if err != nil {
+			if errors.Is(err, nats.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, jetstream.ErrNoMessages) {
+				continue
+			}
+			if errors.Is(err, nats.ErrConnectionClosed) {
+				return
+			}
+			color.Red("Error Occured while fetching messages: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		d.handleMessage(msg)
+	}
+}
+
+// handleMessage reconciles a single message and acknowledges it once the result is published.
+func (d *DriverManager) handleMessage(msg jetstream.Msg) {
+	data := msg.Data()
+	var message types.DriverMessage
+	err := json.Unmarshal([]byte(data), &message)
+	if err != nil {
+		color.Red("Error Occured while unmarshalling message: %v", err)
+		// The message will never become valid, do not redeliver it
+		msg.Term()
+		return
+	}
+
+	var resource types.Resource
+	if err := json.Unmarshal([]byte(message.Payload), &resource); err != nil {
+		color.Red("Error Occured while unmarshalling resource: %v", err)
+		// The payload will never become a resource, do not call the driver nor redeliver it
+		msg.Term()
+		return
+	}
+
+	trigger := message.Trigger
+	if trigger == "" {
+		trigger = message.Event
+	}
+	deleting := (trigger == types.EventDelete || resource.DeletionTimestamp != nil)
+	// A deleted resource keeps the finalizer of the driver until the delete handler reconciled it,
+	// whatever the event and the patterns the driver subscribed to
+	event := message.Event
+	if deleting && d.Driver.Finalizer != "" {
+		event = types.EventDelete
+	} else if !d.Handles(message.Event) {
+		// Not an event this driver cares about, skip it without calling the driver
+		if message.Step != "" {
+			// The pipeline waits for the step to end
+			d.skipStep(msg, message, trigger, resource)
+		}
+		msg.Ack()
+		return
+	}
+
+	ctx, cancel := context.WithCancel(d.reconcileCtx)
+	defer cancel()
+
+	tracked := &inflightReconcile{runID: message.RunID, cancel: cancel}
+	d.mu.Lock()
+	d.inflight[msg] = tracked
+	d.mu.Unlock()
+
+	// Keep the message alive while the driver is working on it
+	heartbeatDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ackWait / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-heartbeatDone:
+				return
+			case <-ticker.C:
+				msg.InProgress()
+			}
+		}
+	}()
+
+	logger := log.NewDriverLogger(d.Driver.Name, map[string]string{
+		"event":    message.Event,
+		"id":       message.ID,
+		"run_id":   message.RunID,
+		"pipeline": resource.Pipeline,
+		"step":     message.Step,
+	}, d.nc).WithContext(ctx)
+	if d.logs != nil {
+		logger.Logger = d.logs
+	}
+
+	if !deleting {
+		d.addFinalizer(ctx, resource)
+	}
+
+	reconcile := d.Driver.handlerFor(event)
+	result := reconcile(message.Payload, event, message.RunID, logger)
+	if deleting && result.Success {
+		if err := d.removeFinalizer(ctx, resource); err != nil {
+			result = types.DriverResult{Success: false, Retryable: true, Message: err.Error()}
+		}
+	}
+	// Persist the logs of the reconcile before its result ends the step
+	if err := logger.Flush(); err != nil {
+		color.Red("Error Occured while flushing logs of run %s: %v", message.RunID, err)
+	}
+	close(heartbeatDone)
+
+	d.mu.Lock()
+	delete(d.inflight, msg)
+	abandoned := tracked.abandoned
+	d.mu.Unlock()
+
+	if abandoned {
+		// Shutdown already nak'd the message, the result belongs to the redelivery
+		return
+	}
+
+	attempt := 1
+	if metadata, err := msg.Metadata(); err == nil {
+		attempt = int(metadata.NumDelivered)
+	}
+
+	driverevent := engine.DriverResultEvent{
+		Success: result.Success,
+		Message: result.Message,
+		Driver:  d.Driver.Name,
+		Data:    result.Data,
+		Attempt: attempt,
+		Event:   message.Event,
+	}
+	if trigger != message.Event {
+		driverevent.Trigger = trigger
+	}
+	if ctx.Err() == nil {
+		// A cancelled run is not reconciled again
+		driverevent.RequeueAfter = d.requeueDelay(result, attempt)
+	}
+
+	driverevent.PublishEvent(message.RunID, resource, d.js)
+	if driverevent.Requeued() {
+		msg.NakWithDelay(driverevent.RequeueAfter)
+		return
+	}
+	msg.Ack()
+}
+
+// skipStep publishes the result of a pipeline step whose event the driver does not handle, so that the run goes on.
+func (d *DriverManager) skipStep(msg jetstream.Msg, message types.DriverMessage, trigger string, resource types.Resource) {
+	attempt := 1
+	if metadata, err := msg.Metadata(); err == nil {
+		attempt = int(metadata.NumDelivered)
+	}
+
+	driverevent := engine.DriverResultEvent{
+		Success: true,
+		Skipped: true,
+		Message: fmt.Sprintf("event %s is not handled by driver %s", message.Event, d.Driver.Name),
+		Driver:  d.Driver.Name,
+		Attempt: attempt,
+		Event:   message.Event,
+	}
+	if trigger != message.Event {
+		driverevent.Trigger = trigger
+	}
+	driverevent.PublishEvent(message.RunID, resource, d.js)
+}
+
+// addFinalizer adds the finalizer of the driver to a resource it is about to reconcile, when it does not have it yet.
+// A failure is only logged, the resource is reconciled anyway.
+func (d *DriverManager) addFinalizer(ctx context.Context, resource types.Resource) {
+	if d.Driver.Finalizer == "" || d.Client == nil || slices.Contains(resource.Finalizers, d.Driver.Finalizer) {
+		return
+	}
+	if _, err := d.Client.AddFinalizer(ctx, resource.Resource, resource.Name, d.Driver.Finalizer); err != nil && !IsNotFound(err) {
+		color.Red("Error Occured while adding finalizer to resource %s: %v", resource.Name, err)
+	}
+}
+
+// removeFinalizer removes the finalizer of the driver from a resource whose deletion it reconciled.
+// A resource that is already gone has nothing left to finalize.
+func (d *DriverManager) removeFinalizer(ctx context.Context, resource types.Resource) error {
+	if d.Driver.Finalizer == "" || d.Client == nil {
+		return nil
+	}
+	if _, err := d.Client.RemoveFinalizer(ctx, resource.Resource, resource.Name, d.Driver.Finalizer); err != nil && !IsNotFound(err) {
+		return fmt.Errorf("failed to remove finalizer %s: %w", d.Driver.Finalizer, err)
+	}
+	return nil
+}
+
+// requeueDelay returns how long to wait before reconciling an event again, or zero when the result ends the step.
+func (d *DriverManager) requeueDelay(result types.DriverResult, attempt int) time.Duration {
+	if result.RequeueAfter > 0 {
+		return result.RequeueAfter
+	}
+	if result.Success || !result.Retryable {
+		return 0
+	}
+
+	maxRetries := d.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+	if attempt > maxRetries {
+		return 0
+	}
+
+	delay := retryBackoff << (attempt - 1)
+	if delay <= 0 || delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	return delay
+}
+
+// cancelRun cancels the context of in-flight reconciles that belong to a run.
+func (d *DriverManager) cancelRun(runID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, tracked := range d.inflight {
+		if tracked.runID == runID {
+			tracked.cancel()
+		}
+	}
+}
+
+/*
+Shutdown gracefully stops the driver manager. It stops fetching new messages and waits for
+in-flight reconciles to finish. If ctx expires first, the remaining reconciles are cancelled
+and their messages are nak'd so that another instance picks them up. Finally the driver manager
+deregisters itself from the driver registry and closes its NATS connection.
+*/
+func (d *DriverManager) Shutdown(ctx context.Context) error {
+	d.init()
+	d.shutdownOnce.Do(func() {
+		d.shutdownErr = d.shutdownGracefully(ctx)
+		close(d.shutdown)
 	})
+	return d.shutdownErr
+}
 
+func (d *DriverManager) shutdownGracefully(ctx context.Context) error {
+	d.mu.Lock()
+	stopFetching := d.stopFetching
+	d.mu.Unlock()
+	if stopFetching == nil {
+		// Run has not started consuming, there is nothing to drain
+		return nil
+	}
+
+	fmt.Println("Shutting down Driver Manager for driver: ", d.Driver.Name)
+	stopFetching()
+	if d.cancels != nil {
+		d.cancels.Unsubscribe()
+	}
+
+	var shutdownErr error
+	select {
+	case <-d.fetchDone:
+	case <-ctx.Done():
+		d.mu.Lock()
+		for msg, tracked := range d.inflight {
+			tracked.abandoned = true
+			tracked.cancel()
+			if err := msg.Nak(); err != nil {
+				color.Red("Error Occured while releasing message of run %s: %v", tracked.runID, err)
+			}
+		}
+		abandoned := len(d.inflight)
+		d.mu.Unlock()
+		d.stopReconcile()
+		shutdownErr = fmt.Errorf("shutdown deadline exceeded, released %d in-flight reconcile(s): %w", abandoned, ctx.Err())
+	}
+
+	d.deregister()
+
+	if d.logs != nil {
+		if err := d.logs.Close(ctx); err != nil && shutdownErr == nil {
+			shutdownErr = err
+		}
+	}
+	if err := d.nc.Flush(); err != nil && shutdownErr == nil {
+		shutdownErr = err
+	}
+	d.nc.Close()
+	d.stopReconcile()
+
+	return shutdownErr
+}
+
+// register advertises the driver manager in the driver registry.
+// Registration is best effort, older API servers do not provide the registry.
+func (d *DriverManager) register(ctx context.Context) {
+	registry, err := d.js.KeyValue(ctx, "drivers")
 	if err != nil {
-		color.Red("Error Occured while consuming messages: %v", err)
-		return err
+		color.Yellow("Driver registry unavailable, skipping registration: %v", err)
+		return
 	}
 
-	fmt.Println("Driver Manager is running for driver: ", d.Driver.Name)
+	instance := types.DriverInstance{
+		ID:        d.InstanceID,
+		Driver:    d.Driver.Name,
+		Resources: d.Driver.Resources,
+		Events:    d.Events,
+		Labels:    d.Labels,
+		Pool:      types.DriverPool(d.Labels),
+		StartedAt: time.Now().UTC(),
+
+		ResyncInterval: d.Driver.ResyncInterval,
+	}
+	value, err := json.Marshal(instance)
+	if err != nil {
+		color.Red("Error Occured while marshalling driver instance: %v", err)
+		return
+	}
+
+	if _, err := registry.Put(ctx, d.registryKey(), value); err != nil {
+		color.Red("Error Occured while registering driver instance: %v", err)
+		return
+	}
+	d.registry = registry
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(context.Background())
+	d.stopHeartbeat = stopHeartbeat
+	d.heartbeatDone = make(chan struct{})
+	go d.heartbeat(heartbeatCtx, value)
+}
+
+// heartbeat renews the registry entry every DriverHeartbeatInterval until ctx is cancelled,
+// so the entry does not expire while the driver manager runs.
+func (d *DriverManager) heartbeat(ctx context.Context, value []byte) {
+	defer close(d.heartbeatDone)
+
+	ticker := time.NewTicker(types.DriverHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			putCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			_, err := d.registry.Put(putCtx, d.registryKey(), value)
+			cancel()
+			if err != nil && ctx.Err() == nil {
+				color.Red("Error Occured while renewing driver registration: %v", err)
+			}
+		}
+	}
+}
+
+// deregister removes the driver manager from the driver registry.
+func (d *DriverManager) deregister() {
+	if d.registry == nil {
+		return
+	}
+	// A renewal after the delete would register the instance again
+	d.stopHeartbeat()
+	<-d.heartbeatDone
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := d.registry.Delete(ctx, d.registryKey()); err != nil {
+		color.Red("Error Occured while deregistering driver instance: %v", err)
+	}
+}
 
-	select {}
+func (d *DriverManager) registryKey() string {
+	return d.Driver.Name + "." + d.InstanceID
 }
@@ -0,0 +1,461 @@
+package driverruntime_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/open-ug/conveyor/internal/engine"
+	"github.com/open-ug/conveyor/internal/utils"
+	driverruntime "github.com/open-ug/conveyor/pkg/driver-runtime"
+	"github.com/open-ug/conveyor/pkg/driver-runtime/log"
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startNats starts an embedded NATS server with the Conveyor streams.
+func startNats(t *testing.T) *utils.NatsContext {
+	natsContext := utils.NewNatsConn(&types.ServerConfig{
+		API:  types.APIConfig{Data: t.TempDir()},
+		NATS: types.NATSConfig{Port: -1},
+	})
+	t.Cleanup(natsContext.Shutdown)
+
+	// In test mode JetStream state is kept in a shared directory, start from empty streams
+	for _, stream := range []string{"messages", "pipeline-engine", "logs-engine"} {
+		natsContext.JetStream.DeleteStream(context.Background(), stream)
+	}
+	require.NoError(t, natsContext.InitiateStreams())
+	return natsContext
+}
+
+// publishDriverMessage publishes a resource event addressed to the given driver once its consumer exists.
+func publishDriverMessage(t *testing.T, natsContext *utils.NatsContext, driver string, event string, runID string) {
+	// The messages stream only retains messages that a consumer is interested in
+	require.Eventually(t, func() bool {
+		_, err := natsContext.JetStream.Consumer(context.Background(), "messages", driver)
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+
+	payload, err := json.Marshal(types.Resource{Name: "sample", Resource: "pipe"})
+	require.NoError(t, err)
+	message, err := json.Marshal(types.DriverMessage{Event: event, RunID: runID, ID: runID, Payload: string(payload)})
+	require.NoError(t, err)
+	_, err = natsContext.JetStream.Publish(context.Background(), "drivers."+driver+".resources.pipe", message)
+	require.NoError(t, err)
+}
+
+func TestDriverManager_Shutdown(t *testing.T) {
+	natsContext := startNats(t)
+
+	client, err := driverruntime.NewClient("http://localhost:8080", natsContext.NatsCon.ConnectedUrl(), driverruntime.ConfigOptions{})
+	require.NoError(t, err)
+
+	t.Run("waits for in-flight reconciles", func(t *testing.T) {
+		started := make(chan struct{})
+		manager, err := client.NewDriverManager(&driverruntime.Driver{
+			Name:      "finishing-driver",
+			Resources: []string{"pipe"},
+			Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+				close(started)
+				time.Sleep(300 * time.Millisecond)
+				return types.DriverResult{Success: true, Message: "done"}
+			},
+		}, []string{"*"})
+		require.NoError(t, err)
+
+		results, err := natsContext.NatsCon.SubscribeSync("pipelines.driver.result")
+		require.NoError(t, err)
+		defer results.Unsubscribe()
+
+		runErr := make(chan error, 1)
+		go func() { runErr <- manager.Run(context.Background()) }()
+
+		publishDriverMessage(t, natsContext, "finishing-driver", types.EventCreate, "run-1")
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		assert.NoError(t, manager.Shutdown(ctx))
+		assert.NoError(t, <-runErr)
+
+		msg, err := results.NextMsg(time.Second)
+		require.NoError(t, err)
+		assert.Contains(t, string(msg.Data), `"run_id":"run-1"`)
+
+		// The instance deregistered itself from the driver registry
+		registry, err := natsContext.JetStream.KeyValue(context.Background(), "drivers")
+		require.NoError(t, err)
+		_, err = registry.Get(context.Background(), "finishing-driver."+manager.InstanceID)
+		assert.ErrorIs(t, err, jetstream.ErrKeyNotFound)
+	})
+
+	t.Run("releases reconciles that miss the deadline", func(t *testing.T) {
+		started := make(chan struct{})
+		cancelled := make(chan struct{})
+		manager, err := client.NewDriverManager(&driverruntime.Driver{
+			Name:      "stuck-driver",
+			Resources: []string{"pipe"},
+			Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+				close(started)
+				<-logger.Context().Done()
+				close(cancelled)
+				return types.DriverResult{Success: false, Message: "interrupted"}
+			},
+		}, []string{"*"})
+		require.NoError(t, err)
+		manager.ShutdownTimeout = 200 * time.Millisecond
+
+		ctx, stop := context.WithCancel(context.Background())
+		runErr := make(chan error, 1)
+		go func() { runErr <- manager.Run(ctx) }()
+
+		publishDriverMessage(t, natsContext, "stuck-driver", types.EventCreate, "run-2")
+		<-started
+		stop()
+
+		assert.ErrorIs(t, <-runErr, context.DeadlineExceeded)
+		select {
+		case <-cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("reconcile context was not cancelled")
+		}
+
+		// The message is handed back to the stream for another instance
+		consumer, err := natsContext.JetStream.Consumer(context.Background(), "messages", "stuck-driver")
+		require.NoError(t, err)
+		msg, err := consumer.Next(jetstream.FetchMaxWait(2 * time.Second))
+		require.NoError(t, err)
+		metadata, err := msg.Metadata()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), metadata.NumDelivered)
+		assert.NoError(t, msg.DoubleAck(context.Background()))
+	})
+
+	t.Run("cannot run once shut down", func(t *testing.T) {
+		manager, err := client.NewDriverManager(&driverruntime.Driver{
+			Name:      "stopped-driver",
+			Resources: []string{"pipe"},
+			Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+				return types.DriverResult{Success: true}
+			},
+		}, []string{"*"})
+		require.NoError(t, err)
+
+		require.NoError(t, manager.Shutdown(context.Background()))
+		assert.ErrorIs(t, manager.Run(context.Background()), driverruntime.ErrManagerShutdown)
+
+		// The instance never registered itself nor subscribed to events
+		registry, err := natsContext.JetStream.KeyValue(context.Background(), "drivers")
+		require.NoError(t, err)
+		_, err = registry.Get(context.Background(), "stopped-driver."+manager.InstanceID)
+		assert.ErrorIs(t, err, jetstream.ErrKeyNotFound)
+		_, err = natsContext.JetStream.Consumer(context.Background(), "messages", "stopped-driver")
+		assert.ErrorIs(t, err, jetstream.ErrConsumerNotFound)
+	})
+}
+
+func TestDriverManager_Handles(t *testing.T) {
+	client, err := driverruntime.NewClient("http://localhost:8080", "", driverruntime.ConfigOptions{})
+	require.NoError(t, err)
+
+	noop := func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+		return types.DriverResult{Success: true}
+	}
+
+	t.Run("glob patterns", func(t *testing.T) {
+		manager, err := client.NewDriverManager(&driverruntime.Driver{
+			Name:      "filtered-driver",
+			Resources: []string{"pipe"},
+			Reconcile: noop,
+		}, []string{"create", "up*"})
+		require.NoError(t, err)
+
+		assert.True(t, manager.Handles(types.EventCreate))
+		assert.True(t, manager.Handles(types.EventUpdate))
+		assert.False(t, manager.Handles(types.EventDelete))
+	})
+
+	t.Run("event handlers", func(t *testing.T) {
+		driver := &driverruntime.Driver{Name: "cleanup-driver", Resources: []string{"pipe"}}
+		driver.OnDelete(noop)
+		manager, err := client.NewDriverManager(driver, []string{"*"})
+		require.NoError(t, err)
+
+		assert.True(t, manager.Handles(types.EventDelete))
+		assert.False(t, manager.Handles(types.EventCreate))
+	})
+
+	t.Run("resync events", func(t *testing.T) {
+		driver := &driverruntime.Driver{Name: "infra-driver", Resources: []string{"cluster"}, Reconcile: noop}
+		manager, err := client.NewDriverManager(driver, []string{"create"})
+		require.NoError(t, err)
+		assert.False(t, manager.Handles(types.EventResync))
+
+		// Drivers with a resync interval handle resyncs whatever their event patterns
+		driver.ResyncInterval = 10 * time.Minute
+		assert.True(t, manager.Handles(types.EventResync))
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := client.NewDriverManager(&driverruntime.Driver{
+			Name:      "filtered-driver",
+			Resources: []string{"pipe"},
+			Reconcile: noop,
+		}, []string{"[create"})
+		assert.Error(t, err)
+	})
+}
+
+func TestDriverManager_SkipsUnhandledEvents(t *testing.T) {
+	natsContext := startNats(t)
+
+	client, err := driverruntime.NewClient("http://localhost:8080", natsContext.NatsCon.ConnectedUrl(), driverruntime.ConfigOptions{})
+	require.NoError(t, err)
+
+	events := make(chan string, 2)
+	driver := &driverruntime.Driver{Name: "cleanup-driver", Resources: []string{"pipe"}}
+	driver.OnDelete(func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+		events <- event
+		return types.DriverResult{Success: true}
+	})
+	manager, err := client.NewDriverManager(driver, []string{"*"})
+	require.NoError(t, err)
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go manager.Run(ctx)
+
+	publishDriverMessage(t, natsContext, "cleanup-driver", types.EventCreate, "run-1")
+	publishDriverMessage(t, natsContext, "cleanup-driver", types.EventDelete, "run-2")
+
+	select {
+	case event := <-events:
+		assert.Equal(t, types.EventDelete, event)
+	case <-time.After(5 * time.Second):
+		t.Fatal("delete event was not reconciled")
+	}
+
+	// The create event was acknowledged without reaching the driver
+	consumer, err := natsContext.JetStream.Consumer(context.Background(), "messages", "cleanup-driver")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		info, err := consumer.Info(context.Background())
+		return err == nil && info.NumAckPending == 0 && info.NumPending == 0
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Empty(t, events)
+}
+
+func TestDriverManager_SkipsUnhandledSteps(t *testing.T) {
+	natsContext := startNats(t)
+
+	client, err := driverruntime.NewClient("http://localhost:8080", natsContext.NatsCon.ConnectedUrl(), driverruntime.ConfigOptions{})
+	require.NoError(t, err)
+
+	results, err := natsContext.NatsCon.SubscribeSync("pipelines.driver.result")
+	require.NoError(t, err)
+	defer results.Unsubscribe()
+
+	manager, err := client.NewDriverManager(&driverruntime.Driver{
+		Name:      "create-driver",
+		Resources: []string{"pipe"},
+		Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+			t.Errorf("the driver reconciled a %s event", event)
+			return types.DriverResult{Success: true}
+		},
+	}, []string{types.EventCreate})
+	require.NoError(t, err)
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go manager.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		_, err := natsContext.JetStream.Consumer(context.Background(), "messages", "create-driver")
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	payload, err := json.Marshal(types.Resource{Name: "sample", Resource: "pipe", Pipeline: "build"})
+	require.NoError(t, err)
+	message, err := json.Marshal(types.DriverMessage{Event: types.EventProcess, RunID: "run-1", ID: "run-1", Step: "compile", Trigger: types.EventUpdate, Payload: string(payload)})
+	require.NoError(t, err)
+	_, err = natsContext.JetStream.Publish(context.Background(), "drivers.create-driver.resources.pipe", message)
+	require.NoError(t, err)
+
+	// The step ends with a skipped result instead of leaving the run waiting
+	msg, err := results.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	var event engine.PipelineEvent
+	require.NoError(t, json.Unmarshal(msg.Data, &event))
+	assert.Equal(t, "run-1", event.RunID)
+	assert.True(t, event.DriverResultEvent.Success)
+	assert.True(t, event.DriverResultEvent.Skipped)
+	assert.False(t, event.DriverResultEvent.Requeued())
+	assert.Equal(t, "create-driver", event.DriverResultEvent.Driver)
+	assert.Equal(t, types.EventProcess, event.DriverResultEvent.Event)
+	assert.Equal(t, types.EventUpdate, event.DriverResultEvent.Trigger)
+}
+
+func TestDriverManager_InvalidPayload(t *testing.T) {
+	natsContext := startNats(t)
+
+	client, err := driverruntime.NewClient("http://localhost:8080", natsContext.NatsCon.ConnectedUrl(), driverruntime.ConfigOptions{})
+	require.NoError(t, err)
+
+	runs := make(chan string, 2)
+	manager, err := client.NewDriverManager(&driverruntime.Driver{
+		Name:      "strict-driver",
+		Resources: []string{"pipe"},
+		Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+			runs <- runID
+			return types.DriverResult{Success: true}
+		},
+	}, []string{"*"})
+	require.NoError(t, err)
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go manager.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		_, err := natsContext.JetStream.Consumer(context.Background(), "messages", "strict-driver")
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	message, err := json.Marshal(types.DriverMessage{Event: types.EventCreate, RunID: "run-1", ID: "run-1", Payload: "not a resource"})
+	require.NoError(t, err)
+	_, err = natsContext.JetStream.Publish(context.Background(), "drivers.strict-driver.resources.pipe", message)
+	require.NoError(t, err)
+	publishDriverMessage(t, natsContext, "strict-driver", types.EventCreate, "run-2")
+
+	select {
+	case runID := <-runs:
+		assert.Equal(t, "run-2", runID, "the invalid payload reached the driver")
+	case <-time.After(5 * time.Second):
+		t.Fatal("valid event was not reconciled")
+	}
+
+	// The invalid payload is terminated instead of being redelivered
+	consumer, err := natsContext.JetStream.Consumer(context.Background(), "messages", "strict-driver")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		info, err := consumer.Info(context.Background())
+		return err == nil && info.NumAckPending == 0 && info.NumPending == 0 && info.NumRedelivered == 0
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Empty(t, runs)
+}
+
+func TestDriverManager_Labels(t *testing.T) {
+	natsContext := startNats(t)
+
+	client, err := driverruntime.NewClient("http://localhost:8080", natsContext.NatsCon.ConnectedUrl(), driverruntime.ConfigOptions{})
+	require.NoError(t, err)
+
+	reconciled := make(chan string, 2)
+	newManager := func(arch string) *driverruntime.DriverManager {
+		manager, err := client.NewDriverManager(&driverruntime.Driver{
+			Name:      "build-driver",
+			Resources: []string{"pipe"},
+			Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+				reconciled <- arch + ":" + runID
+				return types.DriverResult{Success: true}
+			},
+		}, nil)
+		require.NoError(t, err)
+		manager.Labels = map[string]string{"arch": arch}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		go manager.Run(ctx)
+		return manager
+	}
+	arm := newManager("arm64")
+	newManager("amd64")
+
+	// The instance advertises its labels and pool in the driver registry
+	registry, err := natsContext.JetStream.KeyValue(context.Background(), "drivers")
+	require.NoError(t, err)
+	var instance types.DriverInstance
+	require.Eventually(t, func() bool {
+		entry, err := registry.Get(context.Background(), "build-driver."+arm.InstanceID)
+		return err == nil && json.Unmarshal(entry.Value(), &instance) == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Equal(t, "arm64", instance.Labels["arch"])
+	pool := types.DriverPool(map[string]string{"arch": "arm64"})
+	assert.Equal(t, pool, instance.Pool)
+
+	require.Eventually(t, func() bool {
+		_, err := natsContext.JetStream.Consumer(context.Background(), "messages", "build-driver-"+pool)
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+
+	payload, err := json.Marshal(types.Resource{Name: "sample", Resource: "pipe"})
+	require.NoError(t, err)
+	message, err := json.Marshal(types.DriverMessage{Event: types.EventCreate, RunID: "run-arm", ID: "run-arm", Payload: string(payload)})
+	require.NoError(t, err)
+	_, err = natsContext.JetStream.Publish(context.Background(), types.DriverPoolSubject("build-driver", pool, "pipe"), message)
+	require.NoError(t, err)
+
+	select {
+	case got := <-reconciled:
+		assert.Equal(t, "arm64:run-arm", got)
+	case <-time.After(10 * time.Second):
+		t.Fatal("step routed to the arm64 pool was not reconciled")
+	}
+	select {
+	case got := <-reconciled:
+		t.Fatalf("step was reconciled twice: %s", got)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestDriverManager_Logs(t *testing.T) {
+	natsContext := startNats(t)
+
+	client, err := driverruntime.NewClient("http://localhost:8080", natsContext.NatsCon.ConnectedUrl(), driverruntime.ConfigOptions{})
+	require.NoError(t, err)
+
+	manager, err := client.NewDriverManager(&driverruntime.Driver{
+		Name:      "test-driver",
+		Resources: []string{"pipe"},
+		Reconcile: func(message, event, runID string, logger *log.DriverLogger) types.DriverResult {
+			logger.Log(nil, "starting")
+			fmt.Fprint(logger, "=== RUN TestA\n--- PASS: Te")
+			fmt.Fprint(logger, "stA\nok")
+			return types.DriverResult{Success: true}
+		},
+	}, nil)
+	require.NoError(t, err)
+	manager.LogOptions.FlushInterval = time.Hour
+
+	results, err := natsContext.NatsCon.SubscribeSync("pipelines.driver.result")
+	require.NoError(t, err)
+	defer results.Unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go manager.Run(ctx)
+
+	publishDriverMessage(t, natsContext, "test-driver", types.EventCreate, "run-logs")
+	_, err = results.NextMsg(10 * time.Second)
+	require.NoError(t, err)
+
+	// The logs of the reconcile were persisted as one batch before its result, including the unterminated last line
+	stream, err := natsContext.JetStream.Stream(context.Background(), "logs-engine")
+	require.NoError(t, err)
+	msg, err := stream.GetLastMsgForSubject(context.Background(), "logs.run-logs")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), msg.Sequence)
+
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(string(msg.Data)), "\n") {
+		var entry types.Log
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		assert.Equal(t, "run-logs", entry.RunID)
+		messages = append(messages, entry.Message)
+	}
+	assert.Equal(t, []string{"starting", "=== RUN TestA", "--- PASS: TestA", "ok"}, messages)
+}
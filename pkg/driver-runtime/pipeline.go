@@ -0,0 +1,66 @@
+package driverruntime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+/*
+Creates a new Pipeline in the Conveyor API.
+A pipeline runs its steps one after the other for every event of resources that reference it.
+The resource definition of the pipeline must exist.
+*/
+func (c *Client) CreatePipeline(ctx context.Context, pipeline *types.Pipeline) (*types.Pipeline, error) {
+	var resp types.Pipeline
+	if err := c.doRequest(ctx, http.MethodPost, "/pipelines/", pipeline, &resp); err != nil {
+		return nil, fmt.Errorf("CreatePipeline: failed to create pipeline, %w", err)
+	}
+
+	return &resp, nil
+}
+
+// Gets a Pipeline by its name from the Conveyor API.
+func (c *Client) GetPipeline(ctx context.Context, name string) (*types.Pipeline, error) {
+	var resp types.Pipeline
+	if err := c.doRequest(ctx, http.MethodGet, "/pipelines/"+url.PathEscape(name), nil, &resp); err != nil {
+		return nil, fmt.Errorf("GetPipeline: failed to get pipeline, %w", err)
+	}
+
+	return &resp, nil
+}
+
+// Lists all Pipelines in the Conveyor API.
+func (c *Client) ListPipelines(ctx context.Context) ([]types.Pipeline, error) {
+	var resp []types.Pipeline
+	if err := c.doRequest(ctx, http.MethodGet, "/pipelines/", nil, &resp); err != nil {
+		return nil, fmt.Errorf("ListPipelines: failed to list pipelines, %w", err)
+	}
+
+	return resp, nil
+}
+
+/*
+Updates a Pipeline by its name in the Conveyor API.
+Runs that already started keep the steps they started with.
+*/
+func (c *Client) UpdatePipeline(ctx context.Context, pipeline *types.Pipeline) (*types.Pipeline, error) {
+	var resp types.Pipeline
+	if err := c.doRequest(ctx, http.MethodPut, "/pipelines/"+url.PathEscape(pipeline.Name), pipeline, &resp); err != nil {
+		return nil, fmt.Errorf("UpdatePipeline: failed to update pipeline, %w", err)
+	}
+
+	return &resp, nil
+}
+
+// Deletes a Pipeline by its name in the Conveyor API.
+func (c *Client) DeletePipeline(ctx context.Context, name string) error {
+	if err := c.doRequest(ctx, http.MethodDelete, "/pipelines/"+url.PathEscape(name), nil, nil); err != nil {
+		return fmt.Errorf("DeletePipeline: failed to delete pipeline, %w", err)
+	}
+
+	return nil
+}
@@ -2,8 +2,14 @@ package driverruntime
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"iter"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/open-ug/conveyor/pkg/types"
 )
@@ -87,13 +93,97 @@ func (c *Client) GetResourceDefinition(ctx context.Context, name string) (*types
 Updates a Resource by its name in the Conveyor API.
 This function updates an existing resource with new data.
 It is useful for modifying the properties of a resource that has been previously created.
+
+When the resource carries the ResourceVersion it was read with, the update fails with a conflict if the
+resource was modified since, instead of overwriting the other change. Get the resource again and retry:
+
+	resource, err := client.GetResource(ctx, "app", "deployment")
+	// modify resource.Spec
+	_, err = client.UpdateResource(ctx, resource)
+	if driverruntime.IsConflict(err) {
+		// start over from GetResource
+	}
+
+The drivers of the resource receive an update event, its pipeline is not run. Use UpdateResourceWithOptions to run it.
 */
 func (c *Client) UpdateResource(ctx context.Context, resource *types.Resource) (*types.Resource, error) {
+	updated, _, err := c.UpdateResourceWithOptions(ctx, resource, nil)
+	return updated, err
+}
+
+// UpdateOptions configure how UpdateResourceWithOptions updates a resource.
+type UpdateOptions struct {
+	// Trigger runs the pipeline of the resource for the new version.
+	Trigger bool
+}
+
+/*
+Updates a Resource in the Conveyor API, like UpdateResource, with options. It also returns the ID of the pipeline run
+the update triggered, which is empty unless Trigger is set, e.g.
+
+	resource, runID, err := client.UpdateResourceWithOptions(ctx, resource, &driverruntime.UpdateOptions{Trigger: true})
+*/
+func (c *Client) UpdateResourceWithOptions(ctx context.Context, resource *types.Resource, opts *UpdateOptions) (*types.Resource, string, error) {
 	path := fmt.Sprintf("/resources/%s/%s", resource.Resource, resource.Name)
+	if opts != nil && opts.Trigger {
+		path += "?trigger=true"
+	}
+
+	var resp types.Resource
+	header, err := c.doRequestHeader(ctx, http.MethodPut, path, resource, &resp)
+	if err != nil {
+		return nil, "", fmt.Errorf("UpdateResource: failed to update resource, %w", err)
+	}
+
+	return &resp, header.Get("X-Run-Id"), nil
+}
+
+/*
+Updates the status of a Resource in the Conveyor API. Only the Status of the resource is saved, its spec and version
+are left unchanged, so drivers reporting what they observed don't overwrite changes of users. When the resource carries
+its ResourceVersion, the update fails with a conflict if the resource was modified since it was read, e.g.
+
+	resource.Status.SetCondition(types.Condition{Type: "Ready", Status: types.ConditionTrue, Reason: "Deployed"})
+	resource, err = client.UpdateResourceStatus(ctx, resource)
+*/
+func (c *Client) UpdateResourceStatus(ctx context.Context, resource *types.Resource) (*types.Resource, error) {
+	path := fmt.Sprintf("/resources/%s/%s/status", resource.Resource, resource.Name)
 
 	var resp types.Resource
 	if err := c.doRequest(ctx, http.MethodPut, path, resource, &resp); err != nil {
-		return nil, fmt.Errorf("UpdateResource: failed to update resource, %w", err)
+		return nil, fmt.Errorf("UpdateResourceStatus: failed to update resource status, %w", err)
+	}
+
+	return &resp, nil
+}
+
+/*
+Adds a finalizer to a Resource in the Conveyor API. A deleted resource is kept until all its finalizers are removed,
+giving drivers the chance to clean up what they created for it. Adding a finalizer the resource already has does
+nothing, and adding one to a resource that is being deleted fails with a conflict. Drivers that set Driver.Finalizer
+have it managed for them.
+*/
+func (c *Client) AddFinalizer(ctx context.Context, resourceDefinition string, name string, finalizer string) (*types.Resource, error) {
+	path := fmt.Sprintf("/resources/%s/%s/finalizers/%s", resourceDefinition, name, finalizer)
+
+	var resp types.Resource
+	if err := c.doRequest(ctx, http.MethodPut, path, struct{}{}, &resp); err != nil {
+		return nil, fmt.Errorf("AddFinalizer: failed to add finalizer, %w", err)
+	}
+
+	return &resp, nil
+}
+
+/*
+Removes a finalizer from a Resource in the Conveyor API. When the resource is being deleted and this was its last
+finalizer, the resource is purged along with its versions, and the returned resource is empty.
+*/
+func (c *Client) RemoveFinalizer(ctx context.Context, resourceDefinition string, name string, finalizer string) (*types.Resource, error) {
+	path := fmt.Sprintf("/resources/%s/%s/finalizers/%s", resourceDefinition, name, finalizer)
+
+	var resp types.Resource
+	if err := c.doRequest(ctx, http.MethodDelete, path, nil, &resp); err != nil {
+		return nil, fmt.Errorf("RemoveFinalizer: failed to remove finalizer, %w", err)
 	}
 
 	return &resp, nil
@@ -119,9 +209,34 @@ func (c *Client) UpdateResourceDefinition(ctx context.Context, resourceDefinitio
 Deletes a Resource by its name in the Conveyor API.
 This function deletes an existing resource.
 It is useful for removing a resource that is no longer needed or has been replaced.
+Drivers are sent a delete event, and a resource with finalizers is kept, with its DeletionTimestamp set,
+until its finalizers are removed. The dependents of the resource are deleted in the background.
 */
 func (c *Client) DeleteResource(ctx context.Context, name string, resourceDefinition string) (*types.APIResponse, error) {
+	return c.DeleteResourceWithOptions(ctx, name, resourceDefinition, nil)
+}
+
+// DeleteOptions configure how DeleteResourceWithOptions deletes a resource.
+type DeleteOptions struct {
+	// PropagationPolicy decides when the dependents of the resource, the resources that name it in their
+	// OwnerReferences, are deleted: types.DeletionBackground (the default) deletes the resource right away and
+	// its dependents afterwards, types.DeletionForeground keeps the resource until its dependents are deleted.
+	PropagationPolicy string
+}
+
+/*
+Deletes a Resource by its name in the Conveyor API, like DeleteResource, with options, e.g. to delete a release
+only once the deployments it owns are gone:
+
+	_, err := client.DeleteResourceWithOptions(ctx, "v1", "release", &driverruntime.DeleteOptions{
+		PropagationPolicy: types.DeletionForeground,
+	})
+*/
+func (c *Client) DeleteResourceWithOptions(ctx context.Context, name string, resourceDefinition string, opts *DeleteOptions) (*types.APIResponse, error) {
 	path := fmt.Sprintf("/resources/%s/%s", resourceDefinition, name)
+	if opts != nil && opts.PropagationPolicy != "" {
+		path += "?" + url.Values{"propagation_policy": {opts.PropagationPolicy}}.Encode()
+	}
 
 	var resp types.APIResponse
 	if err := c.doRequest(ctx, http.MethodDelete, path, nil, &resp); err != nil {
@@ -146,3 +261,237 @@ func (c *Client) DeleteResourceDefinition(ctx context.Context, name string) (*ty
 
 	return &resp, nil
 }
+
+// ListOptions select the page of resources ListResources returns.
+type ListOptions struct {
+	// Limit is the maximum number of resources to return. The server returns 100 resources when it is zero.
+	Limit int
+	// Continue is the continue token of the previous page.
+	Continue string
+	// Descending lists the resources in reverse name order.
+	Descending bool
+	// Pipeline selects the resources that reference a pipeline.
+	Pipeline string
+	// Metadata selects the resources whose metadata holds all of its entries.
+	Metadata map[string]string
+	// LabelSelector selects the resources whose labels match it, e.g. `env=prod,team in (a,b),!legacy`.
+	LabelSelector string
+}
+
+/*
+Lists the current resources of a type from the Conveyor API, a page at a time, ordered by name.
+The options select the order and filter the resources.
+Pass the Continue token of the returned list in opts to get the next page, e.g.
+
+	opts := &driverruntime.ListOptions{Limit: 100}
+	for {
+		list, err := client.ListResources(ctx, "deployment", opts)
+		if err != nil {
+			return err
+		}
+		// process list.Items
+		if list.Continue == "" {
+			break
+		}
+		opts.Continue = list.Continue
+	}
+*/
+func (c *Client) ListResources(ctx context.Context, resourceDefinition string, opts *ListOptions) (*types.ResourceList, error) {
+	query := url.Values{}
+	if opts != nil {
+		if opts.Limit > 0 {
+			query.Set("limit", strconv.Itoa(opts.Limit))
+		}
+		if opts.Continue != "" {
+			query.Set("continue", opts.Continue)
+		}
+		if opts.Descending {
+			query.Set("sort", "-name")
+		}
+		if opts.Pipeline != "" {
+			query.Set("pipeline", opts.Pipeline)
+		}
+		if len(opts.Metadata) > 0 {
+			query.Set("metadata", joinPairs(opts.Metadata))
+		}
+		if opts.LabelSelector != "" {
+			query.Set("labels", opts.LabelSelector)
+		}
+	}
+	path := "/resources/" + url.PathEscape(resourceDefinition)
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var resp types.ResourceList
+	if err := c.doRequest(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, fmt.Errorf("ListResources: failed to list resources, %w", err)
+	}
+
+	return &resp, nil
+}
+
+/*
+Gets a version of a Resource from the Conveyor API.
+Every update of a resource creates a new version, starting at 1, so earlier states of a resource can be inspected.
+*/
+func (c *Client) GetResourceVersion(ctx context.Context, name string, resourceDefinition string, version string) (*types.Resource, error) {
+	path := fmt.Sprintf("/resources/%s/%s/%s", resourceDefinition, name, version)
+
+	var resp types.Resource
+	if err := c.doRequest(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, fmt.Errorf("GetResourceVersion: failed to get resource version, %w", err)
+	}
+
+	return &resp, nil
+}
+
+/*
+Lists the versions of a Resource from the Conveyor API, oldest first, with when and by whom each version was written.
+*/
+func (c *Client) ListResourceVersions(ctx context.Context, name string, resourceDefinition string) (*types.ResourceVersionList, error) {
+	path := fmt.Sprintf("/resources/%s/%s/versions", resourceDefinition, name)
+
+	var resp types.ResourceVersionList
+	if err := c.doRequest(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, fmt.Errorf("ListResourceVersions: failed to list resource versions, %w", err)
+	}
+
+	return &resp, nil
+}
+
+/*
+Compares two versions of a Resource in the Conveyor API. The diff lists the fields of the spec and the metadata
+that changed from one version to the other, by their JSON Pointer, e.g. `/spec/image`.
+*/
+func (c *Client) DiffResourceVersions(ctx context.Context, name string, resourceDefinition string, from int, to int) (*types.ResourceDiff, error) {
+	query := url.Values{"from": {strconv.Itoa(from)}, "to": {strconv.Itoa(to)}}
+	path := fmt.Sprintf("/resources/%s/%s/diff?%s", resourceDefinition, name, query.Encode())
+
+	var resp types.ResourceDiff
+	if err := c.doRequest(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, fmt.Errorf("DiffResourceVersions: failed to diff resource versions, %w", err)
+	}
+
+	return &resp, nil
+}
+
+// RollbackOptions configure how RollbackResource rolls a resource back.
+type RollbackOptions struct {
+	// Trigger runs the pipeline of the resource for the new version.
+	Trigger bool
+}
+
+/*
+Rolls a Resource back to one of its versions in the Conveyor API. The rollback creates a new version with the spec,
+labels, annotations and pipeline of the old one, e.g.
+
+	rollback, err := client.RollbackResource(ctx, "app", "deployment", 3, &driverruntime.RollbackOptions{Trigger: true})
+	// rollback.Resource is at a new version, rollback.RunID is the run of its pipeline
+
+The drivers of the resource receive an update event whether or not the pipeline is triggered.
+*/
+func (c *Client) RollbackResource(ctx context.Context, name string, resourceDefinition string, to int, opts *RollbackOptions) (*types.RollbackResponse, error) {
+	query := url.Values{"to": {strconv.Itoa(to)}}
+	if opts != nil && opts.Trigger {
+		query.Set("trigger", "true")
+	}
+	path := fmt.Sprintf("/resources/%s/%s/rollback?%s", resourceDefinition, name, query.Encode())
+
+	var resp types.RollbackResponse
+	if err := c.doRequest(ctx, http.MethodPost, path, nil, &resp); err != nil {
+		return nil, fmt.Errorf("RollbackResource: failed to roll back resource, %w", err)
+	}
+
+	return &resp, nil
+}
+
+// WatchOptions select the changes WatchResources streams.
+type WatchOptions struct {
+	// Name restricts the watch to a single resource.
+	Name string
+	// Revision resumes the watch after a revision, such as the Revision of a ResourceList.
+	// The changes from now on are streamed when it is zero.
+	Revision int64
+	// LabelSelector restricts the watch to the resources whose labels match it. Resources whose labels
+	// change to match it are streamed as added, and those whose labels no longer match it as deleted.
+	LabelSelector string
+}
+
+/*
+Watches the changes of the resources of a type in the Conveyor API.
+The watch reconnects after network errors and API server restarts, resuming after the last change it yielded,
+so no change is missed. It only ends with an error when it cannot resume, e.g. when the revision it would resume
+from was compacted, in which case list the resources again and watch from the revision of the list:
+
+	list, err := client.ListResources(ctx, "deployment", nil)
+	...
+	for event, err := range client.WatchResources(ctx, "deployment", &driverruntime.WatchOptions{Revision: list.Revision}) {
+		if err != nil {
+			return err
+		}
+		fmt.Println(event.Type, event.Resource.Name)
+	}
+
+The watch does not end by itself, stop it by breaking out of the loop or by cancelling ctx.
+*/
+func (c *Client) WatchResources(ctx context.Context, resourceDefinition string, opts *WatchOptions) iter.Seq2[types.WatchEvent, error] {
+	var options WatchOptions
+	if opts != nil {
+		options = *opts
+	}
+	path := "/resources/" + url.PathEscape(resourceDefinition)
+	if options.Name != "" {
+		path += "/" + url.PathEscape(options.Name)
+	}
+	path += "?watch=true"
+	if options.LabelSelector != "" {
+		path += "&labels=" + url.QueryEscape(options.LabelSelector)
+	}
+
+	return func(yield func(types.WatchEvent, error) bool) {
+		retry := c.Options.Retry.withDefaults()
+		revision := options.Revision
+		for attempt := 1; ; attempt++ {
+			stopped := false
+			var watchErr error
+			err := c.stream(ctx, path+"&revision="+strconv.FormatInt(revision, 10), func(data []byte) bool {
+				var event types.WatchEvent
+				if err := json.Unmarshal(data, &event); err != nil {
+					watchErr = fmt.Errorf("invalid watch event, %w", err)
+					return false
+				}
+				if event.Type == types.WatchError {
+					watchErr = errors.New(event.Error)
+					return false
+				}
+				// Reconnects start backing off anew after a change was received
+				attempt = 0
+				revision = event.Revision
+				stopped = !yield(event, nil)
+				return !stopped
+			})
+			if stopped || ctx.Err() != nil {
+				return
+			}
+
+			var apiErr *APIError
+			if watchErr == nil && errors.As(err, &apiErr) && !transientStatus(apiErr.StatusCode) {
+				watchErr = err
+			}
+			if watchErr != nil {
+				yield(types.WatchEvent{}, fmt.Errorf("WatchResources: %w", watchErr))
+				return
+			}
+
+			// The stream ended or failed, reconnect after the last change
+			timer := time.NewTimer(retry.backoff(attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}
+}
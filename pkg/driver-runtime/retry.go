@@ -0,0 +1,166 @@
+package driverruntime
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the API server while the circuit breaker of the client is open.
+var ErrCircuitOpen = errors.New("circuit breaker open, the API server is unavailable")
+
+// RetryOptions configure how the client retries requests that failed with a transient error,
+// such as a network error or a 503 while the API server restarts.
+type RetryOptions struct {
+	// MaxAttempts is the number of attempts of an idempotent request, including the first one.
+	// Defaults to 4, 1 disables retries. Requests that are not idempotent, such as creating a resource, are attempted once.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, it doubles with every retry. Defaults to 250ms.
+	InitialBackoff time.Duration
+	// MaxBackoff bounds the wait between retries. Defaults to 10s.
+	MaxBackoff time.Duration
+}
+
+// withDefaults returns the options with defaults for unset fields.
+func (o RetryOptions) withDefaults() RetryOptions {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = 4
+	}
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = 250 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 10 * time.Second
+	}
+	return o
+}
+
+// backoff returns how long to wait before the given retry, starting at 1. Half of the wait is jittered,
+// so clients that failed together do not retry together.
+func (o RetryOptions) backoff(retry int) time.Duration {
+	wait := o.InitialBackoff << (retry - 1)
+	if wait > o.MaxBackoff || wait <= 0 {
+		wait = o.MaxBackoff
+	}
+	return wait/2 + rand.N(wait/2+1)
+}
+
+/*
+CircuitBreakerOptions configure the circuit breaker of the client. After FailureThreshold consecutive
+transient failures the circuit opens and requests fail with ErrCircuitOpen, without reaching the API
+server, for OpenTimeout. Then a single request is let through, closing the circuit if it succeeds.
+*/
+type CircuitBreakerOptions struct {
+	// FailureThreshold is the number of consecutive failures that open the circuit. Defaults to 5, negative disables the circuit breaker.
+	FailureThreshold int
+	// OpenTimeout is how long the circuit stays open. Defaults to 30s.
+	OpenTimeout time.Duration
+}
+
+// withDefaults returns the options with defaults for unset fields.
+func (o CircuitBreakerOptions) withDefaults() CircuitBreakerOptions {
+	if o.FailureThreshold == 0 {
+		o.FailureThreshold = 5
+	}
+	if o.OpenTimeout <= 0 {
+		o.OpenTimeout = 30 * time.Second
+	}
+	return o
+}
+
+// circuitBreaker stops requests to the API server after consecutive failures.
+type circuitBreaker struct {
+	options CircuitBreakerOptions
+
+	mu       sync.Mutex
+	failures int
+	// openUntil is when the open circuit lets a trial request through
+	openUntil time.Time
+	// probing is set while the trial request of a half-open circuit is in flight
+	probing bool
+}
+
+// allow returns ErrCircuitOpen when the circuit does not let a request through.
+func (b *circuitBreaker) allow() error {
+	if b == nil || b.options.FailureThreshold < 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.options.FailureThreshold {
+		return nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return ErrCircuitOpen
+	}
+	// Half-open, let a single request find out whether the API server is back
+	b.probing = true
+	return nil
+}
+
+// record records the outcome of a request the circuit let through.
+func (b *circuitBreaker) record(failed bool) {
+	if b == nil || b.options.FailureThreshold < 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.options.FailureThreshold {
+		b.openUntil = time.Now().Add(b.options.OpenTimeout)
+	}
+}
+
+// abort records that a request the circuit let through was given up by the caller, which tells nothing about the API server.
+func (b *circuitBreaker) abort() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// idempotent reports whether requests with method can be retried safely.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// transientStatus reports whether a response with status code may succeed when retried.
+func transientStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header, which holds seconds or an HTTP date. It returns 0 when the header is missing or invalid.
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
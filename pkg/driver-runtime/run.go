@@ -0,0 +1,37 @@
+package driverruntime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/open-ug/conveyor/pkg/types"
+)
+
+/*
+Gets the record of a run from the Conveyor API.
+The record holds the state of the run and of every step, with the progress the drivers last reported.
+The run ID is returned when a resource is created or updated.
+*/
+func (c *Client) GetRun(ctx context.Context, runID string) (*types.Run, error) {
+	var resp types.Run
+	if err := c.doRequest(ctx, http.MethodGet, "/runs/"+url.PathEscape(runID), nil, &resp); err != nil {
+		return nil, fmt.Errorf("GetRun: failed to get run, %w", err)
+	}
+
+	return &resp, nil
+}
+
+/*
+Cancels a run in the Conveyor API.
+The drivers reconciling the run have their reconcile context cancelled and report their steps as failed.
+Cancellation is asynchronous, use GetRun to follow the state of the run.
+*/
+func (c *Client) CancelRun(ctx context.Context, runID string) error {
+	if err := c.doRequest(ctx, http.MethodPost, "/runs/"+url.PathEscape(runID)+"/cancel", nil, nil); err != nil {
+		return fmt.Errorf("CancelRun: failed to cancel run, %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package driverruntime
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+/*
+SignalContext returns a copy of parent that is cancelled when the process receives SIGINT or SIGTERM.
+Passing it to DriverManager.Run makes the driver manager shut down gracefully on those signals,
+which is what process supervisors such as systemd and Kubernetes send during rolling deployments.
+Call the returned stop function to release the signal handlers.
+*/
+func SignalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+}
@@ -1,6 +1,8 @@
 package driverruntime
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/ecdsa"
@@ -12,54 +14,177 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"time"
 
+	"github.com/go-resty/resty/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// Performs an HTTP request. If auth is enabled, it signs a JWT and sets Authorization header.
-func (c *Client) doRequest(ctx context.Context, method, path string, body, dest any) error {
-	if (method == http.MethodPost || method == http.MethodPut) && body == nil {
-		return fmt.Errorf("doRequest: body cannot be nil for POST/PUT requests")
-	}
-	if dest == nil {
-		return fmt.Errorf("doRequest: destination cannot be nil")
-	}
+// maxEventSize bounds a single event read from a stream, matching the largest log the server accepts.
+const maxEventSize = 1 << 20
 
+// newRequest creates a request bound to ctx. If auth is enabled, it signs a JWT and sets the Authorization header.
+func (c *Client) newRequest(ctx context.Context) (*resty.Request, error) {
 	req := c.HTTPClient.R().SetContext(ctx)
 
-	if body != nil {
-		jsonMessage, err := json.Marshal(body)
-		if err != nil {
-			return fmt.Errorf("doRequest: failed to marshal request body: %w", err)
-		}
-		req.SetBody(jsonMessage)
-	}
-
 	if c.Options.AuthEnabled {
 		tokenString, err := c.createSignedJWT()
 		if err != nil {
-			return fmt.Errorf("doRequest: failed to create signed jwt: %w", err)
+			return nil, fmt.Errorf("failed to create signed jwt: %w", err)
 		}
 		// fmt.Printf("Generated JWT: %s\n", tokenString) // Optional: for debugging
 		req.SetHeader("Authorization", "Bearer "+tokenString)
 	}
 
+	return req, nil
+}
+
+/*
+Performs an HTTP request and decodes the response into dest, unless dest is nil.
+Idempotent requests that fail with a transient error are retried with exponential backoff, honouring
+the Retry-After header of the server. Every attempt creates a new request, so that with auth enabled
+each attempt signs a fresh JWT that cannot expire while the client waits to retry.
+*/
+func (c *Client) doRequest(ctx context.Context, method, path string, body, dest any) error {
+	_, err := c.doRequestHeader(ctx, method, path, body, dest)
+	return err
+}
+
+// doRequestHeader performs an HTTP request like doRequest, and returns the headers of the response.
+func (c *Client) doRequestHeader(ctx context.Context, method, path string, body, dest any) (http.Header, error) {
+	if method == http.MethodPut && body == nil {
+		return nil, fmt.Errorf("doRequest: body cannot be nil for PUT requests")
+	}
+
+	var jsonMessage []byte
+	if body != nil {
+		var err error
+		jsonMessage, err = json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("doRequest: failed to marshal request body: %w", err)
+		}
+	}
+
+	retry := c.Options.Retry.withDefaults()
+	attempts := 1
+	if idempotent(method) {
+		attempts = retry.MaxAttempts
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.attempt(ctx, method, path, jsonMessage)
+		if err == nil {
+			if dest == nil || len(resp.Body()) == 0 {
+				// e.g. 204 No Content
+				return resp.Header(), nil
+			}
+			if err := json.Unmarshal(resp.Body(), dest); err != nil {
+				return nil, fmt.Errorf("doRequest: failed to unmarshal response body: %w", err)
+			}
+			return resp.Header(), nil
+		}
+
+		var apiErr *APIError
+		transient := !errors.Is(err, ErrCircuitOpen) && ctx.Err() == nil &&
+			(!errors.As(err, &apiErr) || transientStatus(apiErr.StatusCode))
+		if !transient || attempt >= attempts {
+			return nil, fmt.Errorf("doRequest: %w", err)
+		}
+
+		wait := retry.backoff(attempt)
+		if resp != nil {
+			if after := retryAfter(resp.Header()); after > 0 {
+				wait = after
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("doRequest: %w", err)
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends a request once. Responses with an error status are returned along with their APIError.
+func (c *Client) attempt(ctx context.Context, method, path string, body []byte) (*resty.Response, error) {
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	req, err := c.newRequest(ctx)
+	if err != nil {
+		c.breaker.abort()
+		return nil, err
+	}
+	if body != nil {
+		req.SetBody(body)
+	}
+
 	resp, err := req.Execute(method, strings.TrimRight(c.HTTPClient.BaseURL, "/")+path)
 	if err != nil {
-		return fmt.Errorf("doRequest: failed to execute %s request: %w", method, err)
+		if ctx.Err() != nil {
+			c.breaker.abort()
+		} else {
+			c.breaker.record(true)
+		}
+		return nil, fmt.Errorf("failed to execute %s request: %w", method, err)
 	}
+	c.breaker.record(resp.StatusCode() >= http.StatusInternalServerError)
 
 	if resp.IsError() {
-		return fmt.Errorf("doRequest: server returned %d: %s", resp.StatusCode(), string(resp.Body()))
+		return resp, newAPIError(resp.StatusCode(), resp.Body())
 	}
+	return resp, nil
+}
 
-	if err := json.Unmarshal(resp.Body(), dest); err != nil {
-		return fmt.Errorf("doRequest: failed to unmarshal response body: %w", err)
+// stream reads the Server-Sent Events of path and calls handle with the data of every event, until handle returns false or the stream ends.
+func (c *Client) stream(ctx context.Context, path string, handle func(data []byte) bool) error {
+	req, err := c.newRequest(ctx)
+	if err != nil {
+		return err
 	}
 
+	resp, err := req.
+		SetHeader("Accept", "text/event-stream").
+		SetDoNotParseResponse(true).
+		Get(strings.TrimRight(c.HTTPClient.BaseURL, "/") + path)
+	if err != nil {
+		return fmt.Errorf("failed to open stream, %w", err)
+	}
+	body := resp.RawBody()
+	defer body.Close()
+
+	if resp.IsError() {
+		message, _ := io.ReadAll(body)
+		return newAPIError(resp.StatusCode(), message)
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxEventSize)
+	var data [][]byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		switch {
+		case len(line) == 0:
+			// A blank line dispatches the event
+			if len(data) > 0 && !handle(bytes.Join(data, []byte("\n"))) {
+				return nil
+			}
+			data = nil
+		case bytes.HasPrefix(line, []byte("data:")):
+			value := bytes.TrimPrefix(bytes.TrimPrefix(line, []byte("data:")), []byte(" "))
+			data = append(data, bytes.Clone(value))
+		}
+		// Comments, such as heartbeats, and other fields are ignored
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read stream, %w", err)
+	}
 	return nil
 }
 
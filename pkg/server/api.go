@@ -20,6 +20,7 @@ import (
 	"github.com/open-ug/conveyor/internal/metrics"
 	"github.com/open-ug/conveyor/internal/models"
 	"github.com/open-ug/conveyor/internal/routes"
+	"github.com/open-ug/conveyor/internal/storage"
 	"github.com/open-ug/conveyor/internal/utils"
 	"github.com/open-ug/conveyor/pkg/types"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -39,6 +40,10 @@ type APIServerContext struct {
 	LogModel *models.LogModel
 	// BadgerDB instance for direct access to the database if needed. You can use this for advanced queries or operations that are not covered by the LogModel.
 	BadgerDB *badger.DB
+	// Storage is where artifacts uploaded by drivers are stored.
+	Storage storage.Store
+	// Cache is the build cache drivers share across runs. Its entries are kept in Storage.
+	Cache *storage.Cache
 	// Config holds the server configuration. You can access this to read any configuration values that were used to set up the server. This can be useful if you want to make decisions based on the configuration at runtime.
 	Config *types.ServerConfig
 }
@@ -64,6 +69,8 @@ func Setup(config *types.ServerConfig) (APIServerContext, error) {
 		AppName:     "Conveyor API Server",
 		JSONEncoder: json.Marshal,
 		JSONDecoder: json.Unmarshal,
+		// Artifact uploads are streamed to storage instead of being buffered
+		StreamRequestBody: true,
 	})
 
 	app.Use(cors.New())
@@ -114,11 +121,20 @@ func Setup(config *types.ServerConfig) (APIServerContext, error) {
 
 	// Register routes
 	logModel := &models.LogModel{DB: badgerDB}
-	routes.LogRoutes(app, &handlers.LogHandler{Model: logModel}, natsContext)
+	routes.LogRoutes(app, &handlers.LogHandler{Model: logModel, NatsCon: natsContext.NatsCon}, natsContext)
 
 	routes.DriverRoutes(app, etcd.Client, natsContext.NatsCon, badgerDB)
 	routes.ResourceRoutes(app, etcd.Client, natsContext, badgerDB)
 	routes.PipelineRoutes(app, etcd.Client, natsContext, badgerDB)
+	store, err := storage.New(config, natsContext)
+	if err != nil {
+		color.Red("Error Occured while creating artifact storage: %v", err)
+		return APIServerContext{}, err
+	}
+	routes.RunRoutes(app, etcd.Client, natsContext, store)
+	cache := storage.NewCache(store, models.NewCacheModel(badgerDB), config.Storage.Cache)
+	routes.CacheRoutes(app, cache)
+	routes.WebhookRoutes(app, natsContext.NatsCon)
 
 	return APIServerContext{
 		NatsContext: natsContext,
@@ -126,6 +142,8 @@ func Setup(config *types.ServerConfig) (APIServerContext, error) {
 		ETCD:        etcd,
 		LogModel:    logModel,
 		BadgerDB:    badgerDB,
+		Storage:     store,
+		Cache:       cache,
 		Config:      config,
 	}, nil
 }
@@ -0,0 +1,17 @@
+package types
+
+import "time"
+
+// Artifact describes a file a driver uploaded for a run.
+type Artifact struct {
+	// RunID is the run the artifact belongs to.
+	RunID string `json:"runid"`
+	// Path is the slash separated path of the artifact within the run, e.g. `bin/app`.
+	Path string `json:"path"`
+	// Size is the size of the artifact in bytes.
+	Size int64 `json:"size"`
+	// SHA256 is the hex encoded SHA-256 checksum of the artifact.
+	SHA256 string `json:"sha256"`
+	// CreatedAt is the time the artifact was uploaded.
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,19 @@
+package types
+
+import "time"
+
+// CacheEntry describes a file stored in the build cache shared by drivers.
+type CacheEntry struct {
+	// Key is the key the entry is stored under, e.g. `go-mod-<hash of go.sum>`.
+	Key string `json:"key"`
+	// Size is the size of the entry in bytes.
+	Size int64 `json:"size"`
+	// SHA256 is the hex encoded SHA-256 checksum of the entry. Entries with the same content share storage.
+	SHA256 string `json:"sha256"`
+	// CreatedAt is the time the entry was stored.
+	CreatedAt time.Time `json:"created_at"`
+	// LastUsed is the time the entry was last stored or read. Least recently used entries are evicted first.
+	LastUsed time.Time `json:"last_used"`
+	// ExpiresAt is the time after which the entry is no longer served.
+	ExpiresAt time.Time `json:"expires_at"`
+}
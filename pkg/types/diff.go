@@ -0,0 +1,131 @@
+package types
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Operations of field changes
+const (
+	// ChangeAdded is a field that only the newer version has.
+	ChangeAdded = "added"
+	// ChangeRemoved is a field that only the older version has.
+	ChangeRemoved = "removed"
+	// ChangeModified is a field whose value differs between the versions.
+	ChangeModified = "modified"
+)
+
+// FieldChange is a field that differs between two versions of a resource.
+type FieldChange struct {
+	// Path is the JSON Pointer of the field, e.g. `/spec/replicas` or `/metadata/version`.
+	Path string `json:"path"`
+	// Operation is one of ChangeAdded, ChangeRemoved or ChangeModified.
+	Operation string `json:"op"`
+	// From is the value of the field in the older version, unless it was added.
+	From any `json:"from,omitempty"`
+	// To is the value of the field in the newer version, unless it was removed.
+	To any `json:"to,omitempty"`
+}
+
+// ResourceDiff holds the changes of the spec and the metadata of a resource between two of its versions.
+type ResourceDiff struct {
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Changes []FieldChange `json:"changes"`
+}
+
+/*
+DiffResources compares the spec and the metadata of two versions of a resource. Objects are compared field by
+field and arrays item by item, and the changes are ordered by path:
+
+	[{"path": "/spec/image", "op": "modified", "from": "nginx", "to": "caddy"}]
+*/
+func DiffResources(from Resource, to Resource) ([]FieldChange, error) {
+	fromFields, err := diffFields(from)
+	if err != nil {
+		return nil, err
+	}
+	toFields, err := diffFields(to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []FieldChange{}
+	diffValues("", fromFields, toFields, &changes)
+	return changes, nil
+}
+
+// diffFields returns the compared fields of a resource as generic JSON values.
+func diffFields(resource Resource) (any, error) {
+	data, err := json.Marshal(map[string]any{"spec": resource.Spec, "metadata": resource.Metadata})
+	if err != nil {
+		return nil, err
+	}
+	var fields any
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// diffValues appends the changes between two JSON values at a path to changes.
+func diffValues(path string, from any, to any, changes *[]FieldChange) {
+	switch f := from.(type) {
+	case map[string]any:
+		if t, ok := to.(map[string]any); ok {
+			keys := make([]string, 0, len(f)+len(t))
+			for key := range f {
+				keys = append(keys, key)
+			}
+			for key := range t {
+				if _, ok := f[key]; !ok {
+					keys = append(keys, key)
+				}
+			}
+			slices.Sort(keys)
+
+			for _, key := range keys {
+				fromValue, inFrom := f[key]
+				toValue, inTo := t[key]
+				diffField(path+"/"+escapePointer(key), fromValue, inFrom, toValue, inTo, changes)
+			}
+			return
+		}
+	case []any:
+		if t, ok := to.([]any); ok {
+			for i := range max(len(f), len(t)) {
+				var fromValue, toValue any
+				if i < len(f) {
+					fromValue = f[i]
+				}
+				if i < len(t) {
+					toValue = t[i]
+				}
+				diffField(path+"/"+strconv.Itoa(i), fromValue, i < len(f), toValue, i < len(t), changes)
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, FieldChange{Path: path, Operation: ChangeModified, From: from, To: to})
+	}
+}
+
+// diffField appends the change of a field that may be missing from either version to changes.
+func diffField(path string, from any, inFrom bool, to any, inTo bool, changes *[]FieldChange) {
+	switch {
+	case !inFrom:
+		*changes = append(*changes, FieldChange{Path: path, Operation: ChangeAdded, To: to})
+	case !inTo:
+		*changes = append(*changes, FieldChange{Path: path, Operation: ChangeRemoved, From: from})
+	default:
+		diffValues(path, from, to, changes)
+	}
+}
+
+// escapePointer escapes a key as a JSON Pointer reference token.
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffResources(t *testing.T) {
+	from := Resource{
+		Metadata: map[string]string{"version": "3"},
+		Spec: map[string]interface{}{
+			"image":    "nginx",
+			"replicas": 2,
+			"ports":    []interface{}{80, 443},
+			"env":      map[string]interface{}{"LOG_LEVEL": "info", "a/b": "x"},
+		},
+	}
+	to := Resource{
+		Metadata: map[string]string{"version": "5"},
+		Spec: map[string]interface{}{
+			"image":   "caddy",
+			"ports":   []interface{}{8080},
+			"env":     map[string]interface{}{"LOG_LEVEL": "info", "a/b": "y"},
+			"enabled": false,
+		},
+	}
+
+	changes, err := DiffResources(from, to)
+	require.NoError(t, err)
+	assert.Equal(t, []FieldChange{
+		{Path: "/metadata/version", Operation: ChangeModified, From: "3", To: "5"},
+		{Path: "/spec/enabled", Operation: ChangeAdded, To: false},
+		{Path: "/spec/env/a~1b", Operation: ChangeModified, From: "x", To: "y"},
+		{Path: "/spec/image", Operation: ChangeModified, From: "nginx", To: "caddy"},
+		{Path: "/spec/ports/0", Operation: ChangeModified, From: float64(80), To: float64(8080)},
+		{Path: "/spec/ports/1", Operation: ChangeRemoved, From: float64(443)},
+		{Path: "/spec/replicas", Operation: ChangeRemoved, From: float64(2)},
+	}, changes)
+
+	changes, err = DiffResources(from, from)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
@@ -0,0 +1,72 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
+)
+
+const (
+	// DriverRegistrationTTL is how long an entry of the driver registry stays valid without being renewed.
+	// Instances that stopped without deregistering, e.g. because they crashed, drop out once it passes.
+	DriverRegistrationTTL = 30 * time.Second
+	// DriverHeartbeatInterval is how often running instances renew their entry in the driver registry.
+	DriverHeartbeatInterval = 10 * time.Second
+)
+
+// DriverInstance describes a running driver manager as advertised in the driver registry.
+type DriverInstance struct {
+	// ID uniquely identifies the driver manager instance.
+	ID string `json:"id"`
+	// Driver is the name of the driver the instance runs.
+	Driver string `json:"driver"`
+	// Resources are the resource types the instance listens to.
+	Resources []string `json:"resources"`
+	// Events are the event patterns the instance reconciles.
+	Events []string `json:"events"`
+	// Labels describe the host the instance runs on, e.g. `arch=arm64`. Steps select instances by their labels.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Pool identifies the instances of the driver with the same labels, which share the work routed to them.
+	// It is empty for instances without labels.
+	Pool string `json:"pool,omitempty"`
+	// ResyncInterval is how often the instance wants every resource it listens to delivered again
+	// in a resync event. Zero disables resyncs.
+	ResyncInterval time.Duration `json:"resync_interval,omitempty"`
+	// StartedAt is the time the instance registered itself.
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Matches reports whether the labels of the instance satisfy every label of the selector.
+func (i DriverInstance) Matches(selector map[string]string) bool {
+	for key, value := range selector {
+		if label, ok := i.Labels[key]; !ok || label != value {
+			return false
+		}
+	}
+	return true
+}
+
+// DriverPool returns the pool of the driver instances with the given labels. Instances without labels have no pool.
+func DriverPool(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		hash.Write([]byte(key + "=" + labels[key] + "\n"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// DriverPoolSubject returns the subject steps routed to a pool of driver instances are published on.
+func DriverPoolSubject(driver string, pool string, resource string) string {
+	return "drivers." + driver + ".pools." + pool + ".resources." + resource
+}
@@ -0,0 +1,272 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// maxLabelNameLength bounds the name of label and annotation keys, and label values.
+	maxLabelNameLength = 63
+	// maxLabelPrefixLength bounds the optional DNS subdomain prefix of label and annotation keys.
+	maxLabelPrefixLength = 253
+	// maxAnnotationsSize bounds the total size of the keys and values of the annotations of a resource.
+	maxAnnotationsSize = 256 * 1024
+)
+
+var (
+	labelNamePattern   = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+	labelPrefixPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// validateLabelKey checks a label or annotation key, a name with an optional DNS subdomain prefix, e.g. `example.com/team`.
+func validateLabelKey(key string) error {
+	name := key
+	if prefix, rest, ok := strings.Cut(key, "/"); ok {
+		if len(prefix) > maxLabelPrefixLength || !labelPrefixPattern.MatchString(prefix) {
+			return fmt.Errorf("invalid key %q, the prefix must be a lowercase DNS subdomain of at most %d characters", key, maxLabelPrefixLength)
+		}
+		name = rest
+	}
+	if len(name) > maxLabelNameLength || !labelNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid key %q, the name must be at most %d alphanumeric characters, '-', '_' or '.', starting and ending with an alphanumeric character", key, maxLabelNameLength)
+	}
+	return nil
+}
+
+// validateLabelValue checks a label value, which may be empty.
+func validateLabelValue(value string) error {
+	if value == "" {
+		return nil
+	}
+	if len(value) > maxLabelNameLength || !labelNamePattern.MatchString(value) {
+		return fmt.Errorf("invalid value %q, it must be at most %d alphanumeric characters, '-', '_' or '.', starting and ending with an alphanumeric character", value, maxLabelNameLength)
+	}
+	return nil
+}
+
+// ValidateLabels checks the keys and values of the labels of a resource.
+func ValidateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if err := validateLabelKey(key); err != nil {
+			return fmt.Errorf("label %w", err)
+		}
+		if err := validateLabelValue(value); err != nil {
+			return fmt.Errorf("label %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// ValidateAnnotations checks the keys of the annotations of a resource and their total size. Values are arbitrary strings.
+func ValidateAnnotations(annotations map[string]string) error {
+	size := 0
+	for key, value := range annotations {
+		if err := validateLabelKey(key); err != nil {
+			return fmt.Errorf("annotation %w", err)
+		}
+		size += len(key) + len(value)
+	}
+	if size > maxAnnotationsSize {
+		return fmt.Errorf("annotations are %d bytes, at most %d bytes are allowed", size, maxAnnotationsSize)
+	}
+	return nil
+}
+
+// ValidateFinalizers checks the names of finalizers, which follow the rules of label keys, e.g. `example.com/cleanup`.
+func ValidateFinalizers(finalizers []string) error {
+	for _, finalizer := range finalizers {
+		if err := validateLabelKey(finalizer); err != nil {
+			return fmt.Errorf("finalizer %w", err)
+		}
+	}
+	return nil
+}
+
+// Operators of label selector requirements
+const (
+	// SelectorIn requires the label to have one of the values, written `key=value`, `key==value` or `key in (a,b)`.
+	SelectorIn = "in"
+	// SelectorNotIn requires the label to be missing or to have none of the values, written `key!=value` or `key notin (a,b)`.
+	SelectorNotIn = "notin"
+	// SelectorExists requires the label to be set, written `key`.
+	SelectorExists = "exists"
+	// SelectorDoesNotExist requires the label to be missing, written `!key`.
+	SelectorDoesNotExist = "!"
+)
+
+// LabelRequirement is a single requirement of a label selector.
+type LabelRequirement struct {
+	Key string
+	// Operator is one of SelectorIn, SelectorNotIn, SelectorExists or SelectorDoesNotExist.
+	Operator string
+	// Values are the values of SelectorIn and SelectorNotIn requirements.
+	Values []string
+}
+
+// Matches reports whether labels satisfy the requirement.
+func (r LabelRequirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case SelectorIn:
+		return ok && slices.Contains(r.Values, value)
+	case SelectorNotIn:
+		return !ok || !slices.Contains(r.Values, value)
+	case SelectorExists:
+		return ok
+	case SelectorDoesNotExist:
+		return !ok
+	}
+	return false
+}
+
+// String formats the requirement in selector syntax.
+func (r LabelRequirement) String() string {
+	switch r.Operator {
+	case SelectorIn:
+		if len(r.Values) == 1 {
+			return r.Key + "=" + r.Values[0]
+		}
+		return r.Key + " in (" + strings.Join(r.Values, ",") + ")"
+	case SelectorNotIn:
+		if len(r.Values) == 1 {
+			return r.Key + "!=" + r.Values[0]
+		}
+		return r.Key + " notin (" + strings.Join(r.Values, ",") + ")"
+	case SelectorDoesNotExist:
+		return "!" + r.Key
+	}
+	return r.Key
+}
+
+/*
+LabelSelector selects resources by their labels. A resource is selected when its labels satisfy every
+requirement, so the empty selector selects every resource. Selectors are written as a comma separated
+list of requirements:
+
+	env=prod,team in (payments,billing),!legacy
+*/
+type LabelSelector []LabelRequirement
+
+// Matches reports whether labels satisfy every requirement of the selector.
+func (s LabelSelector) Matches(labels map[string]string) bool {
+	for _, requirement := range s {
+		if !requirement.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the selector in selector syntax.
+func (s LabelSelector) String() string {
+	requirements := make([]string, len(s))
+	for i, requirement := range s {
+		requirements[i] = requirement.String()
+	}
+	return strings.Join(requirements, ",")
+}
+
+/*
+ParseLabelSelector parses a label selector. Each comma separated requirement is one of:
+
+	key            the label is set
+	!key           the label is not set
+	key=value      the label has the value, also written key==value
+	key!=value     the label is not set or has another value
+	key in (a,b)   the label has one of the values
+	key notin (a,b) the label is not set or has none of the values
+*/
+func ParseLabelSelector(selector string) (LabelSelector, error) {
+	parts, err := splitRequirements(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed LabelSelector
+	for _, part := range parts {
+		requirement, err := parseRequirement(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector requirement %q: %w", part, err)
+		}
+		parsed = append(parsed, requirement)
+	}
+	return parsed, nil
+}
+
+// splitRequirements splits a selector at the commas that are not within the parentheses of a set of values.
+func splitRequirements(selector string) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range selector {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, selector[start:i])
+				start = i + 1
+			}
+		}
+		if depth < 0 || depth > 1 {
+			return nil, fmt.Errorf("invalid label selector %q, unbalanced parentheses", selector)
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("invalid label selector %q, unbalanced parentheses", selector)
+	}
+	parts = append(parts, selector[start:])
+
+	if len(parts) == 1 && strings.TrimSpace(parts[0]) == "" {
+		return nil, nil
+	}
+	return parts, nil
+}
+
+// parseRequirement parses a single requirement of a selector.
+func parseRequirement(part string) (LabelRequirement, error) {
+	part = strings.TrimSpace(part)
+	requirement := LabelRequirement{}
+
+	switch {
+	case strings.HasPrefix(part, "!") && !strings.ContainsAny(part, "=("):
+		requirement.Key, requirement.Operator = strings.TrimSpace(part[1:]), SelectorDoesNotExist
+
+	case strings.Contains(part, "!="):
+		key, value, _ := strings.Cut(part, "!=")
+		requirement.Key, requirement.Operator, requirement.Values = strings.TrimSpace(key), SelectorNotIn, []string{strings.TrimSpace(value)}
+
+	case strings.Contains(part, "="):
+		key, value, _ := strings.Cut(part, "=")
+		value = strings.TrimPrefix(value, "=")
+		requirement.Key, requirement.Operator, requirement.Values = strings.TrimSpace(key), SelectorIn, []string{strings.TrimSpace(value)}
+
+	case strings.Contains(part, "("):
+		fields := strings.Fields(part[:strings.Index(part, "(")])
+		if len(fields) != 2 || (fields[1] != SelectorIn && fields[1] != SelectorNotIn) || !strings.HasSuffix(part, ")") {
+			return LabelRequirement{}, fmt.Errorf("expected `key in (values)` or `key notin (values)`")
+		}
+		requirement.Key, requirement.Operator = fields[0], fields[1]
+		values := part[strings.Index(part, "(")+1 : len(part)-1]
+		for _, value := range strings.Split(values, ",") {
+			requirement.Values = append(requirement.Values, strings.TrimSpace(value))
+		}
+
+	default:
+		requirement.Key, requirement.Operator = part, SelectorExists
+	}
+
+	if err := validateLabelKey(requirement.Key); err != nil {
+		return LabelRequirement{}, err
+	}
+	for _, value := range requirement.Values {
+		if err := validateLabelValue(value); err != nil {
+			return LabelRequirement{}, err
+		}
+	}
+	return requirement, nil
+}
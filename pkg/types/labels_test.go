@@ -0,0 +1,61 @@
+package types_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/open-ug/conveyor/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	labels := map[string]string{"env": "prod", "team": "payments", "example.com/tier": "backend"}
+
+	for selector, matches := range map[string]bool{
+		"":                                     true,
+		"env=prod":                             true,
+		"env==prod":                            true,
+		"env!=prod":                            false,
+		"env=prod,team in (payments, billing)": true,
+		"team notin (payments,billing)":        false,
+		"region notin (eu)":                    true,
+		"region!=eu":                           true,
+		"!legacy":                              true,
+		"!env":                                 false,
+		"example.com/tier":                     true,
+		" env = prod , !legacy ":               true,
+	} {
+		parsed, err := types.ParseLabelSelector(selector)
+		require.NoError(t, err, selector)
+		assert.Equal(t, matches, parsed.Matches(labels), selector)
+	}
+
+	parsed, err := types.ParseLabelSelector("env=prod,team in (a,b),!legacy,region!=eu,tier")
+	require.NoError(t, err)
+	assert.Equal(t, "env=prod,team in (a,b),!legacy,region!=eu,tier", parsed.String())
+
+	for _, selector := range []string{"env in (prod", "env in prod)", "env (prod)", "bad key=x", "env=a b", "env=prod,,team"} {
+		_, err := types.ParseLabelSelector(selector)
+		assert.Error(t, err, selector)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	assert.NoError(t, types.ValidateLabels(map[string]string{"env": "prod", "example.com/team": "", "app.kubernetes.io/name": "api-1.2_3"}))
+
+	for _, labels := range []map[string]string{
+		{"": "x"},
+		{"-env": "prod"},
+		{"Example.com/team": "x"},
+		{"env": "has space"},
+		{strings.Repeat("a", 64): "x"},
+		{"env": strings.Repeat("a", 64)},
+	} {
+		assert.Error(t, types.ValidateLabels(labels), labels)
+	}
+
+	assert.NoError(t, types.ValidateAnnotations(map[string]string{"description": "Any text, even with spaces: ok"}))
+	assert.Error(t, types.ValidateAnnotations(map[string]string{"bad key": "x"}))
+	assert.Error(t, types.ValidateAnnotations(map[string]string{"big": strings.Repeat("a", 256*1024)}))
+}
@@ -1,5 +1,21 @@
 package types
 
+import (
+	"strconv"
+	"time"
+)
+
+// Log levels, from least to most severe. Logs without a level are treated as LogLevelInfo.
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// LogTimestampFormat is the format of Log timestamps. It has a fixed width, so timestamps sort in time order.
+const LogTimestampFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
 type Log struct {
 	// RunID is a unique identifier for the workflow run. This allows you to group logs by specific runs of your pipelines.
 	RunID string `json:"runid"`
@@ -7,8 +23,28 @@ type Log struct {
 	Driver string `json:"driver"`
 	// Pipeline is the name of the pipeline associated with the log. This allows you to trace logs back to specific pipelines.
 	Pipeline string `json:"pipeline"`
-	// Timestamp is the time when the log was created. This is useful for ordering logs and understanding the sequence of events.
+	// Step is the ID of the pipeline step the log was written in.
+	Step string `json:"step,omitempty"`
+	// Level is the severity of the log, one of `debug`, `info`, `warn` or `error`.
+	Level string `json:"level,omitempty"`
+	// Labels are additional key-value pairs the driver attached to the log, such as `event` or `stage`.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Timestamp is the time when the log was created, in LogTimestampFormat. This is useful for ordering logs and understanding the sequence of events.
+	// Logs written by older drivers hold Unix seconds instead.
 	Timestamp string `json:"timestamp"`
 	// Message is the actual log message. This contains the information or error details that you want to record.
 	Message string `json:"message"`
 }
+
+// FormatLogTimestamp formats t as a Log timestamp.
+func FormatLogTimestamp(t time.Time) string {
+	return t.UTC().Format(LogTimestampFormat)
+}
+
+// Time parses the timestamp of the log, accepting the Unix seconds written by older drivers.
+func (l Log) Time() (time.Time, error) {
+	if seconds, err := strconv.ParseInt(l.Timestamp, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339Nano, l.Timestamp)
+}
@@ -1,5 +1,20 @@
 package types
 
+// Events delivered to drivers in a DriverMessage
+const (
+	// EventCreate is delivered when a resource is created.
+	EventCreate = "create"
+	// EventUpdate is delivered when a resource is updated.
+	EventUpdate = "update"
+	// EventDelete is delivered when a resource is deleted.
+	EventDelete = "delete"
+	// EventProcess is delivered to the drivers of the pipeline steps that follow the first one.
+	EventProcess = "process"
+	// EventResync is delivered periodically for every resource to drivers with a resync interval,
+	// so they can detect and correct drift.
+	EventResync = "resync"
+)
+
 type DriverMessage struct {
 	// Event Name e.g. `create`
 	Event string `json:"event" bson:"event"`
@@ -7,6 +22,11 @@ type DriverMessage struct {
 	Payload string `json:"payload" bson:"payload"`
 	ID      string `json:"id" bson:"id"`
 	RunID   string `json:"run_id" bson:"run_id"`
+	// Step is the ID of the pipeline step the message starts, empty for messages outside a pipeline
+	Step string `json:"step,omitempty" bson:"step,omitempty"`
+	// Trigger is the event that started the pipeline run, e.g. `delete` for the `process` events of the
+	// later steps. It is empty when it is the same as Event.
+	Trigger string `json:"trigger,omitempty" bson:"trigger,omitempty"`
 }
 
 type APIResponse struct {
@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 type Pipeline struct {
 	Name        string            `json:"name"`
 	Description string            `json:"description"`
@@ -7,16 +9,29 @@ type Pipeline struct {
 	Resource    string            `json:"resource"`
 	Steps       []Step            `json:"steps"`
 	Metadata    map[string]string `json:"metadata"`
+	// ResourceSelector is a label selector, e.g. `env=prod`. Resources created without a pipeline run the
+	// pipeline when their labels match it. Pipelines without a selector only run for resources that name them.
+	ResourceSelector string `json:"resource_selector,omitempty"`
 }
 
 type Step struct {
 	ID     string `json:"id"`
 	Name   string `json:"name"`
 	Driver string `json:"driver"`
+	// Selector restricts the step to driver instances whose labels contain all of its labels,
+	// e.g. `arch: arm64`. Any instance of the driver may run a step without a selector.
+	Selector map[string]string `json:"selector,omitempty"`
 }
 
 type DriverResult struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
+	// RequeueAfter asks for the event to be reconciled again after the given duration instead of
+	// ending the step, e.g. while waiting for a deployment to roll out. Success is ignored.
+	RequeueAfter time.Duration `json:"requeue_after,omitempty"`
+	// Retryable marks a failure as transient, such as a registry that is briefly unreachable.
+	// Retryable failures are reconciled again with an exponential backoff until the driver
+	// manager runs out of retries. Failures are terminal by default.
+	Retryable bool `json:"retryable,omitempty"`
 }
@@ -1,5 +1,10 @@
 package types
 
+import (
+	"fmt"
+	"time"
+)
+
 type ResourceDefinition struct {
 	ID          string      `json:"id"`
 	Name        string      `json:"name"`
@@ -9,10 +14,219 @@ type ResourceDefinition struct {
 }
 
 type Resource struct {
-	ID       string            `json:"id"`
-	Name     string            `json:"name"`
-	Pipeline string            `json:"pipeline,omitempty"`
-	Resource string            `json:"resource"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Pipeline string `json:"pipeline,omitempty"`
+	Resource string `json:"resource"`
+	// Labels identify and group resources, e.g. by project and environment. Label selectors select resources by their labels.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations hold arbitrary information about the resource, such as the tool that created it. They cannot be selected.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// ResourceVersion identifies the state of the resource, it changes whenever the resource is modified.
+	// Updates that carry it only succeed if the resource was not modified since, and fail with 409 Conflict otherwise.
+	ResourceVersion string `json:"resource_version,omitempty"`
+	// Finalizers keep a deleted resource until each of them is removed, e.g. by the driver that cleans up
+	// what it provisioned for the resource. Finalizers are set when the resource is created, and added and
+	// removed through the finalizers subresource.
+	Finalizers []string `json:"finalizers,omitempty"`
+	// DeletionTimestamp is when the resource was deleted. It is set while the resource waits for its finalizers,
+	// and the resource is purged once they are all removed.
+	DeletionTimestamp *time.Time `json:"deletion_timestamp,omitempty"`
+	// OwnerReferences name the resources this resource depends on, e.g. the `release` a driver created a
+	// `deployment` for. Once all its owners are deleted, the resource is deleted by the garbage collector.
+	OwnerReferences []OwnerReference `json:"owner_references,omitempty"`
+	// Metadata is managed by the server, it holds the version of the resource.
 	Metadata map[string]string `json:"metadata"`
 	Spec     interface{}       `json:"spec"`
+	// Status is the observed state of the resource, written by drivers and the server. It is only updated through
+	// the status subresource, updates of the resource leave it unchanged.
+	Status ResourceStatus `json:"status,omitzero"`
+}
+
+// OwnerReference identifies the owner of a resource.
+type OwnerReference struct {
+	// Resource is the type of the owner.
+	Resource string `json:"resource"`
+	// Name is the name of the owner.
+	Name string `json:"name"`
+	// ID is the ID of the owner. When set, an owner that is deleted and created again with the same name
+	// does not own the resource anymore.
+	ID string `json:"id,omitempty"`
+}
+
+// Owns reports whether the reference refers to a resource.
+func (o OwnerReference) Owns(resource Resource) bool {
+	return o.Resource == resource.Resource && o.Name == resource.Name && (o.ID == "" || o.ID == resource.ID)
+}
+
+// ValidateOwnerReferences checks that the owners of a resource are named, and that it does not own itself.
+func ValidateOwnerReferences(resource Resource) error {
+	for _, owner := range resource.OwnerReferences {
+		if owner.Resource == "" || owner.Name == "" {
+			return fmt.Errorf("owner references require a resource and a name")
+		}
+		if owner.Resource == resource.Resource && owner.Name == resource.Name {
+			return fmt.Errorf("resource %s cannot own itself", resource.Name)
+		}
+	}
+	return nil
+}
+
+// Deletion propagation policies, which decide when the dependents of a deleted resource are deleted
+const (
+	// DeletionBackground deletes the resource right away, and its dependents afterwards.
+	DeletionBackground = "background"
+	// DeletionForeground keeps the resource until its dependents are deleted, with the FinalizerForegroundDeletion finalizer.
+	DeletionForeground = "foreground"
+)
+
+// FinalizerForegroundDeletion keeps a resource deleted with the foreground policy until the garbage collector deleted its dependents.
+const FinalizerForegroundDeletion = "conveyor.io/foreground-deletion"
+
+// Condition statuses
+const (
+	ConditionTrue    = "True"
+	ConditionFalse   = "False"
+	ConditionUnknown = "Unknown"
+)
+
+// Condition is an aspect of the observed state of a resource, e.g. whether it is `Ready`.
+type Condition struct {
+	// Type names the aspect, e.g. `Ready` or `ImageBuilt`. A status holds a single condition of each type.
+	Type string `json:"type"`
+	// Status is one of `True`, `False` or `Unknown`.
+	Status string `json:"status"`
+	// Reason is a short CamelCase explanation of the status, e.g. `RegistryUnreachable`.
+	Reason string `json:"reason,omitempty"`
+	// Message explains the status to humans.
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is when the status of the condition last changed. The server sets it when it is unset.
+	LastTransitionTime time.Time `json:"last_transition_time"`
+}
+
+// ResourceStatus is the observed state of a resource.
+type ResourceStatus struct {
+	// ObservedGeneration is the version of the resource, its `version` metadata, the status was observed at.
+	// The status is stale while it is lower than the version of the resource.
+	ObservedGeneration int64 `json:"observed_generation,omitempty"`
+	// Conditions are the aspects of the observed state of the resource.
+	Conditions []Condition `json:"conditions,omitempty"`
+	// DriverResults are the last results of the drivers that reconciled the resource in a pipeline, by driver name.
+	DriverResults map[string]DriverResult `json:"driver_results,omitempty"`
+}
+
+// FindCondition returns the condition of a type, or nil when the status has none.
+func (s *ResourceStatus) FindCondition(conditionType string) *Condition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds a condition or replaces the condition of its type. The last transition time is kept
+// when the status of the condition does not change. When it changes, or the condition is new, it is set to
+// now unless the condition has a later one.
+func (s *ResourceStatus) SetCondition(condition Condition) {
+	current := s.FindCondition(condition.Type)
+	if current == nil {
+		if condition.LastTransitionTime.IsZero() {
+			condition.LastTransitionTime = time.Now().UTC()
+		}
+		s.Conditions = append(s.Conditions, condition)
+		return
+	}
+	switch {
+	case current.Status == condition.Status:
+		condition.LastTransitionTime = current.LastTransitionTime
+	case !condition.LastTransitionTime.After(current.LastTransitionTime):
+		condition.LastTransitionTime = time.Now().UTC()
+	}
+	*current = condition
+}
+
+// ValidateStatus checks the conditions of a status.
+func ValidateStatus(status ResourceStatus) error {
+	seen := map[string]bool{}
+	for _, condition := range status.Conditions {
+		if condition.Type == "" {
+			return fmt.Errorf("condition type is required")
+		}
+		if seen[condition.Type] {
+			return fmt.Errorf("duplicate condition %s", condition.Type)
+		}
+		seen[condition.Type] = true
+		switch condition.Status {
+		case ConditionTrue, ConditionFalse, ConditionUnknown:
+		default:
+			return fmt.Errorf("condition %s has status %q, expected True, False or Unknown", condition.Type, condition.Status)
+		}
+	}
+	return nil
+}
+
+// Metadata of resources managed by the server, besides their `version`
+const (
+	// MetadataUpdatedAt is when the version of the resource was written, in RFC 3339 format.
+	MetadataUpdatedAt = "updated_at"
+	// MetadataUpdatedBy is who wrote the version of the resource, the common name of their client certificate.
+	MetadataUpdatedBy = "updated_by"
+)
+
+// ResourceVersionInfo describes a version of a resource.
+type ResourceVersionInfo struct {
+	Version int `json:"version"`
+	// UpdatedAt is when the version was written. It is unset for versions written before it was recorded.
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+	// UpdatedBy is who wrote the version, when the request was authenticated.
+	UpdatedBy string `json:"updated_by,omitempty"`
+}
+
+// ResourceVersionList lists the versions of a resource.
+type ResourceVersionList struct {
+	// Items are the versions of the resource, oldest first.
+	Items []ResourceVersionInfo `json:"items"`
+}
+
+// RollbackResponse is the result of rolling a resource back to one of its versions.
+type RollbackResponse struct {
+	// Resource is the resource at its new version.
+	Resource Resource `json:"resource"`
+	// RunID is the run of the pipeline triggered by the rollback, if any.
+	RunID string `json:"runid,omitempty"`
+}
+
+// ResourceList is a page of the resources of a type.
+type ResourceList struct {
+	// Items are the resources of the page, ordered by name.
+	Items []Resource `json:"items"`
+	// Continue is passed as the `continue` query parameter to get the next page, it is empty on the last page.
+	Continue string `json:"continue,omitempty"`
+	// Revision is the revision the page was read at. Watching from it delivers every change made after the page was read.
+	Revision int64 `json:"revision,omitempty"`
+}
+
+// Types of watch events
+const (
+	// WatchAdded is the type of events of created resources.
+	WatchAdded = "ADDED"
+	// WatchModified is the type of events of updated resources.
+	WatchModified = "MODIFIED"
+	// WatchDeleted is the type of events of deleted resources.
+	WatchDeleted = "DELETED"
+	// WatchError is the type of the event ending a watch that cannot go on, e.g. because its revision was compacted.
+	WatchError = "ERROR"
+)
+
+// WatchEvent is a change of a resource streamed by a watch.
+type WatchEvent struct {
+	// Type is the kind of change, one of `ADDED`, `MODIFIED`, `DELETED` or `ERROR`.
+	Type string `json:"type"`
+	// Resource is the resource after the change, or its last state when it was deleted.
+	Resource Resource `json:"resource"`
+	// Revision is the revision of the change. Watching from it resumes the watch after this event.
+	Revision int64 `json:"revision"`
+	// Error explains why the watch ended, for `ERROR` events.
+	Error string `json:"error,omitempty"`
 }
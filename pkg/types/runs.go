@@ -0,0 +1,103 @@
+package types
+
+import "time"
+
+// States of a run and of its steps
+const (
+	// RunPending is the state of a run or step that has not started yet.
+	RunPending = "pending"
+	// RunRunning is the state of a run or step that is being reconciled.
+	RunRunning = "running"
+	// RunSucceeded is the state of a run or step that completed successfully.
+	RunSucceeded = "succeeded"
+	// RunFailed is the state of a run or step that failed.
+	RunFailed = "failed"
+)
+
+// Run is the record of a single run triggered by a resource event.
+type Run struct {
+	// ID is the run ID returned when the resource event was published.
+	ID string `json:"id"`
+	// Pipeline is the name of the pipeline the run executes, empty when the event went to all drivers of the resource.
+	Pipeline string `json:"pipeline"`
+	// Resource is the type of the resource that triggered the run.
+	Resource string `json:"resource"`
+	// ResourceName is the name of the resource that triggered the run.
+	ResourceName string `json:"resource_name"`
+	// Event is the resource event that triggered the run.
+	Event string `json:"event"`
+	// Status is the state of the run as a whole.
+	Status string `json:"status"`
+	// Steps holds the state of every driver taking part in the run.
+	Steps []StepState `json:"steps"`
+	// CreatedAt is the time the run record was created.
+	CreatedAt time.Time `json:"created_at"`
+	// UpdatedAt is the time the run record last changed.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// StepState is the state of a driver within a run.
+type StepState struct {
+	// Driver is the name of the driver reconciling the step.
+	Driver string `json:"driver"`
+	// Status is the state of the step.
+	Status string `json:"status"`
+	// Phase is the last phase the driver reported, e.g. `deploying`.
+	Phase string `json:"phase"`
+	// Percent is the last completion percentage the driver reported, between 0 and 100.
+	Percent int `json:"percent"`
+	// Message is the last progress message or the message of the driver result.
+	Message string `json:"message"`
+	// Attempts is the number of times the driver reconciled the step, counting requeues and retries.
+	Attempts int `json:"attempts,omitempty"`
+	// RequeuedUntil is set while the step waits to be reconciled again after a requeue or a retryable failure.
+	RequeuedUntil *time.Time `json:"requeued_until,omitempty"`
+	// UpdatedAt is the time the step state last changed.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Progress is an intermediate progress report published by a driver while it reconciles.
+type Progress struct {
+	// RunID is the run the driver is reconciling.
+	RunID string `json:"runid"`
+	// Driver is the name of the driver reporting progress.
+	Driver string `json:"driver"`
+	// Phase is the phase the driver is in, e.g. `building` or `deploying`.
+	Phase string `json:"phase"`
+	// Percent is the completion percentage of the step, between 0 and 100.
+	Percent int `json:"percent"`
+	// Message describes what the driver is doing.
+	Message string `json:"message"`
+	// Timestamp is the time the progress was reported.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Step returns the state of the given driver in the run, adding a pending step when the driver has none yet.
+func (r *Run) Step(driver string) *StepState {
+	for i := range r.Steps {
+		if r.Steps[i].Driver == driver {
+			return &r.Steps[i]
+		}
+	}
+	r.Steps = append(r.Steps, StepState{Driver: driver, Status: RunPending})
+	return &r.Steps[len(r.Steps)-1]
+}
+
+// UpdateStatus derives the status of the run from the state of its steps.
+// A run fails as soon as a step fails and succeeds once all its steps succeeded.
+func (r *Run) UpdateStatus() {
+	status := RunSucceeded
+	for _, step := range r.Steps {
+		switch step.Status {
+		case RunFailed:
+			r.Status = RunFailed
+			return
+		case RunPending, RunRunning:
+			status = RunRunning
+		}
+	}
+	if len(r.Steps) == 0 {
+		status = RunPending
+	}
+	r.Status = status
+}
@@ -1,9 +1,12 @@
 package types
 
+import "time"
+
 type ServerConfig struct {
-	API  APIConfig  `json:"api" yaml:"api" mapstructure:"api"`
-	NATS NATSConfig `json:"nats" yaml:"nats" mapstructure:"nats"`
-	TLS  TLSConfig  `json:"tls" yaml:"tls" mapstructure:"tls"`
+	API     APIConfig     `json:"api" yaml:"api" mapstructure:"api"`
+	NATS    NATSConfig    `json:"nats" yaml:"nats" mapstructure:"nats"`
+	TLS     TLSConfig     `json:"tls" yaml:"tls" mapstructure:"tls"`
+	Storage StorageConfig `json:"storage" yaml:"storage" mapstructure:"storage"`
 }
 
 type APIConfig struct {
@@ -21,3 +24,37 @@ type TLSConfig struct {
 	Key  string `json:"key" yaml:"key" mapstructure:"key"`
 	Cert string `json:"cert" yaml:"cert" mapstructure:"cert"`
 }
+
+type StorageConfig struct {
+	// Backend is either `filesystem`, storing files under the API data directory, `jetstream`,
+	// storing them in the JetStream object store, or `s3`, storing them in an S3-compatible bucket.
+	// Defaults to `filesystem`.
+	Backend string      `json:"backend" yaml:"backend" mapstructure:"backend"`
+	S3      S3Config    `json:"s3" yaml:"s3" mapstructure:"s3"`
+	Cache   CacheConfig `json:"cache" yaml:"cache" mapstructure:"cache"`
+}
+
+type CacheConfig struct {
+	// MaxSize is the size in bytes the build cache may grow to before least recently used entries are evicted.
+	// Defaults to 10 GiB.
+	MaxSize int64 `json:"max_size" yaml:"max_size" mapstructure:"max_size"`
+	// TTL is how long entries are kept when drivers do not set one. Defaults to 7 days.
+	TTL time.Duration `json:"ttl" yaml:"ttl" mapstructure:"ttl"`
+}
+
+type S3Config struct {
+	// Endpoint is the base URL of the S3-compatible storage, e.g. `https://s3.eu-west-1.amazonaws.com` or `http://minio:9000`.
+	Endpoint string `json:"endpoint" yaml:"endpoint" mapstructure:"endpoint"`
+	// PublicEndpoint is the base URL presigned download URLs point at, for drivers that reach the storage under
+	// another address than the API server, e.g. `https://minio.example.com`. Defaults to Endpoint.
+	PublicEndpoint string `json:"public_endpoint" yaml:"public_endpoint" mapstructure:"public_endpoint"`
+	Bucket         string `json:"bucket" yaml:"bucket" mapstructure:"bucket"`
+	// Region is the region of the bucket. Defaults to `us-east-1`.
+	Region    string `json:"region" yaml:"region" mapstructure:"region"`
+	AccessKey string `json:"access_key" yaml:"access_key" mapstructure:"access_key"`
+	SecretKey string `json:"secret_key" yaml:"secret_key" mapstructure:"secret_key"`
+	// PathStyle addresses the bucket in the URL path instead of the host name, as MinIO expects.
+	PathStyle bool `json:"path_style" yaml:"path_style" mapstructure:"path_style"`
+	// PresignExpiry is how long presigned download URLs handed to drivers stay valid. Defaults to 15 minutes.
+	PresignExpiry time.Duration `json:"presign_expiry" yaml:"presign_expiry" mapstructure:"presign_expiry"`
+}
@@ -0,0 +1,37 @@
+package types
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const (
+	// WebhookSignatureHeader holds the signature of webhook requests and callbacks, see SignWebhook.
+	WebhookSignatureHeader = "X-Conveyor-Signature"
+	// WebhookTimestampHeader holds the Unix time a webhook request or callback was signed at.
+	WebhookTimestampHeader = "X-Conveyor-Timestamp"
+	// WebhookCallbackHeader holds the URL a webhook driver posts the result and logs of a delivery to.
+	WebhookCallbackHeader = "X-Conveyor-Callback-URL"
+)
+
+// WebhookCallbackSubject returns the subject the API server relays callbacks of kind `result` or `logs` on.
+func WebhookCallbackSubject(id string, kind string) string {
+	return "webhooks.callbacks." + id + "." + kind
+}
+
+// WebhookCallbackReply is the reply of the webhook bridge to a relayed callback.
+type WebhookCallbackReply struct {
+	// Status is the HTTP status the API server answers the callback with.
+	Status int `json:"status"`
+	// Error explains why the callback was rejected.
+	Error string `json:"error,omitempty"`
+}
+
+// SignWebhook returns the signature of a webhook body, `sha256=` followed by the hex encoded HMAC-SHA256 of `<timestamp>.<body>`.
+func SignWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}